@@ -0,0 +1,119 @@
+package blockstore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/blockstore/indexes"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+)
+
+// addressTxPrefix + address + block height + tx index -> block hash
+var addressTxPrefix = []byte("a")
+
+// GetTransactionsByAddress get the transactions sent from or to the address in the canonical blocks with height
+// in [fromHeight, toHeight], in ascending order of position. At most limit transactions are returned, no limit if
+// limit is 0. Return error if address index is not enabled.
+func (blockStore *BlockStore) GetTransactionsByAddress(addr types.Address, fromHeight, toHeight uint64, limit int) ([]*indexes.AddressTransaction, error) {
+	if !blockStore.addressIndex {
+		return nil, fmt.Errorf("address index is not enabled")
+	}
+	if fromHeight > toHeight {
+		return nil, fmt.Errorf("invalid block range [%d, %d]", fromHeight, toHeight)
+	}
+	if err := blockStore.checkPruned(fromHeight); err != nil {
+		return nil, err
+	}
+
+	prefix := append(append([]byte{}, addressTxPrefix...), addr[:]...)
+	iter := blockStore.store.NewIteratorWithPrefix(prefix, encodeBlockHeight(fromHeight))
+	defer iter.Release()
+
+	txs := make([]*indexes.AddressTransaction, 0)
+	bodies := make(map[types.Hash]*BlockBody)
+	for iter.Next() && (limit <= 0 || len(txs) < limit) {
+		key := iter.Key()
+		if len(key) != len(prefix)+16 {
+			continue
+		}
+		height := binary.BigEndian.Uint64(key[len(prefix):])
+		if height > toHeight {
+			break
+		}
+		index := binary.BigEndian.Uint64(key[len(prefix)+8:])
+		blockHash := common.BytesToHash(iter.Value())
+		body, ok := bodies[blockHash]
+		if !ok {
+			var err error
+			body, err = blockStore.GetBodyByHash(blockHash)
+			if err != nil {
+				log.Error("Failed to get the transactions of address %x, as: %v", addr, err)
+				return nil, err
+			}
+			bodies[blockHash] = body
+		}
+		if index >= uint64(len(body.Transactions)) {
+			return nil, fmt.Errorf("invalid address index, block %x has no transaction %d", blockHash, index)
+		}
+		txs = append(txs, &indexes.AddressTransaction{
+			Transaction: body.Transactions[index],
+			EntityLookupIndex: indexes.EntityLookupIndex{
+				BlockHash:   blockHash,
+				BlockHeight: height,
+				Index:       index,
+			},
+		})
+	}
+	return txs, iter.Error()
+}
+
+// writeAddressIndex index the transactions of a block by sender, recipient and the contract address created,
+// the contract address is got from receipts.
+func (blockStore *BlockStore) writeAddressIndex(batch dbstore.Batch, blockHash types.Hash, block *types.Block, receipts []*types.Receipt) error {
+	for i, tx := range block.Transactions {
+		for _, addr := range txAddresses(tx, i, receipts) {
+			err := batch.Put(addressTxKey(addr, block.Header.Height, uint64(i)), common.HashToBytes(blockHash))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deleteAddressIndex delete the address index of the transactions of a block.
+func (blockStore *BlockStore) deleteAddressIndex(batch dbstore.Batch, block *types.Block, receipts []*types.Receipt) error {
+	for i, tx := range block.Transactions {
+		for _, addr := range txAddresses(tx, i, receipts) {
+			err := batch.Delete(addressTxKey(addr, block.Header.Height, uint64(i)))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// txAddresses get the addresses related to the i-th transaction of a block.
+func txAddresses(tx *types.Transaction, i int, receipts []*types.Receipt) []types.Address {
+	addrs := make([]types.Address, 0, 3)
+	if tx.Data.From != nil {
+		addrs = append(addrs, *tx.Data.From)
+	}
+	if tx.Data.Recipient != nil {
+		addrs = append(addrs, *tx.Data.Recipient)
+	}
+	if i < len(receipts) && receipts[i] != nil && receipts[i].ContractAddress != (types.Address{}) {
+		addrs = append(addrs, receipts[i].ContractAddress)
+	}
+	return addrs
+}
+
+// addressTxKey = addressTxPrefix + address + block height + tx index
+func addressTxKey(addr types.Address, height uint64, index uint64) []byte {
+	key := append(append([]byte{}, addressTxPrefix...), addr[:]...)
+	key = append(key, encodeBlockHeight(height)...)
+	return append(key, encodeBlockHeight(index)...)
+}
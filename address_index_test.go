@@ -0,0 +1,74 @@
+package blockstore
+
+import (
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/craft/types"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+// mock transaction from sender to recipient
+func mockTransaction(from, to *types.Address, nonce uint64) *types.Transaction {
+	return &types.Transaction{
+		Data: types.TxData{
+			AccountNonce: nonce,
+			Recipient:    to,
+			From:         from,
+			Amount:       big.NewInt(100),
+			Price:        big.NewInt(100),
+		},
+	}
+}
+
+// test get transactions by address
+func TestBlockStore_GetTransactionsByAddress(t *testing.T) {
+	assert := assert.New(t)
+	config := mockBlockStoreConfig()
+	config.AddressIndex = true
+	blockStore, err := NewBlockStore(config)
+	assert.Nil(err)
+
+	alice := common.HexToAddress("0x01")
+	bob := common.HexToAddress("0x02")
+	contract := common.HexToAddress("0x03")
+	block := mockBlock()
+	block.Transactions = []*types.Transaction{mockTransaction(&alice, &bob, 1), mockTransaction(&bob, nil, 1)}
+	receipts := []*types.Receipt{{Status: 1}, {Status: 1, ContractAddress: contract}}
+	assert.Nil(blockStore.WriteBlockWithReceipts(block, receipts))
+	block2 := mockChildBlock(block, common.HexToHash("0x02"))
+	block2.Transactions = []*types.Transaction{mockTransaction(&alice, &contract, 2)}
+	assert.Nil(blockStore.WriteBlock(block2))
+
+	txs, err := blockStore.GetTransactionsByAddress(alice, 1, 2, 0)
+	assert.Nil(err)
+	assert.Equal(2, len(txs))
+	assert.Equal(uint64(1), txs[0].BlockHeight)
+	assert.Equal(uint64(2), txs[1].BlockHeight)
+	assert.Equal(uint64(2), txs[1].Transaction.Data.AccountNonce)
+
+	txs, err = blockStore.GetTransactionsByAddress(bob, 1, 2, 1)
+	assert.Nil(err)
+	assert.Equal(1, len(txs))
+	assert.Equal(uint64(0), txs[0].Index)
+
+	txs, err = blockStore.GetTransactionsByAddress(contract, 1, 1, 0)
+	assert.Nil(err)
+	assert.Equal(1, len(txs))
+	assert.Equal(uint64(1), txs[0].Index)
+
+	// rollback removes address index
+	assert.Nil(blockStore.Rollback(1))
+	txs, err = blockStore.GetTransactionsByAddress(contract, 1, 2, 0)
+	assert.Nil(err)
+	assert.Equal(1, len(txs))
+}
+
+// test get transactions by address without address index
+func TestBlockStore_GetTransactionsByAddressDisabled(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	_, err = blockStore.GetTransactionsByAddress(common.HexToAddress("0x01"), 1, 2, 0)
+	assert.NotNil(err)
+}
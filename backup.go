@@ -0,0 +1,305 @@
+package blockstore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/config"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/blockstore/dbstore/compressedstore"
+	"github.com/DSiSc/blockstore/dbstore/encryptedstore"
+	"github.com/DSiSc/blockstore/dbstore/leveldbstore"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+	"io/ioutil"
+	"os"
+)
+
+// backupRecordKey tracks the height and hash of the latest block in a backup.
+const backupRecordKey = "BackupRecord"
+
+// Backup copy the committed state of the block store to the leveldb database in destDir from a snapshot, the
+// block store remains writable during backup. A full backup requires destDir not exist or be empty, and copies
+// all records. An incremental backup updates the backup in destDir with the blocks above its backup height, which
+// requires the chain not reorganized below the backup height since then, the records written by Put are not copied.
+// The block store with freezer is not supported. Return the height of the latest block in the backup.
+func (blockStore *BlockStore) Backup(destDir string, incremental bool) (uint64, error) {
+	if blockStore.freezer != nil {
+		return 0, fmt.Errorf("can not backup block store with freezer, as the frozen blocks are not in database")
+	}
+	viewStore, err := blockStore.snapshot()
+	if err != nil {
+		return 0, err
+	}
+	defer viewStore.store.Close()
+	currentBlock := viewStore.GetCurrentBlock()
+	if currentBlock == nil {
+		return 0, fmt.Errorf("can not backup an empty block store")
+	}
+
+	if !incremental {
+		entries, err := ioutil.ReadDir(destDir)
+		if err != nil && !os.IsNotExist(err) {
+			return 0, fmt.Errorf("failed to read backup directory %s, as: %v", destDir, err)
+		}
+		if len(entries) > 0 {
+			return 0, fmt.Errorf("backup directory %s is not empty", destDir)
+		}
+	} else if _, err := os.Stat(destDir); err != nil {
+		return 0, fmt.Errorf("failed to find the backup to update in %s, as: %v", destDir, err)
+	}
+	dest, err := leveldbstore.NewLevelDBStore(destDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open backup database in %s, as: %v", destDir, err)
+	}
+	defer dest.Close()
+	// the backup is encrypted by the keys of the block store
+	var destStore dbstore.DBStore = dest
+	if len(blockStore.encryptionKeys) > 0 {
+		destStore, err = encryptedstore.NewEncryptedStore(dest, blockStore.encryptionKeys)
+		if err != nil {
+			return 0, err
+		}
+	}
+	// the records are copied decompressed, a new backup is formatted so the raw values are escaped
+	if !incremental {
+		_, err = compressedstore.Format(destStore)
+		if err != nil {
+			return 0, err
+		}
+	}
+	formatted, err := compressedstore.Formatted(destStore)
+	if err != nil {
+		return 0, err
+	}
+	if formatted {
+		destStore, err = compressedstore.NewCompressedStore(destStore, compressedstore.NONE, 0)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var selector leveldbstore.BackupSelector
+	if incremental {
+		backupHeight, backupHash, err := loadBackupRecord(destStore)
+		if err != nil {
+			return 0, err
+		}
+		canonicalHash, err := viewStore.getCanonicalHash(backupHeight)
+		if err != nil || canonicalHash != backupHash {
+			return 0, fmt.Errorf("the block %x at backup height %d is not canonical any more, please take a full backup", backupHash, backupHeight)
+		}
+		log.Info("Start incremental backup of block store from height %d to %d", backupHeight+1, currentBlock.Header.Height)
+		selector = viewStore.selectBlocksAbove(backupHeight)
+	} else {
+		log.Info("Start full backup of block store at height %d", currentBlock.Header.Height)
+	}
+
+	snapshot := viewStore.store.(*snapshotStore).snapshot
+	err = leveldbstore.CopySnapshot(snapshot, destStore, selector)
+	if err != nil {
+		log.Error("Failed to backup block store to %s, as: %v", destDir, err)
+		return 0, err
+	}
+	batch := destStore.NewBatch()
+	batch.Put([]byte(backupRecordKey), append(encodeBlockHeight(currentBlock.Header.Height), common.HashToBytes(currentBlock.HeaderHash)...))
+	err = batch.WriteSync()
+	if err != nil {
+		return 0, fmt.Errorf("failed to record backup height, as: %v", err)
+	}
+	log.Info("Finish backup of block store to %s at height %d", destDir, currentBlock.Header.Height)
+	return currentBlock.Header.Height, nil
+}
+
+// selectBlocksAbove select the records of the blocks above the height, including the side chain blocks, along
+// with the canonical indexes of them, the section blooms containing them and the database metadata.
+func (blockStore *BlockStore) selectBlocksAbove(height uint64) leveldbstore.BackupSelector {
+	return func(snapshot dbstore.DBSnapshot, copyKey func(key []byte) error) error {
+		for _, key := range []string{latestBlockKey, schemaVersionKey, codecKey, bloomSectionIndexKey, pruneHorizonKey} {
+			err := copyKey([]byte(key))
+			if err != nil {
+				return err
+			}
+		}
+
+		// entities of all blocks above the height
+		iter := snapshot.NewIteratorWithPrefix(headerHeightPrefix, nil)
+		defer iter.Release()
+		for iter.Next() {
+			key := iter.Key()
+			if len(key) != len(headerHeightPrefix)+common.HashLength || len(iter.Value()) != 8 || binary.BigEndian.Uint64(iter.Value()) <= height {
+				continue
+			}
+			hashByte := key[len(headerHeightPrefix):]
+			for _, prefix := range [][]byte{headerHeightPrefix, headerPrefix, bodyPrefix, blockPrefix, receiptPrefix, blockBloomPrefix} {
+				err := copyKey(append(append([]byte{}, prefix...), hashByte...))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if err := iter.Error(); err != nil {
+			return fmt.Errorf("failed to iterate block header records, as: %v", err)
+		}
+
+		// canonical indexes of the blocks above the height
+		for h := height + 1; h <= blockStore.GetCurrentBlockHeight(); h++ {
+			err := copyKey(append(blockHeightPrefix, encodeBlockHeight(h)...))
+			if err != nil {
+				return err
+			}
+			if blockStore.headersOnly {
+				continue
+			}
+			blockHash, err := blockStore.getCanonicalHash(h)
+			if err != nil {
+				return err
+			}
+			err = blockStore.selectCanonicalIndexes(blockHash, copyKey)
+			if err != nil {
+				return err
+			}
+		}
+
+		// section blooms merged with the blocks above the height
+		if blockStore.bloomSectionSize > 0 {
+			sectionIter := snapshot.NewIteratorWithPrefix(sectionBloomPrefix, encodeBlockHeight(height/blockStore.bloomSectionSize))
+			defer sectionIter.Release()
+			for sectionIter.Next() {
+				if len(sectionIter.Key()) != len(sectionBloomPrefix)+8 {
+					continue
+				}
+				err := copyKey(sectionIter.Key())
+				if err != nil {
+					return err
+				}
+			}
+			if err := sectionIter.Error(); err != nil {
+				return fmt.Errorf("failed to iterate section bloom records, as: %v", err)
+			}
+		}
+		return nil
+	}
+}
+
+// selectCanonicalIndexes select the tx lookup indexes and address index of a canonical block.
+func (blockStore *BlockStore) selectCanonicalIndexes(blockHash types.Hash, copyKey func(key []byte) error) error {
+	block, err := blockStore.GetBlockByHash(blockHash)
+	if err != nil {
+		return err
+	}
+	for _, tx := range block.Transactions {
+		err = copyKey(append(txPrefix, common.HashToBytes(common.TxHash(tx))...))
+		if err != nil {
+			return err
+		}
+	}
+	if !blockStore.addressIndex {
+		return nil
+	}
+	// the block written without receipts has no receipt address entries
+	receipts, _ := blockStore.GetReceiptByBlockHash(blockHash)
+	for i, tx := range block.Transactions {
+		for _, addr := range txAddresses(tx, i, receipts) {
+			err = copyKey(addressTxKey(addr, block.Header.Height, uint64(i)))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadBackupRecord load the height and hash of the latest block in the backup.
+func loadBackupRecord(store dbstore.DBStore) (uint64, types.Hash, error) {
+	recordByte, err := store.Get([]byte(backupRecordKey))
+	if err != nil {
+		return 0, types.Hash{}, fmt.Errorf("failed to get backup record, as: %w", err)
+	}
+	if len(recordByte) != 8+common.HashLength {
+		return 0, types.Hash{}, fmt.Errorf("%w: invalid backup record %x", dbstore.ErrCorrupted, recordByte)
+	}
+	return binary.BigEndian.Uint64(recordByte), common.BytesToHash(recordByte[8:]), nil
+}
+
+// RestoreBackup validate the backup in backupDir and swap a copy of it in as the leveldb database of the block
+// store configured by conf, the block store must be closed. The backup is opened read-only with the storage
+// options and encryption keys of conf.
+// The backup is valid if its latest block matches the backup record and Verify finds no issue. The replaced
+// database is moved to DataPath.replaced.
+func RestoreBackup(backupDir string, conf *config.BlockStoreConfig) error {
+	if _, err := os.Stat(backupDir); err != nil {
+		return fmt.Errorf("failed to find backup in %s, as: %v", backupDir, err)
+	}
+	dataDir := conf.DataPath
+	backupStore, err := NewBlockStore(&config.BlockStoreConfig{
+		PluginName:           PLUGIN_LEVELDB,
+		DataPath:             backupDir,
+		ReadOnly:             true,
+		HeadersOnly:          conf.HeadersOnly,
+		AddressIndex:         conf.AddressIndex,
+		BloomSectionSize:     conf.BloomSectionSize,
+		Compression:          conf.Compression,
+		CompressionThreshold: conf.CompressionThreshold,
+		EncryptionKey:        conf.EncryptionKey,
+		EncryptionKeyFile:    conf.EncryptionKeyFile,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open backup in %s, as: %w", backupDir, err)
+	}
+	defer backupStore.Close()
+
+	backupHeight, backupHash, err := loadBackupRecord(backupStore.store)
+	if err != nil {
+		return err
+	}
+	currentBlock := backupStore.GetCurrentBlock()
+	if currentBlock == nil || currentBlock.HeaderHash != backupHash {
+		return fmt.Errorf("%w: the latest block of backup doesn't match the backup record at height %d", dbstore.ErrCorrupted, backupHeight)
+	}
+	report, err := backupStore.Verify(false)
+	if err != nil {
+		return err
+	}
+	if !report.Consistent() {
+		return fmt.Errorf("%w: backup has %d issues, the first is %s: %s", dbstore.ErrCorrupted, len(report.Issues), report.Issues[0].Kind, report.Issues[0].Detail)
+	}
+
+	restoringDir := dataDir + ".restoring"
+	err = os.RemoveAll(restoringDir)
+	if err != nil {
+		return fmt.Errorf("failed to clean restoring directory %s, as: %v", restoringDir, err)
+	}
+	_, err = backupStore.Backup(restoringDir, false)
+	if err != nil {
+		return fmt.Errorf("failed to copy backup to %s, as: %v", restoringDir, err)
+	}
+	// the restored database is not a backup any more
+	restored, err := leveldbstore.NewLevelDBStore(restoringDir)
+	if err != nil {
+		return fmt.Errorf("failed to open restored database in %s, as: %v", restoringDir, err)
+	}
+	err = restored.Delete([]byte(backupRecordKey))
+	restored.Close()
+	if err != nil {
+		return fmt.Errorf("failed to remove backup record from restored database, as: %v", err)
+	}
+
+	if _, err := os.Stat(dataDir); err == nil {
+		replacedDir := dataDir + ".replaced"
+		err = os.RemoveAll(replacedDir)
+		if err == nil {
+			err = os.Rename(dataDir, replacedDir)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to move the replaced database to %s, as: %v", replacedDir, err)
+		}
+		log.Info("The replaced database is moved to %s", replacedDir)
+	}
+	err = os.Rename(restoringDir, dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to move the restored database to %s, as: %v", dataDir, err)
+	}
+	log.Info("Finish restoring block store in %s to height %d from backup %s", dataDir, backupHeight, backupDir)
+	return nil
+}
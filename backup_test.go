@@ -0,0 +1,121 @@
+package blockstore
+
+import (
+	"errors"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/config"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+// test full and incremental backup, then restore the backup
+func TestBlockStore_BackupAndRestore(t *testing.T) {
+	assert := assert.New(t)
+	backupDir, dataDir := "./backupdata", "./restoredata"
+	defer os.RemoveAll(backupDir)
+	defer os.RemoveAll(dataDir)
+	defer os.RemoveAll(dataDir + ".replaced")
+
+	blockStore, err := NewBlockStore(&config.BlockStoreConfig{
+		PluginName:       PLUGIN_MEMDB,
+		AddressIndex:     true,
+		BloomSectionSize: 2,
+	})
+	assert.Nil(err)
+	_, err = blockStore.Backup(backupDir, false)
+	assert.NotNil(err)
+
+	block1, tx := mockBlockWithTx()
+	assert.Nil(blockStore.WriteBlockWithReceipts(block1, mockReceipts()))
+	height, err := blockStore.Backup(backupDir, false)
+	assert.Nil(err)
+	assert.Equal(uint64(1), height)
+	_, err = blockStore.Backup(backupDir, false)
+	assert.NotNil(err)
+
+	block2 := mockChildBlock(block1, common.HexToHash("0x1"))
+	block3 := mockChildBlock(block2, common.HexToHash("0x2"))
+	sideBlock := mockChildBlock(block1, common.HexToHash("0x3"))
+	assert.Nil(blockStore.WriteBlockWithReceipts(block2, nil))
+	assert.Nil(blockStore.WriteBlock(block3))
+	assert.Nil(blockStore.WriteBlock(sideBlock))
+	height, err = blockStore.Backup(backupDir, true)
+	assert.Nil(err)
+	assert.Equal(uint64(3), height)
+
+	// restore to the existing database
+	restoredStore, err := NewBlockStore(&config.BlockStoreConfig{PluginName: PLUGIN_LEVELDB, DataPath: dataDir})
+	assert.Nil(err)
+	assert.Nil(restoredStore.Close())
+	assert.Nil(RestoreBackup(backupDir, &config.BlockStoreConfig{PluginName: PLUGIN_LEVELDB, DataPath: dataDir}))
+	_, err = os.Stat(dataDir + ".replaced")
+	assert.Nil(err)
+
+	restoredStore, err = NewBlockStore(&config.BlockStoreConfig{PluginName: PLUGIN_LEVELDB, DataPath: dataDir, AddressIndex: true})
+	assert.Nil(err)
+	defer restoredStore.Close()
+	assert.Equal(block3.HeaderHash, restoredStore.GetCurrentBlock().HeaderHash)
+	_, blockHash, _, _, err := restoredStore.GetTransactionByHash(common.TxHash(&tx))
+	assert.Nil(err)
+	assert.Equal(block1.HeaderHash, blockHash)
+	_, err = restoredStore.GetHeaderByHash(sideBlock.HeaderHash)
+	assert.Nil(err)
+	txs, err := restoredStore.GetTransactionsByAddress(*tx.Data.From, 0, 3, 0)
+	assert.Nil(err)
+	assert.Equal(1, len(txs))
+	_, err = restoredStore.Get([]byte(backupRecordKey))
+	assert.True(errors.Is(err, dbstore.ErrNotFound))
+	report, err := restoredStore.Verify(false)
+	assert.Nil(err)
+	assert.True(report.Consistent())
+
+	// the chain is reorganized below the backup height
+	assert.Nil(blockStore.Reorg(sideBlock.HeaderHash))
+	_, err = blockStore.Backup(backupDir, true)
+	assert.NotNil(err)
+}
+
+// test restore from an invalid backup
+func TestRestoreBackup_Invalid(t *testing.T) {
+	assert := assert.New(t)
+	backupDir, dataDir := "./invalidbackupdata", "./restoredata"
+	defer os.RemoveAll(backupDir)
+	defer os.RemoveAll(dataDir)
+
+	assert.NotNil(RestoreBackup(backupDir, &config.BlockStoreConfig{PluginName: PLUGIN_LEVELDB, DataPath: dataDir}))
+	blockStore, err := NewBlockStore(&config.BlockStoreConfig{PluginName: PLUGIN_LEVELDB, DataPath: backupDir})
+	assert.Nil(err)
+	assert.Nil(blockStore.WriteBlock(mockBlock()))
+	assert.Nil(blockStore.Close())
+
+	err = RestoreBackup(backupDir, &config.BlockStoreConfig{PluginName: PLUGIN_LEVELDB, DataPath: dataDir})
+	assert.True(errors.Is(err, dbstore.ErrNotFound))
+	_, err = os.Stat(dataDir)
+	assert.True(os.IsNotExist(err))
+}
+
+// test restore from the backup of a headers-only block store
+func TestRestoreBackup_HeadersOnly(t *testing.T) {
+	assert := assert.New(t)
+	backupDir, dataDir := t.TempDir()+"/backup", t.TempDir()+"/data"
+	blockStoreConfig := &config.BlockStoreConfig{PluginName: PLUGIN_LEVELDB, DataPath: dataDir, HeadersOnly: true}
+
+	blockStore, err := NewBlockStore(&config.BlockStoreConfig{PluginName: PLUGIN_MEMDB, HeadersOnly: true})
+	assert.Nil(err)
+	block1, _ := mockBlockWithTx()
+	block2 := mockChildBlock(block1, common.HexToHash("0x1"))
+	assert.Nil(blockStore.WriteBlock(block1))
+	assert.Nil(blockStore.WriteBlock(block2))
+	_, err = blockStore.Backup(backupDir, false)
+	assert.Nil(err)
+
+	assert.Nil(RestoreBackup(backupDir, blockStoreConfig))
+	restoredStore, err := NewBlockStore(blockStoreConfig)
+	assert.Nil(err)
+	defer restoredStore.Close()
+	assert.Equal(block2.HeaderHash, restoredStore.GetCurrentBlock().HeaderHash)
+	_, err = restoredStore.GetHeaderByHash(block1.HeaderHash)
+	assert.Nil(err)
+}
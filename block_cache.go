@@ -0,0 +1,172 @@
+package blockstore
+
+import (
+	"github.com/DSiSc/blockstore/cache"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/indexes"
+	"github.com/DSiSc/craft/types"
+	"math/big"
+)
+
+// CacheStats is the statistics of the block store caches.
+type CacheStats struct {
+	Blocks    cache.Stats
+	Headers   cache.Stats
+	Receipts  cache.Stats
+	TxLookups cache.Stats
+}
+
+// CacheStats get the hit/miss counters and the number of entries of the block store caches.
+func (blockStore *BlockStore) CacheStats() CacheStats {
+	return CacheStats{
+		Blocks:    blockStore.blockCache.Stats(),
+		Headers:   blockStore.headerCache.Stats(),
+		Receipts:  blockStore.receiptCache.Stats(),
+		TxLookups: blockStore.txLookupCache.Stats(),
+	}
+}
+
+// cacheWrittenBlock add copies of the committed block, its header, receipts and tx lookup indexes to caches.
+func (blockStore *BlockStore) cacheWrittenBlock(block *types.Block, receipts []*types.Receipt, canonical bool) {
+	blockStore.headerCache.Add(block.HeaderHash, copyHeader(block.Header))
+	if blockStore.headersOnly {
+		return
+	}
+	blockStore.blockCache.Add(block.HeaderHash, copyBlock(block))
+	if receipts != nil {
+		blockStore.receiptCache.Add(block.HeaderHash, copyReceipts(receipts))
+	}
+	if !canonical {
+		return
+	}
+	for i, tx := range block.Transactions {
+		blockStore.txLookupCache.Add(common.TxHash(tx), &indexes.EntityLookupIndex{
+			BlockHash:   block.HeaderHash,
+			BlockHeight: block.Header.Height,
+			Index:       uint64(i),
+		})
+	}
+}
+
+// purgeCaches remove the cached entries which may be changed by rollback or reorg. Tx lookup indexes are
+// rewritten by both, blocks, headers and receipts are only removed by rollback. The purge increases the
+// generation of caches, so the entries loaded by concurrent lookups before it are not cached.
+func (blockStore *BlockStore) purgeCaches(rollback bool) {
+	blockStore.txLookupCache.Purge()
+	if rollback {
+		blockStore.blockCache.Purge()
+		blockStore.headerCache.Purge()
+		blockStore.receiptCache.Purge()
+	}
+}
+
+// copyBlock copy the cached block, so the caller changing the returned block doesn't change the cached one.
+func copyBlock(block *types.Block) *types.Block {
+	blockCopy := *block
+	blockCopy.Header = copyHeader(block.Header)
+	if block.Transactions != nil {
+		blockCopy.Transactions = make([]*types.Transaction, len(block.Transactions))
+		for i, tx := range block.Transactions {
+			blockCopy.Transactions[i] = copyTransaction(tx)
+		}
+	}
+	return &blockCopy
+}
+
+// copyHeader copy the cached block header.
+func copyHeader(header *types.Header) *types.Header {
+	if header == nil {
+		return nil
+	}
+	headerCopy := *header
+	if header.SigData != nil {
+		headerCopy.SigData = make([][]byte, len(header.SigData))
+		for i, sig := range header.SigData {
+			headerCopy.SigData[i] = copyBytes(sig)
+		}
+	}
+	return &headerCopy
+}
+
+// copyTransaction copy the cached transaction, along with its cached hash, size and sender.
+func copyTransaction(tx *types.Transaction) *types.Transaction {
+	if tx == nil {
+		return nil
+	}
+	txCopy := &types.Transaction{Data: tx.Data}
+	txCopy.Data.Price = copyBigInt(tx.Data.Price)
+	txCopy.Data.Amount = copyBigInt(tx.Data.Amount)
+	txCopy.Data.V = copyBigInt(tx.Data.V)
+	txCopy.Data.R = copyBigInt(tx.Data.R)
+	txCopy.Data.S = copyBigInt(tx.Data.S)
+	txCopy.Data.Payload = copyBytes(tx.Data.Payload)
+	if tx.Data.Recipient != nil {
+		recipient := *tx.Data.Recipient
+		txCopy.Data.Recipient = &recipient
+	}
+	if tx.Data.From != nil {
+		from := *tx.Data.From
+		txCopy.Data.From = &from
+	}
+	if tx.Data.Hash != nil {
+		hash := *tx.Data.Hash
+		txCopy.Data.Hash = &hash
+	}
+	if hash := tx.Hash.Load(); hash != nil {
+		txCopy.Hash.Store(hash)
+	}
+	if size := tx.Size.Load(); size != nil {
+		txCopy.Size.Store(size)
+	}
+	if from := tx.From.Load(); from != nil {
+		txCopy.From.Store(from)
+	}
+	return txCopy
+}
+
+// copyReceipts copy the cached receipts along with their logs.
+func copyReceipts(receipts []*types.Receipt) []*types.Receipt {
+	if receipts == nil {
+		return nil
+	}
+	receiptsCopy := make([]*types.Receipt, len(receipts))
+	for i, receipt := range receipts {
+		if receipt == nil {
+			continue
+		}
+		receiptCopy := *receipt
+		receiptCopy.PostState = copyBytes(receipt.PostState)
+		if receipt.Logs != nil {
+			receiptCopy.Logs = make([]*types.Log, len(receipt.Logs))
+			for j, receiptLog := range receipt.Logs {
+				if receiptLog == nil {
+					continue
+				}
+				logCopy := *receiptLog
+				logCopy.Data = copyBytes(receiptLog.Data)
+				if receiptLog.Topics != nil {
+					logCopy.Topics = append([]types.Hash{}, receiptLog.Topics...)
+				}
+				receiptCopy.Logs[j] = &logCopy
+			}
+		}
+		receiptsCopy[i] = &receiptCopy
+	}
+	return receiptsCopy
+}
+
+// copyBigInt copy the big int, nil is kept.
+func copyBigInt(x *big.Int) *big.Int {
+	if x == nil {
+		return nil
+	}
+	return new(big.Int).Set(x)
+}
+
+// copyBytes copy the bytes, nil is kept.
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,209 @@
+package blockstore
+
+import (
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/config"
+	"github.com/DSiSc/craft/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// test the written block is served from caches
+func TestBlockStore_CacheWrittenBlock(t *testing.T) {
+	assert := assert.New(t)
+	blockStore := mockBlockStore(t, withCaches(16))
+	block, tx := mockBlockWithTx()
+	assert.Nil(blockStore.WriteBlockWithReceipts(block, mockReceipts()))
+	stats := blockStore.CacheStats()
+	assert.Equal(1, stats.Blocks.Len)
+	assert.Equal(1, stats.Receipts.Len)
+	assert.Equal(1, stats.TxLookups.Len)
+
+	// remove the records from database, the lookups are still served from caches
+	assert.Nil(blockStore.Delete(append(headerPrefix, block.HeaderHash[:]...)))
+	assert.Nil(blockStore.Delete(append(txPrefix, common.HashToBytes(common.TxHash(&tx))...)))
+	blockSaved, err := blockStore.GetBlockByHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(block.HeaderHash, blockSaved.HeaderHash)
+	assert.Equal(block.Header, blockSaved.Header)
+	txSaved, _, _, _, err := blockStore.GetTransactionByHash(common.TxHash(&tx))
+	assert.Nil(err)
+	assert.Equal(tx.Data.AccountNonce, txSaved.Data.AccountNonce)
+	receipts, err := blockStore.GetReceiptByBlockHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(mockReceipts(), receipts)
+
+	stats = blockStore.CacheStats()
+	assert.Equal(uint64(2), stats.Blocks.Hits)
+	assert.Equal(uint64(1), stats.TxLookups.Hits)
+	assert.Equal(uint64(1), stats.Receipts.Hits)
+}
+
+// test the caches are populated on read
+func TestBlockStore_CacheOnRead(t *testing.T) {
+	assert := assert.New(t)
+	blockStore := mockBlockStore(t, withCaches(16))
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+	blockStore.blockCache.Purge()
+
+	_, err := blockStore.GetBlockByHash(block.HeaderHash)
+	assert.Nil(err)
+	_, err = blockStore.GetBlockByHash(block.HeaderHash)
+	assert.Nil(err)
+	stats := blockStore.CacheStats()
+	assert.Equal(uint64(1), stats.Blocks.Misses)
+	assert.Equal(uint64(1), stats.Blocks.Hits)
+}
+
+// test rollback invalidates caches
+func TestBlockStore_CacheRollback(t *testing.T) {
+	assert := assert.New(t)
+	blockStore := mockBlockStore(t, withCaches(16))
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+	block2, tx := mockBlockWithTx()
+	block2.Header.PrevBlockHash = block.HeaderHash
+	block2.Header.Height = 2
+	block2.HeaderHash = types.Hash{}
+	block2.HeaderHash = common.HeaderHash(block2)
+	assert.Nil(blockStore.WriteBlockWithReceipts(block2, mockReceipts()))
+
+	assert.Nil(blockStore.Rollback(1))
+	_, err := blockStore.GetBlockByHash(block2.HeaderHash)
+	assert.NotNil(err)
+	_, _, _, _, err = blockStore.GetTransactionByHash(common.TxHash(&tx))
+	assert.NotNil(err)
+	_, err = blockStore.GetReceiptByBlockHash(block2.HeaderHash)
+	assert.NotNil(err)
+}
+
+// test reorg invalidates tx lookup cache
+func TestBlockStore_CacheReorg(t *testing.T) {
+	assert := assert.New(t)
+	blockStore := mockBlockStore(t, withCaches(16))
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+	block2a, tx := mockBlockWithTx()
+	block2a.Header.PrevBlockHash = block.HeaderHash
+	block2a.Header.Height = 2
+	block2a.HeaderHash = types.Hash{}
+	block2a.HeaderHash = common.HeaderHash(block2a)
+	assert.Nil(blockStore.WriteBlock(block2a))
+	block2b := mockChildBlock(block, blockHash)
+	assert.Nil(blockStore.WriteBlock(block2b))
+
+	_, txBlockHash, _, _, err := blockStore.GetTransactionByHash(common.TxHash(&tx))
+	assert.Nil(err)
+	assert.Equal(block2a.HeaderHash, txBlockHash)
+	assert.Nil(blockStore.Reorg(block2b.HeaderHash))
+	_, _, _, _, err = blockStore.GetTransactionByHash(common.TxHash(&tx))
+	assert.NotNil(err)
+	assert.Equal(0, blockStore.CacheStats().TxLookups.Len)
+}
+
+// test the block loaded before rollback is not cached after it
+func TestBlockStore_CacheStaleRead(t *testing.T) {
+	assert := assert.New(t)
+	blockStore := mockBlockStore(t, withCaches(16))
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+	block2 := mockChildBlock(block, blockHash)
+	assert.Nil(blockStore.WriteBlock(block2))
+	blockStore.blockCache.Purge()
+
+	// a lookup loads block2 from database, then rollback removes it before the lookup caches it
+	generation := blockStore.blockCache.Generation()
+	staleBlock, _, err := blockStore.getBlockWithSize(block2.HeaderHash)
+	assert.Nil(err)
+	assert.Nil(blockStore.Rollback(1))
+	assert.False(blockStore.blockCache.AddIfGeneration(generation, block2.HeaderHash, staleBlock))
+	_, err = blockStore.GetBlockByHash(block2.HeaderHash)
+	assert.NotNil(err)
+}
+
+// test the header is served from cache
+func TestBlockStore_CacheHeader(t *testing.T) {
+	assert := assert.New(t)
+	blockStore := mockBlockStore(t, withCaches(16))
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+	assert.Equal(1, blockStore.CacheStats().Headers.Len)
+	blockStore.headerCache.Purge()
+
+	header, err := blockStore.GetHeaderByHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(block.Header, header)
+	assert.Nil(blockStore.Delete(append(headerPrefix, block.HeaderHash[:]...)))
+	header, err = blockStore.GetHeaderByHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(block.Header, header)
+	stats := blockStore.CacheStats()
+	assert.Equal(uint64(1), stats.Headers.Misses)
+	assert.Equal(uint64(1), stats.Headers.Hits)
+}
+
+// test changing the returned block and header doesn't change the cached ones
+func TestBlockStore_CacheCopy(t *testing.T) {
+	assert := assert.New(t)
+	blockStore := mockBlockStore(t, withCaches(16))
+	block, _ := mockBlockWithTx()
+	assert.Nil(blockStore.WriteBlock(block))
+
+	blockSaved, err := blockStore.GetBlockByHash(block.HeaderHash)
+	assert.Nil(err)
+	blockSaved.Header.Height = 100
+	blockSaved.Transactions[0].Data.AccountNonce = 100
+	header, err := blockStore.GetHeaderByHash(block.HeaderHash)
+	assert.Nil(err)
+	header.Height = 100
+
+	blockSaved, err = blockStore.GetBlockByHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(block.Header.Height, blockSaved.Header.Height)
+	assert.Equal(block.Transactions[0].Data.AccountNonce, blockSaved.Transactions[0].Data.AccountNonce)
+	assert.Equal(common.TxHash(block.Transactions[0]), common.TxHash(blockSaved.Transactions[0]))
+	header, err = blockStore.GetHeaderByHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(block.Header.Height, header.Height)
+}
+
+// test changing the block and receipts after writing doesn't change the queued or cached ones
+func TestBlockStore_CacheCopyOnWrite(t *testing.T) {
+	for _, options := range [][]func(*config.BlockStoreConfig){{withCaches(16)}, {withCaches(16), withGroupCommit}} {
+		assert := assert.New(t)
+		blockStore := mockBlockStore(t, options...)
+		block, tx := mockBlockWithTx()
+		receipts := mockReceipts()
+		assert.Nil(blockStore.WriteBlockWithReceipts(block, receipts))
+		block.Header.Height = 100
+		block.Transactions[0].Data.AccountNonce = 100
+		receipts[0].Status = 100
+
+		// read from the write pipeline or caches
+		blockSaved, err := blockStore.GetBlockByHash(block.HeaderHash)
+		assert.Nil(err)
+		assert.Equal(uint64(1), blockSaved.Header.Height)
+		assert.Equal(tx.Data.AccountNonce, blockSaved.Transactions[0].Data.AccountNonce)
+		blockSaved.Header.Height = 100
+		header, err := blockStore.GetHeaderByHash(block.HeaderHash)
+		assert.Nil(err)
+		assert.Equal(uint64(1), header.Height)
+		receiptsSaved, err := blockStore.GetReceiptByBlockHash(block.HeaderHash)
+		assert.Nil(err)
+		assert.Equal(mockReceipts(), receiptsSaved)
+		receiptsSaved[0].Status = 100
+		receiptsSaved, err = blockStore.GetReceiptByBlockHash(block.HeaderHash)
+		assert.Nil(err)
+		assert.Equal(mockReceipts(), receiptsSaved)
+
+		// read from caches after commit
+		assert.Nil(blockStore.Flush())
+		blockSaved, err = blockStore.GetBlockByHash(block.HeaderHash)
+		assert.Nil(err)
+		assert.Equal(uint64(1), blockSaved.Header.Height)
+		receiptsSaved, err = blockStore.GetReceiptByBlockHash(block.HeaderHash)
+		assert.Nil(err)
+		assert.Equal(mockReceipts(), receiptsSaved)
+	}
+}
@@ -0,0 +1,105 @@
+package blockstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+)
+
+// the default max bytes of the entities returned by one range query
+const DEFAULT_MAX_RANGE_BYTES = 8 * 1024 * 1024
+
+// GetBlocksByRange get the canonical blocks with height in [from, to] in ascending order, each block is passed
+// to the callback. Iteration stops when the callback returns false or the total size of the returned blocks
+// reaches maxBytes, DEFAULT_MAX_RANGE_BYTES will be used if maxBytes is 0. At least one block will be returned.
+func (blockStore *BlockStore) GetBlocksByRange(from, to uint64, maxBytes int, callback func(block *types.Block) bool) error {
+	return blockStore.iterateCanonicalHashes(from, to, maxBytes, func(hash types.Hash) (int, bool, error) {
+		block, size, err := blockStore.getBlockWithSize(hash)
+		if err != nil {
+			return 0, false, err
+		}
+		return size, callback(block), nil
+	})
+}
+
+// GetHeadersByRange get the canonical block headers with height in [from, to] in ascending order, each header
+// is passed to the callback. Iteration stops when the callback returns false or the total size of the returned
+// headers reaches maxBytes, DEFAULT_MAX_RANGE_BYTES will be used if maxBytes is 0. At least one header will be returned.
+func (blockStore *BlockStore) GetHeadersByRange(from, to uint64, maxBytes int, callback func(header *types.Header) bool) error {
+	return blockStore.iterateCanonicalHashes(from, to, maxBytes, func(hash types.Hash) (int, bool, error) {
+		header, size, err := blockStore.getHeaderWithSize(hash)
+		if err != nil {
+			return 0, false, err
+		}
+		return size, callback(header), nil
+	})
+}
+
+// iterateCanonicalHashes walk the height mappings in [from, to] in ascending order. The visitor return the size
+// of the visited entity and whether to continue.
+func (blockStore *BlockStore) iterateCanonicalHashes(from, to uint64, maxBytes int, visitor func(hash types.Hash) (int, bool, error)) error {
+	if from > to {
+		return fmt.Errorf("invalid block range [%d, %d]", from, to)
+	}
+	if maxBytes <= 0 {
+		maxBytes = DEFAULT_MAX_RANGE_BYTES
+	}
+
+	totalBytes := 0
+	visit := func(hash types.Hash) (bool, error) {
+		size, goon, err := visitor(hash)
+		if err != nil {
+			log.Error("Failed to get entities in block range [%d, %d], as: %v", from, to, err)
+			return false, err
+		}
+		totalBytes += size
+		return goon && totalBytes < maxBytes, nil
+	}
+
+	// the frozen blocks are walked in freezer before the height mappings in database
+	frozen := blockStore.freezer.Frozen()
+	for height := from; height < frozen && height <= to; height++ {
+		hash, err := blockStore.getFrozenHash(height)
+		if errors.Is(err, dbstore.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		goon, err := visit(hash)
+		if err != nil || !goon {
+			return err
+		}
+	}
+	if from < frozen {
+		if frozen > to {
+			return nil
+		}
+		from = frozen
+	}
+
+	iter := blockStore.store.NewIteratorWithPrefix(blockHeightPrefix, encodeBlockHeight(from))
+	defer iter.Release()
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != len(blockHeightPrefix)+8 {
+			// not a height mapping record
+			continue
+		}
+		if binary.BigEndian.Uint64(key[len(blockHeightPrefix):]) > to {
+			break
+		}
+		goon, err := visit(common.BytesToHash(iter.Value()))
+		if err != nil {
+			return err
+		}
+		if !goon {
+			break
+		}
+	}
+	return iter.Error()
+}
@@ -0,0 +1,71 @@
+package blockstore
+
+import (
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/craft/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// mock block store with the chain of specified length
+func mockBlockStoreWithChain(t *testing.T, length int) (*BlockStore, []*types.Block) {
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(t, err)
+	blocks := []*types.Block{mockBlock()}
+	for i := 1; i < length; i++ {
+		blocks = append(blocks, mockChildBlock(blocks[i-1], common.HexToHash("0x01")))
+	}
+	for _, block := range blocks {
+		assert.Nil(t, blockStore.WriteBlock(block))
+	}
+	return blockStore, blocks
+}
+
+// test get blocks by range
+func TestBlockStore_GetBlocksByRange(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, blocks := mockBlockStoreWithChain(t, 5)
+	blockStore.Put([]byte("hello"), []byte("world"))
+
+	hashes := make([]types.Hash, 0)
+	err := blockStore.GetBlocksByRange(2, 4, 0, func(block *types.Block) bool {
+		hashes = append(hashes, block.HeaderHash)
+		return true
+	})
+	assert.Nil(err)
+	assert.Equal([]types.Hash{blocks[1].HeaderHash, blocks[2].HeaderHash, blocks[3].HeaderHash}, hashes)
+
+	// stop by callback
+	hashes = hashes[:0]
+	err = blockStore.GetBlocksByRange(1, 5, 0, func(block *types.Block) bool {
+		hashes = append(hashes, block.HeaderHash)
+		return len(hashes) < 2
+	})
+	assert.Nil(err)
+	assert.Equal(2, len(hashes))
+
+	// stop by max bytes
+	hashes = hashes[:0]
+	err = blockStore.GetBlocksByRange(1, 5, 1, func(block *types.Block) bool {
+		hashes = append(hashes, block.HeaderHash)
+		return true
+	})
+	assert.Nil(err)
+	assert.Equal(1, len(hashes))
+
+	assert.NotNil(blockStore.GetBlocksByRange(3, 2, 0, func(block *types.Block) bool { return true }))
+}
+
+// test get headers by range
+func TestBlockStore_GetHeadersByRange(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, _ := mockBlockStoreWithChain(t, 5)
+
+	heights := make([]uint64, 0)
+	err := blockStore.GetHeadersByRange(4, 10, 0, func(header *types.Header) bool {
+		heights = append(heights, header.Height)
+		return true
+	})
+	assert.Nil(err)
+	assert.Equal([]uint64{4, 5}, heights)
+}
@@ -3,18 +3,25 @@ package blockstore
 import (
 	"bytes"
 	"encoding/binary"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/DSiSc/blockstore/cache"
+	"github.com/DSiSc/blockstore/codec"
 	"github.com/DSiSc/blockstore/common"
 	"github.com/DSiSc/blockstore/config"
 	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/blockstore/dbstore/compressedstore"
+	"github.com/DSiSc/blockstore/dbstore/encryptedstore"
 	"github.com/DSiSc/blockstore/dbstore/leveldbstore"
 	"github.com/DSiSc/blockstore/dbstore/memorystore"
+	"github.com/DSiSc/blockstore/dbstore/meteredstore"
+	"github.com/DSiSc/blockstore/freezer"
 	"github.com/DSiSc/blockstore/indexes"
 	"github.com/DSiSc/craft/log"
 	"github.com/DSiSc/craft/types"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const (
@@ -26,36 +33,211 @@ const (
 	INIT_BLOCK_HEIGHT = 0
 	// latestBlockKey tracks the latest know full block's hash.
 	latestBlockKey = "LatestBlock"
+	// schemaVersionKey tracks the schema version of the database.
+	schemaVersionKey = "SchemaVersion"
+	// codecKey tracks the codec used to encode the entities in database.
+	codecKey = "EntityCodec"
+	// current database schema version
+	SCHEMA_VERSION = 2
 )
 
 // The fields below define the low level database schema prefixing.
 var (
-	blockPrefix       = []byte("b")
-	blockHeightPrefix = []byte("h")
-	txPrefix          = []byte("t")
-	receiptPrefix     = []byte("r")
+	blockPrefix        = []byte("b") // legacy whole block record, replaced by header and body since schema version 2
+	headerPrefix       = []byte("H")
+	bodyPrefix         = []byte("B")
+	headerHeightPrefix = []byte("n")
+	blockHeightPrefix  = []byte("h")
+	txPrefix           = []byte("t")
+	receiptPrefix      = []byte("r")
 )
 
+// BlockBody is the transactions of a block, which is stored separately from the block header.
+type BlockBody struct {
+	Transactions []*types.Transaction
+}
+
+// ToRLP implement codec.RLPConverter, the body is encoded as its transactions by rlp codec.
+func (body *BlockBody) ToRLP() interface{} {
+	return body.Transactions
+}
+
+// FromRLP implement codec.RLPConverter.
+func (body *BlockBody) FromRLP(decode func(value interface{}) error) error {
+	return decode(&body.Transactions)
+}
+
 // Block store save the data of block & transaction
 type BlockStore struct {
+	horizon      uint64          // Prune horizon, accessed atomically so keep it first for 64-bit alignment
 	store        dbstore.DBStore // Block store handler
-	currentBlock atomic.Value    //Current block
-	lock         sync.RWMutex
+	codec        codec.Codec     // Entity codec
+	freezerCodec codec.Codec     // Entity codec of the frozen items
+	headersOnly  bool            // Only store block headers
+	addressIndex bool            // Index transactions by address
+	// section size and the first indexed section start height of section bloom index
+	bloomSectionSize  uint64
+	bloomSectionsFrom uint64
+	// caches of decoded blocks, receipts and tx lookup indexes, disabled if nil
+	blockCache       *cache.LRUCache
+	headerCache      *cache.LRUCache
+	receiptCache     *cache.LRUCache
+	txLookupCache    *cache.LRUCache
+	durability       string                // Durability of the committed blocks
+	strictValidation bool                  // Validate the written blocks strictly
+	pipeline         *writePipeline        // Write pipeline in async write mode
+	pruner           *backgroundTask       // Background pruner if retention is configured
+	freezer          *freezer.Freezer      // Freezer of the finalized blocks, disabled if nil
+	chainFreezer     *backgroundTask       // Background task moving finalized blocks to freezer
+	encryptionKeys   []*encryptedstore.Key // Keys of encryption at rest, disabled if empty
+	metrics          *storeMetrics         // Metrics of the operations, disabled if nil
+	readOnly         bool                  // The writes return dbstore.ErrReadOnly
+	currentBlock     atomic.Value          //Current block
+	lock             sync.RWMutex
+
+	// root functions of strict validation, common.TxRoot and common.ReceiptsRoot by default
+	txRoot       func(txs []*types.Transaction) types.Hash
+	receiptsRoot func(receipts []*types.Receipt) types.Hash
+	// the number of times the canonical chain is rewritten by reorg, rollback, reindex or repair, guarded by lock
+	rewrites uint64
 }
 
 // NewBlockStore return the block store instance
 func NewBlockStore(config *config.BlockStoreConfig) (*BlockStore, error) {
 	log.Info("Start creating block store, with config: %v ", config)
-	store, err := createDBStore(config)
+	switch config.Durability {
+	case "", DURABILITY_SYNC, DURABILITY_NOSYNC:
+	case DURABILITY_GROUP:
+		if !config.AsyncWrite {
+			return nil, fmt.Errorf("durability %s is only supported in async write mode", config.Durability)
+		}
+	default:
+		return nil, fmt.Errorf("Not support durability %s", config.Durability)
+	}
+	if config.FreezerPath != "" && (config.EncryptionKey != "" || config.EncryptionKeyFile != "") {
+		return nil, fmt.Errorf("freezer doesn't support encryption, the frozen blocks would be stored in plaintext")
+	}
+	rawStore, err := createDBStore(config)
+	if err != nil {
+		return nil, err
+	}
+	var storeMetrics *storeMetrics
+	if config.Metrics || config.MetricsAddress != "" {
+		storeMetrics = newStoreMetrics()
+		if levelDBStore, ok := rawStore.(*leveldbstore.LevelDBStore); ok {
+			levelDBStore.RegisterMetrics(storeMetrics.registry)
+		}
+		rawStore = meteredstore.NewMeteredStore(rawStore, storeMetrics.registry, keyPrefix)
+	}
+	encryptionKeys, err := encryptedstore.LoadKeys(config.EncryptionKey, config.EncryptionKeyFile)
+	if err != nil {
+		rawStore.Close()
+		return nil, err
+	}
+	store, err := wrapDBStore(rawStore, config, encryptionKeys)
+	if err != nil {
+		rawStore.Close()
+		return nil, err
+	}
+	entityCodec, err := loadCodec(store, config)
 	if err != nil {
+		store.Close()
 		return nil, err
 	}
 	blockStore := &BlockStore{
-		store: store,
+		store:            store,
+		codec:            entityCodec,
+		headersOnly:      config.HeadersOnly,
+		addressIndex:     config.AddressIndex,
+		blockCache:       cache.NewLRUCache(config.BlockCacheSize),
+		headerCache:      cache.NewLRUCache(config.HeaderCacheSize),
+		receiptCache:     cache.NewLRUCache(config.ReceiptCacheSize),
+		txLookupCache:    cache.NewLRUCache(config.TxLookupCacheSize),
+		durability:       config.Durability,
+		strictValidation: config.StrictValidation,
+		encryptionKeys:   encryptionKeys,
+		metrics:          storeMetrics,
+		readOnly:         config.ReadOnly,
+		txRoot:           common.TxRoot,
+		receiptsRoot:     common.ReceiptsRoot,
+	}
+	if config.TxRootFunc != nil {
+		blockStore.txRoot = config.TxRootFunc
+	}
+	if config.ReceiptsRootFunc != nil {
+		blockStore.receiptsRoot = config.ReceiptsRootFunc
+	}
+	// close the database, the freezer and the started tasks if the block store fails to open
+	defer func() {
+		if err != nil {
+			blockStore.Close()
+		}
+	}()
+
+	if config.FreezerPath != "" {
+		blockStore.freezer, err = freezer.NewFreezer(config.FreezerPath, config.ReadOnly)
+		if err != nil {
+			return nil, err
+		}
+		err = blockStore.loadFreezerCodec()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	//load latest block from database.
 	blockStore.loadLatestBlock()
+	err = blockStore.loadBloomSectionIndex(config.BloomSectionSize)
+	if err != nil {
+		return nil, err
+	}
+	err = blockStore.loadPruneHorizon()
+	if err != nil {
+		return nil, err
+	}
+	if from, next, ok := blockStore.unfinishedReindex(); ok {
+		// the indexes above next height are missing, finish the reindex before serving
+		if config.ReadOnly {
+			err = fmt.Errorf("database has an unfinished reindex from height %d, please open it writable to finish the reindex", from)
+			return nil, err
+		}
+		log.Warn("Database has an unfinished reindex from height %d, resume it at height %d", from, next)
+		err = blockStore.ReindexFrom(from)
+		if err != nil {
+			err = fmt.Errorf("failed to finish the reindex from height %d, as: %w", from, err)
+			return nil, err
+		}
+	}
+	if config.ReadOnly {
+		// no background task writes the read-only database
+		log.Info("Block store is opened in read-only mode")
+	} else if config.AsyncWrite {
+		blockStore.pipeline = newWritePipeline(blockStore, config.WriteQueueSize, config.Durability, time.Duration(config.GroupCommitInterval)*time.Millisecond)
+	}
+	if blockStore.freezer != nil && !config.ReadOnly {
+		finality := config.FreezerFinality
+		if finality == 0 {
+			finality = DEFAULT_FREEZER_FINALITY
+		}
+		blockStore.chainFreezer = newBackgroundTask(func(quit <-chan struct{}) {
+			blockStore.freeze(finality, quit)
+		})
+	}
+	if config.PruneRetention > 0 && !config.HeadersOnly && !config.ReadOnly {
+		retention := config.PruneRetention
+		blockStore.pruner = newBackgroundTask(func(quit <-chan struct{}) {
+			blockStore.prune(retention, quit)
+		})
+	}
+	if storeMetrics != nil {
+		blockStore.registerMetrics()
+	}
+	if config.MetricsAddress != "" {
+		err = storeMetrics.serve(config.MetricsAddress)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return blockStore, nil
 }
 
@@ -64,6 +246,9 @@ func createDBStore(config *config.BlockStoreConfig) (dbstore.DBStore, error) {
 	switch config.PluginName {
 	case PLUGIN_LEVELDB:
 		log.Debug("Create file-based block store, with file path: %s ", config.DataPath)
+		if config.ReadOnly {
+			return leveldbstore.NewReadOnlyLevelDBStore(config.DataPath)
+		}
 		return leveldbstore.NewLevelDBStore(config.DataPath)
 	case PLUGIN_MEMDB:
 		log.Debug("Create memory-based block store")
@@ -74,6 +259,94 @@ func createDBStore(config *config.BlockStoreConfig) (dbstore.DBStore, error) {
 	}
 }
 
+// wrapDBStore wrap the database with encryption if keys are supplied, then with compression. The values are
+// compressed before encrypted, as the encrypted values are incompressible. The values of a formatted database
+// are always read through compressed store, so the compressed and raw values coexist. A new database is
+// formatted at once, the database written before compression is supported is not wrapped until migrated.
+func wrapDBStore(store dbstore.DBStore, config *config.BlockStoreConfig, encryptionKeys []*encryptedstore.Key) (dbstore.DBStore, error) {
+	// check before the encrypted store seals the empty database
+	empty, err := compressedstore.Empty(store)
+	if err != nil {
+		return nil, err
+	}
+	if len(encryptionKeys) > 0 {
+		encryptedStore, err := encryptedstore.NewEncryptedStore(store, encryptionKeys)
+		if err != nil {
+			return nil, err
+		}
+		store = encryptedStore
+	}
+	formatted, err := compressedstore.Formatted(store)
+	if err != nil {
+		return nil, err
+	}
+	if !formatted && empty && !config.ReadOnly {
+		_, err = compressedstore.Format(store)
+		if err != nil {
+			return nil, err
+		}
+		formatted = true
+	}
+	if !formatted {
+		if config.Compression != "" && config.Compression != compressedstore.NONE {
+			return nil, fmt.Errorf("database is written before compression is supported, please migrate it before enabling compression")
+		}
+		return store, nil
+	}
+	return compressedstore.NewCompressedStore(store, config.Compression, config.CompressionThreshold)
+}
+
+// load the entity codec recorded in database. A new database will record the schema version and
+// the configured codec, the database created before codec is configurable will be treated as json.
+// Nothing is recorded in read-only mode.
+func loadCodec(store dbstore.DBStore, config *config.BlockStoreConfig) (codec.Codec, error) {
+	if _, err := store.Get([]byte(migrationCheckpointKey)); err == nil {
+		log.Error("Database has an unfinished migration, please finish it before opening")
+		return nil, fmt.Errorf("database has an unfinished migration")
+	}
+	codecByte, err := store.Get([]byte(codecKey))
+	if err == nil {
+		if config.Codec != "" && config.Codec != string(codecByte) {
+			log.Warn("Database is encoded by %s, the configured codec %s will be ignored", codecByte, config.Codec)
+		}
+		return codec.NewCodec(string(codecByte))
+	}
+	if !errors.Is(err, dbstore.ErrNotFound) {
+		// such as the database encrypted by other keys
+		log.Error("Failed to load the codec record of database, as: %v", err)
+		return nil, fmt.Errorf("failed to load the codec record of database, as: %w", err)
+	}
+
+	codecName := config.Codec
+	if codecName == "" {
+		codecName = codec.JSON
+	}
+	var schemaVersion uint64 = SCHEMA_VERSION
+	if _, err := store.Get([]byte(latestBlockKey)); err == nil {
+		log.Info("Database has no codec record, treat it as %s encoded with schema version 1", codec.JSON)
+		codecName = codec.JSON
+		schemaVersion = 1
+	}
+	entityCodec, err := codec.NewCodec(codecName)
+	if err != nil {
+		log.Error("Failed to create codec %s, as: %v", codecName, err)
+		return nil, err
+	}
+	if config.ReadOnly {
+		return entityCodec, nil
+	}
+
+	batch := store.NewBatch()
+	batch.Put([]byte(schemaVersionKey), encodeSchemaVersion(schemaVersion))
+	batch.Put([]byte(codecKey), []byte(entityCodec.Name()))
+	err = batch.Write()
+	if err != nil {
+		log.Error("Failed to record database schema, as: %v", err)
+		return nil, fmt.Errorf("failed to record database schema, as: %v", err)
+	}
+	return entityCodec, nil
+}
+
 // load latest block from database.
 func (blockStore *BlockStore) loadLatestBlock() {
 	log.Info("Start loading block from database")
@@ -85,7 +358,7 @@ func (blockStore *BlockStore) loadLatestBlock() {
 
 	// load latest block by hash
 	blockHash := common.BytesToHash(blockHashByte)
-	latestBlock, err := blockStore.GetBlockByHash(blockHash)
+	latestBlock, err := blockStore.loadBlock(blockHash)
 	if err != nil {
 		log.Warn("Failed to load the latest block with the hash of the record in the database, we will set current block to nil")
 		return
@@ -94,52 +367,176 @@ func (blockStore *BlockStore) loadLatestBlock() {
 }
 
 // WriteBlock write the block to database. return error if write failed.
-func (blockStore *BlockStore) WriteBlock(block *types.Block) error {
-	batch := blockStore.store.NewBatch()
-	err := blockStore.writeBlockByBatch(batch, block)
+func (blockStore *BlockStore) WriteBlock(block *types.Block) (err error) {
+	defer blockStore.metrics.observe(opWriteBlock, time.Now(), &err)
+	return blockStore.writeBlock(&blockWrite{block: block})
+}
+
+// writeBlock write the block with or without receipts. Block that doesn't extend the current block is only
+// stored as side chain block, it will not be indexed until it becomes canonical by Reorg. The block is queued
+// to the write pipeline in async write mode, otherwise it is committed before returning.
+func (blockStore *BlockStore) writeBlock(write *blockWrite) error {
+	if blockStore.readOnly {
+		return dbstore.ErrReadOnly
+	}
+	blockStore.lock.Lock()
+	defer blockStore.lock.Unlock()
+	// the queued and cached block must not be changed by the caller after writing
+	write.block = copyBlock(write.block)
+	write.receipts = copyReceipts(write.receipts)
+
+	log.Info("Start writing block %x to database.", write.block.HeaderHash)
+	blockHash := common.HeaderHash(write.block)
+	if !bytes.Equal(blockHash[:], write.block.HeaderHash[:]) {
+		log.Error("Invalid block, as block's hash %x is not same to expected %x ", blockHash, write.block.HeaderHash)
+		return fmt.Errorf("Invalid block, as block's hash %x is not same to expected %x ", blockHash, write.block.HeaderHash)
+	}
+	err := blockStore.checkBlock(write)
 	if err != nil {
-		batch.Reset()
 		return err
 	}
-	err = batch.Write()
+	write.canonical = blockStore.extendsCurrentBlock(write.block)
+	if !write.canonical {
+		log.Info("Block %x doesn't extend current block, store it as side chain block.", blockHash)
+	}
+
+	if blockStore.pipeline != nil {
+		return blockStore.pipeline.enqueue(write)
+	}
+	err = blockStore.prepareBlockWrite(write)
+	if err != nil {
+		return err
+	}
+	err = blockStore.commitBlockWrite(write, blockStore.durability == DURABILITY_SYNC)
 	if err != nil {
-		log.Error("failed to commit block %x to database, as: %v", block.HeaderHash, err)
 		return err
 	}
 
 	// update current block
-	blockStore.recordCurrentBlock(block)
+	if write.canonical {
+		blockStore.recordCurrentBlock(write.block)
+	}
 	return nil
 }
 
-// WriteBlock write the block to database. return error if write failed.
-func (blockStore *BlockStore) writeBlockByBatch(batch dbstore.Batch, block *types.Block) error {
-	// write block
-	log.Info("Start writing block %x to database.", block.HeaderHash)
-	blockByte, err := encodeEntity(block)
+// prepareBlockWrite encode the block and receipts to a new batch, the records written here don't depend on
+// the canonical chain, so the blocks can be prepared in parallel.
+func (blockStore *BlockStore) prepareBlockWrite(write *blockWrite) error {
+	batch := blockStore.store.NewBatch()
+	err := blockStore.writeHeaderAndBody(batch, write.block.HeaderHash, write.block)
+	if err != nil {
+		return err
+	}
+	if write.withReceipts && !blockStore.headersOnly {
+		receiptsByte, err := blockStore.encodeEntity(write.receipts)
+		if err != nil {
+			log.Error("Failed to encode receipts %v to byte, as: %v ", write.receipts, err)
+			return fmt.Errorf("Failed to encode receipts %v to byte, as: %v ", write.receipts, err)
+		}
+		batch.Put(append(receiptPrefix, common.HashToBytes(write.block.HeaderHash)...), receiptsByte)
+		write.bloom = blockStore.writeBlockBloom(batch, write.block.HeaderHash, write.receipts)
+	}
+	write.txHashes = make([]types.Hash, len(write.block.Transactions))
+	for i, tx := range write.block.Transactions {
+		write.txHashes[i] = common.TxHash(tx)
+	}
+	write.batch = batch
+	return nil
+}
+
+// commitBlockWrite write the canonical indexes of canonical block to the prepared batch, then commit it.
+// The blocks must be committed in write order, as the section blooms are merged with the committed ones.
+func (blockStore *BlockStore) commitBlockWrite(write *blockWrite, sync bool) error {
+	batch := write.batch
+	blockHash := write.block.HeaderHash
+	if write.canonical {
+		// write canonical indexes
+		var receipts []*types.Receipt
+		if write.withReceipts {
+			receipts = write.receipts
+		}
+		err := blockStore.writeCanonicalIndexes(batch, blockHash, write.block, receipts)
+		if err != nil {
+			batch.Reset()
+			return err
+		}
+		if write.withReceipts && !blockStore.headersOnly {
+			blockStore.mergeSectionBlooms(batch, map[uint64]types.Bloom{write.block.Header.Height: write.bloom})
+		}
+
+		// update latest block
+		err = batch.Put([]byte(latestBlockKey), common.HashToBytes(blockHash))
+		if err != nil {
+			log.Warn("Failed to record latest block, as: %v. we will still use the previous latest block as current latest block ", err)
+		}
+	}
+
+	var err error
+	if sync {
+		err = batch.WriteSync()
+	} else {
+		err = batch.Write()
+	}
+	if err != nil {
+		log.Error("failed to commit block %x to database, as: %v", blockHash, err)
+		return err
+	}
+	blockStore.cacheWrittenBlock(write.block, write.receipts, write.canonical)
+	if write.canonical {
+		blockStore.pruner.notify()
+		blockStore.chainFreezer.notify()
+	}
+	return nil
+}
+
+// writeHeaderAndBody write the block header, header hash to height mapping and block body to batch.
+// Block body will not be written if the store only stores block headers.
+func (blockStore *BlockStore) writeHeaderAndBody(batch dbstore.Batch, blockHash types.Hash, block *types.Block) error {
+	headerByte, err := blockStore.encodeEntity(block.Header)
 	if err != nil {
-		log.Error("Failed to encode block %v to byte, as: %v ", block, err)
-		return fmt.Errorf("Failed to encode block %v to byte, as: %v ", block, err)
+		log.Error("Failed to encode block header %v to byte, as: %v ", block.Header, err)
+		return fmt.Errorf("Failed to encode block header %v to byte, as: %v ", block.Header, err)
+	}
+	err = batch.Put(append(headerPrefix, common.HashToBytes(blockHash)...), headerByte)
+	if err != nil {
+		log.Error("Failed to write block header %x to database, as: %v ", blockHash, err)
+		return fmt.Errorf("Failed to write block header %x to database, as: %v ", blockHash, err)
+	}
+	err = batch.Put(append(headerHeightPrefix, common.HashToBytes(blockHash)...), encodeBlockHeight(block.Header.Height))
+	if err != nil {
+		log.Error("Failed to record the mapping between block header and height")
+		return fmt.Errorf("Failed to record the mapping between block header and height ")
+	}
+	if blockStore.headersOnly {
+		return nil
 	}
 
-	blockHash := common.HeaderHash(block)
-	if !bytes.Equal(blockHash[:], block.HeaderHash[:]) {
-		log.Error("Invalid block, as block's hash %x is not same to expected %x ", blockHash, block.HeaderHash)
-		return fmt.Errorf("Invalid block, as block's hash %x is not same to expected %x ", blockHash, block.HeaderHash)
+	bodyByte, err := blockStore.encodeEntity(&BlockBody{Transactions: block.Transactions})
+	if err != nil {
+		log.Error("Failed to encode block body %x to byte, as: %v ", blockHash, err)
+		return fmt.Errorf("Failed to encode block body %x to byte, as: %v ", blockHash, err)
 	}
-	err = batch.Put(append(blockPrefix, common.HashToBytes(blockHash)...), blockByte)
+	err = batch.Put(append(bodyPrefix, common.HashToBytes(blockHash)...), bodyByte)
 	if err != nil {
-		log.Error("Failed to write block %x to database, as: %v ", blockHash, err)
-		return fmt.Errorf("Failed to write block %x to database, as: %v ", blockHash, err)
+		log.Error("Failed to write block body %x to database, as: %v ", blockHash, err)
+		return fmt.Errorf("Failed to write block body %x to database, as: %v ", blockHash, err)
 	}
+	return nil
+}
 
+// writeCanonicalIndexes write the height mapping, tx lookup index and address index of a canonical block.
+func (blockStore *BlockStore) writeCanonicalIndexes(batch dbstore.Batch, blockHash types.Hash, block *types.Block, receipts []*types.Receipt) error {
 	// write block height and hash mapping
-	err = batch.Put(append(blockHeightPrefix, encodeBlockHeight(block.Header.Height)...), common.HashToBytes(blockHash))
+	err := batch.Put(append(blockHeightPrefix, encodeBlockHeight(block.Header.Height)...), common.HashToBytes(blockHash))
 	if err != nil {
 		log.Error("Failed to record the mapping between block and height")
 		return fmt.Errorf("Failed to record the mapping between block and height ")
 	}
 
+	if blockStore.headersOnly {
+		return nil
+	}
+
 	// write tx lookup index
 	err = blockStore.writeTxLookUpIndex(batch, blockHash, block.Header.Height, block.Transactions)
 	if err != nil {
@@ -147,64 +544,451 @@ func (blockStore *BlockStore) writeBlockByBatch(batch dbstore.Batch, block *type
 		return fmt.Errorf("Failed to record the tx lookup index from block %x ", blockHash)
 	}
 
-	// update latest block
-	err = batch.Put([]byte(latestBlockKey), common.HashToBytes(blockHash))
+	// write address index
+	if blockStore.addressIndex {
+		err = blockStore.writeAddressIndex(batch, blockHash, block, receipts)
+		if err != nil {
+			log.Error("Failed to record the address index from block %x", blockHash)
+			return fmt.Errorf("Failed to record the address index from block %x ", blockHash)
+		}
+	}
+	return nil
+}
+
+// deleteCanonicalIndexes delete the height mapping, tx lookup index and address index of a canonical block.
+func (blockStore *BlockStore) deleteCanonicalIndexes(batch dbstore.Batch, blockHash types.Hash, block *types.Block) error {
+	for _, tx := range block.Transactions {
+		err := batch.Delete(append(txPrefix, common.HashToBytes(common.TxHash(tx))...))
+		if err != nil {
+			return fmt.Errorf("failed to delete tx lookup index of block %x, as: %v", blockHash, err)
+		}
+	}
+	if blockStore.addressIndex {
+		// the block written without receipts has no receipt address entries
+		receipts, _ := blockStore.GetReceiptByBlockHash(blockHash)
+		err := blockStore.deleteAddressIndex(batch, block, receipts)
+		if err != nil {
+			return fmt.Errorf("failed to delete address index of block %x, as: %v", blockHash, err)
+		}
+	}
+	err := batch.Delete(append(blockHeightPrefix, encodeBlockHeight(block.Header.Height)...))
 	if err != nil {
-		log.Warn("Failed to record latest block, as: %v. we will still use the previous latest block as current latest block ", err)
+		return fmt.Errorf("failed to delete height mapping of block %x, as: %v", blockHash, err)
 	}
 	return nil
 }
 
+// deleteBlockRecords delete the header, body, receipts, bloom and height mapping records of a block.
+func deleteBlockRecords(batch dbstore.Batch, blockHash types.Hash) error {
+	for _, prefix := range [][]byte{receiptPrefix, blockBloomPrefix, blockPrefix, headerPrefix, bodyPrefix, headerHeightPrefix} {
+		err := batch.Delete(append(append([]byte{}, prefix...), common.HashToBytes(blockHash)...))
+		if err != nil {
+			return fmt.Errorf("failed to delete block %x, as: %v", blockHash, err)
+		}
+	}
+	return nil
+}
+
+// extendsCurrentBlock check whether the block is the child of current block.
+func (blockStore *BlockStore) extendsCurrentBlock(block *types.Block) bool {
+	currentBlock := blockStore.GetCurrentBlock()
+	if currentBlock == nil {
+		return true
+	}
+	return currentBlock.HeaderHash == block.Header.PrevBlockHash
+}
+
 // WriteBlock write the block and relative receipts to database. return error if write failed.
-func (blockStore *BlockStore) WriteBlockWithReceipts(block *types.Block, receipts []*types.Receipt) error {
+func (blockStore *BlockStore) WriteBlockWithReceipts(block *types.Block, receipts []*types.Receipt) (err error) {
+	defer blockStore.metrics.observe(opWriteBlockWithReceipts, time.Now(), &err)
+	return blockStore.writeBlock(&blockWrite{block: block, receipts: receipts, withReceipts: true})
+}
+
+// Reorg switch the canonical chain to the chain ending with the specified block. The height mapping
+// and tx lookup index are rewritten from the common ancestor forward in one batch.
+func (blockStore *BlockStore) Reorg(newHeadHash types.Hash) (err error) {
+	defer blockStore.metrics.observe(opReorg, time.Now(), &err)
+	if blockStore.readOnly {
+		return dbstore.ErrReadOnly
+	}
+	blockStore.lock.Lock()
+	defer blockStore.lock.Unlock()
+	err = blockStore.pipeline.flush()
+	if err != nil {
+		return err
+	}
+
+	newHead, err := blockStore.loadBlock(newHeadHash)
+	if err != nil {
+		log.Error("Failed to get new head block %x, as: %v", newHeadHash, err)
+		return fmt.Errorf("failed to get new head block %x, as: %v", newHeadHash, err)
+	}
+
+	// collect the new chain blocks from the new head back to the common ancestor.
+	newChain := make([]*types.Block, 0)
+	ancestor := newHead
+	for {
+		canonicalHash, err := blockStore.getCanonicalHash(ancestor.Header.Height)
+		if err == nil && canonicalHash == ancestor.HeaderHash {
+			break
+		}
+		newChain = append(newChain, ancestor)
+		ancestor, err = blockStore.loadBlock(ancestor.Header.PrevBlockHash)
+		if err != nil {
+			log.Error("Failed to find the common ancestor of block %x and current chain, as: %v", newHeadHash, err)
+			return fmt.Errorf("failed to find the common ancestor of block %x and current chain, as: %v", newHeadHash, err)
+		}
+	}
+	if err := blockStore.checkFrozen(ancestor.Header.Height + 1); err != nil {
+		return fmt.Errorf("can not reorganize chain to block %x, as: %v", newHeadHash, err)
+	}
+	log.Info("Start reorganizing chain to block %x, common ancestor is %x", newHeadHash, ancestor.HeaderHash)
+
 	batch := blockStore.store.NewBatch()
-	receiptsByte, err := encodeEntity(receipts)
+	// remove the indexes of the blocks above the common ancestor
+	for height := ancestor.Header.Height + 1; height <= blockStore.GetCurrentBlockHeight(); height++ {
+		oldBlockHash, err := blockStore.getCanonicalHash(height)
+		if err != nil {
+			batch.Reset()
+			return err
+		}
+		oldBlock, err := blockStore.loadBlock(oldBlockHash)
+		if err != nil {
+			batch.Reset()
+			return fmt.Errorf("failed to get canonical block with height %d, as: %v", height, err)
+		}
+		err = blockStore.deleteCanonicalIndexes(batch, oldBlockHash, oldBlock)
+		if err != nil {
+			batch.Reset()
+			return err
+		}
+	}
+
+	// write the indexes of the new chain
+	blooms := make(map[uint64]types.Bloom)
+	for i := len(newChain) - 1; i >= 0; i-- {
+		if bloom, err := blockStore.getBlockBloom(newChain[i].HeaderHash); err == nil {
+			blooms[newChain[i].Header.Height] = bloom
+		}
+		var receipts []*types.Receipt
+		if blockStore.addressIndex {
+			receipts, err = blockStore.GetReceiptByBlockHash(newChain[i].HeaderHash)
+			if err != nil && !errors.Is(err, dbstore.ErrNotFound) {
+				batch.Reset()
+				return err
+			}
+		}
+		err = blockStore.writeCanonicalIndexes(batch, newChain[i].HeaderHash, newChain[i], receipts)
+		if err != nil {
+			batch.Reset()
+			return err
+		}
+	}
+	blockStore.mergeSectionBlooms(batch, blooms)
+	err = batch.Put([]byte(latestBlockKey), common.HashToBytes(newHeadHash))
+	if err != nil {
+		batch.Reset()
+		return fmt.Errorf("failed to record latest block, as: %v", err)
+	}
+	err = batch.Write()
+	if err != nil {
+		log.Error("failed to commit reorg to block %x to database, as: %v", newHeadHash, err)
+		return err
+	}
+	blockStore.rewrites++
+	blockStore.purgeCaches(false)
+
+	// update current block
+	blockStore.recordCurrentBlock(newHead)
+	return nil
+}
+
+// Rollback remove all the blocks above the specified height, include the side chain blocks, the block body,
+// height mapping, tx lookup index and receipts, then set the block with specified height as current block.
+func (blockStore *BlockStore) Rollback(toHeight uint64) (err error) {
+	defer blockStore.metrics.observe(opRollback, time.Now(), &err)
+	if blockStore.readOnly {
+		return dbstore.ErrReadOnly
+	}
+	blockStore.lock.Lock()
+	defer blockStore.lock.Unlock()
+	err = blockStore.pipeline.flush()
+	if err != nil {
+		return err
+	}
+
+	currentHeight := blockStore.GetCurrentBlockHeight()
+	if toHeight > currentHeight {
+		return fmt.Errorf("can not rollback to height %d, as current block height is %d", toHeight, currentHeight)
+	}
+	if err := blockStore.checkFrozen(toHeight + 1); err != nil {
+		return fmt.Errorf("can not rollback to height %d, as: %v", toHeight, err)
+	}
+	newHeadHash, err := blockStore.getCanonicalHash(toHeight)
 	if err != nil {
-		log.Error("Failed to encode receipts %v to byte, as: %v ", receipts, err)
-		return fmt.Errorf("Failed to encode receipts %v to byte, as: %v ", receipts, err)
+		log.Error("Failed to get block with height %d, as: %v", toHeight, err)
+		return err
 	}
-	blockHash := common.HeaderHash(block)
-	batch.Put(append(receiptPrefix, common.HashToBytes(blockHash)...), receiptsByte)
-	blockStore.writeBlockByBatch(batch, block)
+	newHead, err := blockStore.loadBlock(newHeadHash)
+	if err != nil {
+		log.Error("Failed to get block with height %d, as: %v", toHeight, err)
+		return err
+	}
+	log.Info("Start rolling back block store from height %d to %d", currentHeight, toHeight)
+
+	batch := blockStore.store.NewBatch()
+	for height := toHeight + 1; height <= currentHeight; height++ {
+		blockHash, err := blockStore.getCanonicalHash(height)
+		if err != nil {
+			batch.Reset()
+			return err
+		}
+		block, err := blockStore.loadBlock(blockHash)
+		if err != nil {
+			batch.Reset()
+			return fmt.Errorf("failed to get block with height %d, as: %v", height, err)
+		}
+		err = blockStore.deleteCanonicalIndexes(batch, blockHash, block)
+		if err == nil {
+			err = deleteBlockRecords(batch, blockHash)
+		}
+		if err != nil {
+			batch.Reset()
+			return err
+		}
+	}
+	err = blockStore.deleteSideBlocks(batch, toHeight)
 	if err != nil {
 		batch.Reset()
 		return err
 	}
+	err = batch.Put([]byte(latestBlockKey), common.HashToBytes(newHead.HeaderHash))
+	if err != nil {
+		batch.Reset()
+		return fmt.Errorf("failed to record latest block, as: %v", err)
+	}
 	err = batch.Write()
 	if err != nil {
-		log.Error("failed to commit block %x to database, as: %v", block.HeaderHash, err)
+		log.Error("failed to commit rollback to height %d to database, as: %v", toHeight, err)
 		return err
 	}
+	blockStore.rewrites++
+	blockStore.purgeCaches(true)
 
 	// update current block
-	blockStore.recordCurrentBlock(block)
+	blockStore.recordCurrentBlock(newHead)
+	return nil
+}
+
+// deleteSideBlocks delete the records of the side chain blocks above the height, the canonical blocks above the
+// height have been deleted from batch by caller.
+func (blockStore *BlockStore) deleteSideBlocks(batch dbstore.Batch, height uint64) error {
+	iter := blockStore.store.NewIteratorWithPrefix(headerHeightPrefix, nil)
+	defer iter.Release()
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != len(headerHeightPrefix)+common.HashLength || len(iter.Value()) != 8 || binary.BigEndian.Uint64(iter.Value()) <= height {
+			continue
+		}
+		err := deleteBlockRecords(batch, common.BytesToHash(key[len(headerHeightPrefix):]))
+		if err != nil {
+			return err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return fmt.Errorf("failed to iterate block header records, as: %v", err)
+	}
 	return nil
 }
 
 // GetBlockByHash get block by block hash.
-func (blockStore *BlockStore) GetBlockByHash(hash types.Hash) (*types.Block, error) {
-	blockByte, err := blockStore.store.Get(append(blockPrefix, common.HashToBytes(hash)...))
-	if blockByte == nil || err != nil {
-		return nil, fmt.Errorf("failed to get block with hash %x, as: %v", hash, err)
+func (blockStore *BlockStore) GetBlockByHash(hash types.Hash) (block *types.Block, err error) {
+	defer blockStore.metrics.observe(opGetBlockByHash, time.Now(), &err)
+	if write, ok := blockStore.pipeline.getBlock(hash); ok && !blockStore.headersOnly {
+		return copyBlock(write.block), nil
+	}
+	if block, ok := blockStore.blockCache.Get(hash); ok {
+		return copyBlock(block.(*types.Block)), nil
 	}
+	generation := blockStore.blockCache.Generation()
+	block, _, err = blockStore.getBlockWithSize(hash)
+	if err != nil {
+		return nil, err
+	}
+	if blockStore.blockCache.AddIfGeneration(generation, hash, block) {
+		return copyBlock(block), nil
+	}
+	return block, nil
+}
+
+// GetHeaderByHash get block header by block hash.
+func (blockStore *BlockStore) GetHeaderByHash(hash types.Hash) (header *types.Header, err error) {
+	defer blockStore.metrics.observe(opGetHeaderByHash, time.Now(), &err)
+	if write, ok := blockStore.pipeline.getBlock(hash); ok {
+		return copyHeader(write.block.Header), nil
+	}
+	if header, ok := blockStore.headerCache.Get(hash); ok {
+		return copyHeader(header.(*types.Header)), nil
+	}
+	generation := blockStore.headerCache.Generation()
+	header, _, err = blockStore.getHeaderWithSize(hash)
+	if err != nil {
+		return nil, err
+	}
+	if blockStore.headerCache.AddIfGeneration(generation, hash, header) {
+		return copyHeader(header), nil
+	}
+	return header, nil
+}
+
+// GetHeaderByHeight get block header by height.
+func (blockStore *BlockStore) GetHeaderByHeight(height uint64) (*types.Header, error) {
+	blockHash, err := blockStore.getCanonicalHash(height)
+	if err != nil {
+		return nil, err
+	}
+	return blockStore.GetHeaderByHash(blockHash)
+}
+
+// GetBodyByHash get block body by block hash.
+func (blockStore *BlockStore) GetBodyByHash(hash types.Hash) (*BlockBody, error) {
+	body, _, err := blockStore.getBodyWithSize(hash)
+	return body, err
+}
+
+// getBlockWithSize get block by block hash, along with the size of the block records.
+func (blockStore *BlockStore) getBlockWithSize(hash types.Hash) (*types.Block, int, error) {
+	var header types.Header
+	headerSize, err := blockStore.getEntity(headerPrefix, hash, &header)
+	if errors.Is(err, dbstore.ErrNotFound) {
+		return blockStore.getLegacyBlock(hash)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get block with hash %x, as: %w", hash, err)
+	}
+	body, bodySize, err := blockStore.getBodyWithSize(hash)
+	if err != nil {
+		return nil, 0, err
+	}
+	block := &types.Block{
+		Header:       &header,
+		Transactions: body.Transactions,
+		HeaderHash:   hash,
+	}
+	return block, headerSize + bodySize, nil
+}
+
+// getHeaderWithSize get block header by block hash, along with the size of the header record.
+func (blockStore *BlockStore) getHeaderWithSize(hash types.Hash) (*types.Header, int, error) {
+	var header types.Header
+	headerSize, err := blockStore.getEntity(headerPrefix, hash, &header)
+	if errors.Is(err, dbstore.ErrNotFound) {
+		block, blockSize, legacyErr := blockStore.getLegacyBlock(hash)
+		if errors.Is(legacyErr, dbstore.ErrNotFound) {
+			return nil, 0, fmt.Errorf("failed to get block header with hash %x, as: %w", hash, err)
+		}
+		if legacyErr != nil {
+			return nil, 0, legacyErr
+		}
+		return block.Header, blockSize, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get block header with hash %x, as: %w", hash, err)
+	}
+	return &header, headerSize, nil
+}
+
+// getBodyWithSize get block body by block hash, along with the size of the body record.
+func (blockStore *BlockStore) getBodyWithSize(hash types.Hash) (*BlockBody, int, error) {
+	var body BlockBody
+	bodySize, err := blockStore.getEntity(bodyPrefix, hash, &body)
+	if errors.Is(err, dbstore.ErrNotFound) {
+		block, blockSize, legacyErr := blockStore.getLegacyBlock(hash)
+		if errors.Is(legacyErr, dbstore.ErrNotFound) && blockStore.isPruned(hash) {
+			return nil, 0, fmt.Errorf("failed to get block body with hash %x, as: %w", hash, ErrPruned)
+		}
+		if errors.Is(legacyErr, dbstore.ErrNotFound) {
+			return nil, 0, fmt.Errorf("failed to get block body with hash %x, as: %w", hash, err)
+		}
+		if legacyErr != nil {
+			return nil, 0, legacyErr
+		}
+		return &BlockBody{Transactions: block.Transactions}, blockSize, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get block body with hash %x, as: %w", hash, err)
+	}
+	return &body, bodySize, nil
+}
+
+// getLegacyBlock get the whole block record written before schema version 2.
+func (blockStore *BlockStore) getLegacyBlock(hash types.Hash) (*types.Block, int, error) {
 	var block types.Block
-	err = decodeEntity(blockByte, &block)
+	blockSize, err := blockStore.getEntity(blockPrefix, hash, &block)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode block with hash %x from database as: %v", hash, err)
+		return nil, 0, fmt.Errorf("failed to get block with hash %x, as: %w", hash, err)
+	}
+	return &block, blockSize, nil
+}
+
+// getEntity read the entity with specified prefix and hash from freezer or database, return the size of the record.
+func (blockStore *BlockStore) getEntity(prefix []byte, hash types.Hash, entity interface{}) (int, error) {
+	entityCodec := blockStore.freezerCodec
+	entityByte, err := blockStore.getFrozen(prefix, hash)
+	if errors.Is(err, dbstore.ErrNotFound) {
+		entityCodec = blockStore.codec
+		entityByte, err = blockStore.store.Get(append(prefix, common.HashToBytes(hash)...))
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get record %s%x, as: %w", prefix, hash, err)
+	}
+	err = entityCodec.Decode(entityByte, entity)
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to decode record %s%x from database as: %v", dbstore.ErrCorrupted, prefix, hash, err)
+	}
+	return len(entityByte), nil
+}
+
+// loadBlock get the block by hash, the block only contains header if the store only stores block headers.
+func (blockStore *BlockStore) loadBlock(hash types.Hash) (*types.Block, error) {
+	if !blockStore.headersOnly {
+		return blockStore.GetBlockByHash(hash)
+	}
+	header, err := blockStore.GetHeaderByHash(hash)
+	if err != nil {
+		return nil, err
 	}
-	return &block, nil
+	return &types.Block{Header: header, HeaderHash: hash}, nil
 }
 
 // GetBlockByHeight get block by height.
-func (blockStore *BlockStore) GetBlockByHeight(height uint64) (*types.Block, error) {
-	blockHashByte, err := blockStore.store.Get(append(blockHeightPrefix, encodeBlockHeight(height)...))
+func (blockStore *BlockStore) GetBlockByHeight(height uint64) (block *types.Block, err error) {
+	defer blockStore.metrics.observe(opGetBlockByHeight, time.Now(), &err)
+	blockHash, err := blockStore.getCanonicalHash(height)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get block with height %d, as: %v", height, err)
+		return nil, err
 	}
-	blockHash := common.BytesToHash(blockHashByte)
 	return blockStore.GetBlockByHash(blockHash)
 }
 
+// getCanonicalHash get the hash of the canonical block with specified height.
+func (blockStore *BlockStore) getCanonicalHash(height uint64) (types.Hash, error) {
+	if write, ok := blockStore.pipeline.getCanonicalBlock(height); ok {
+		return write.block.HeaderHash, nil
+	}
+	if blockHash, err := blockStore.getFrozenHash(height); !errors.Is(err, dbstore.ErrNotFound) {
+		if err != nil {
+			return types.Hash{}, fmt.Errorf("failed to get frozen block with height %d, as: %w", height, err)
+		}
+		return blockHash, nil
+	}
+	blockHashByte, err := blockStore.store.Get(append(blockHeightPrefix, encodeBlockHeight(height)...))
+	if err != nil {
+		return types.Hash{}, fmt.Errorf("failed to get block with height %d, as: %w", height, err)
+	}
+	return common.BytesToHash(blockHashByte), nil
+}
+
 // GetCurrentBlock get current block.
 func (blockStore *BlockStore) GetCurrentBlock() *types.Block {
 	currentBlock := blockStore.currentBlock.Load()
@@ -226,12 +1010,13 @@ func (blockStore *BlockStore) GetCurrentBlockHeight() uint64 {
 }
 
 // GetTransactionByHash get transaction by hash
-func (blockStore *BlockStore) GetTransactionByHash(hash types.Hash) (*types.Transaction, types.Hash, uint64, uint64, error) {
+func (blockStore *BlockStore) GetTransactionByHash(hash types.Hash) (tx *types.Transaction, blockHash types.Hash, height uint64, index uint64, err error) {
+	defer blockStore.metrics.observe(opGetTransactionByHash, time.Now(), &err)
 	// read tx look up indexs
 	txLookupIntex, err := blockStore.getEntityLookUpIndex(hash)
 	if err != nil {
-		log.Error("failed to decode tx lookup index with hash %x from database as: %v", hash, err)
-		return nil, types.Hash{}, 0, 0, fmt.Errorf("failed to decode tx lookup index with hash %x from database as: %v", hash, err)
+		log.Error("failed to get tx lookup index with hash %x from database as: %v", hash, err)
+		return nil, types.Hash{}, 0, 0, err
 	}
 
 	// read block include this tx
@@ -239,49 +1024,82 @@ func (blockStore *BlockStore) GetTransactionByHash(hash types.Hash) (*types.Tran
 	if err != nil {
 		return nil, types.Hash{}, 0, 0, err
 	}
+	if txLookupIntex.Index >= uint64(len(block.Transactions)) {
+		return nil, types.Hash{}, 0, 0, fmt.Errorf("%w: tx lookup index %d with hash %x exceeds the transactions of block %x", dbstore.ErrCorrupted, txLookupIntex.Index, hash, txLookupIntex.BlockHash)
+	}
 	return block.Transactions[txLookupIntex.Index], txLookupIntex.BlockHash, txLookupIntex.BlockHeight, txLookupIntex.Index, nil
 }
 
 // GetReceiptByHash get receipt by relative tx's hash
-func (blockStore *BlockStore) GetReceiptByTxHash(txHash types.Hash) (*types.Receipt, types.Hash, uint64, uint64, error) {
+func (blockStore *BlockStore) GetReceiptByTxHash(txHash types.Hash) (receipt *types.Receipt, blockHash types.Hash, height uint64, index uint64, err error) {
+	defer blockStore.metrics.observe(opGetReceiptByTxHash, time.Now(), &err)
 	// read tx look up indexs
 	txLookupIntex, err := blockStore.getEntityLookUpIndex(txHash)
 	if err != nil {
 		log.Error("failed to get tx lookup index with hash %x from database as: %v", txHash, err)
-		return nil, types.Hash{}, 0, 0, fmt.Errorf("failed get tx lookup index with hash %x from database as: %v", txHash, err)
+		return nil, types.Hash{}, 0, 0, err
 	}
-	receiptsByte, err := blockStore.store.Get(append(receiptPrefix, common.HashToBytes(txLookupIntex.BlockHash)...))
+	receipts, err := blockStore.GetReceiptByBlockHash(txLookupIntex.BlockHash)
 	if err != nil {
-		log.Error("failed to get receipts with block hash %x from database as: %v", txLookupIntex.BlockHash, err)
-		return nil, types.Hash{}, 0, 0, fmt.Errorf("failed to get receipts with block hash %x from database as: %v", txLookupIntex.BlockHash, err)
+		return nil, types.Hash{}, 0, 0, err
 	}
-	var receipts []*types.Receipt
-	err = decodeEntity(receiptsByte, &receipts)
-	if err != nil {
-		log.Error("failed to decode receipts with block hash %x, s: %v", txLookupIntex.BlockHash, err)
-		return nil, types.Hash{}, 0, 0, fmt.Errorf("failed to decode receipts with block hash %x, s: %v", txLookupIntex.BlockHash, err)
+	if txLookupIntex.Index >= uint64(len(receipts)) {
+		return nil, types.Hash{}, 0, 0, fmt.Errorf("%w: tx lookup index %d with hash %x exceeds the receipts of block %x", dbstore.ErrCorrupted, txLookupIntex.Index, txHash, txLookupIntex.BlockHash)
 	}
 	return receipts[txLookupIntex.Index], txLookupIntex.BlockHash, txLookupIntex.BlockHeight, txLookupIntex.Index, nil
 }
 
-// GetReceiptByHash get receipt by relative block's hash
-func (blockStore *BlockStore) GetReceiptByBlockHash(blockHash types.Hash) []*types.Receipt {
-	receiptsByte, err := blockStore.store.Get(append(receiptPrefix, common.HashToBytes(blockHash)...))
+// GetReceiptByHash get receipt by relative block's hash, return dbstore.ErrNotFound if the block has no receipts.
+func (blockStore *BlockStore) GetReceiptByBlockHash(blockHash types.Hash) (receipts []*types.Receipt, err error) {
+	defer blockStore.metrics.observe(opGetReceiptByBlockHash, time.Now(), &err)
+	if write, ok := blockStore.pipeline.getBlock(blockHash); ok && write.withReceipts && !blockStore.headersOnly {
+		return copyReceipts(write.receipts), nil
+	}
+	if receipts, ok := blockStore.receiptCache.Get(blockHash); ok {
+		return copyReceipts(receipts.([]*types.Receipt)), nil
+	}
+	generation := blockStore.receiptCache.Generation()
+	_, err = blockStore.getEntity(receiptPrefix, blockHash, &receipts)
+	if errors.Is(err, dbstore.ErrNotFound) && blockStore.isPruned(blockHash) {
+		return nil, fmt.Errorf("failed to get receipts with block hash %x, as: %w", blockHash, ErrPruned)
+	}
 	if err != nil {
 		log.Error("failed to get receipts with block hash %x from database as: %v", blockHash, err)
-		return nil
+		return nil, fmt.Errorf("failed to get receipts with block hash %x, as: %w", blockHash, err)
 	}
-	var receipts []*types.Receipt
-	err = decodeEntity(receiptsByte, &receipts)
+	if blockStore.receiptCache.AddIfGeneration(generation, blockHash, receipts) {
+		return copyReceipts(receipts), nil
+	}
+	return receipts, nil
+}
+
+// Close close the block store after the in-flight writes complete, the operations after close return
+// dbstore.ErrClosed.
+func (blockStore *BlockStore) Close() error {
+	blockStore.pruner.stop()
+	blockStore.chainFreezer.stop()
+	if err := blockStore.metrics.close(); err != nil {
+		log.Warn("Failed to stop metrics server, as: %v", err)
+	}
+	blockStore.lock.Lock()
+	defer blockStore.lock.Unlock()
+	log.Info("Start closing block store")
+	err := blockStore.pipeline.close()
 	if err != nil {
-		log.Error("failed to decode receipts with block hash %x, s: %v", blockHash, err)
-		return nil
+		log.Warn("Failed to commit the queued blocks before closing, as: %v", err)
 	}
-	return receipts
+	err = blockStore.store.Close()
+	if freezerErr := blockStore.freezer.Close(); err == nil {
+		err = freezerErr
+	}
+	return err
 }
 
 // Put add a record to database
 func (blockStore *BlockStore) Put(key []byte, value []byte) error {
+	if blockStore.readOnly {
+		return dbstore.ErrReadOnly
+	}
 	return blockStore.store.Put(key, value)
 }
 
@@ -292,20 +1110,39 @@ func (blockStore *BlockStore) Get(key []byte) ([]byte, error) {
 
 // Delete removes the key from the key-value data store.
 func (blockStore *BlockStore) Delete(key []byte) error {
+	if blockStore.readOnly {
+		return dbstore.ErrReadOnly
+	}
 	return blockStore.store.Delete(key)
 }
 
 // getEntityLookUpIndex get look up index entity by hash
 func (blockStore *BlockStore) getEntityLookUpIndex(txHash types.Hash) (*indexes.EntityLookupIndex, error) {
+	if write, index, ok := blockStore.pipeline.getTransaction(txHash); ok {
+		return &indexes.EntityLookupIndex{
+			BlockHash:   write.block.HeaderHash,
+			BlockHeight: write.block.Header.Height,
+			Index:       index,
+		}, nil
+	}
+	if txLookupIntex, ok := blockStore.txLookupCache.Get(txHash); ok {
+		indexCopy := *txLookupIntex.(*indexes.EntityLookupIndex)
+		return &indexCopy, nil
+	}
+	generation := blockStore.txLookupCache.Generation()
 	// read tx look up indexs
 	txLookupIntexByte, err := blockStore.store.Get(append(txPrefix, common.HashToBytes(txHash)...))
-	if txLookupIntexByte == nil || err != nil {
-		return nil, fmt.Errorf("failed to get tx lookup index with hash %x, as: %v", txHash, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tx lookup index with hash %x, as: %w", txHash, err)
 	}
 	var txLookupIntex indexes.EntityLookupIndex
-	err = decodeEntity(txLookupIntexByte, &txLookupIntex)
+	err = blockStore.decodeEntity(txLookupIntexByte, &txLookupIntex)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode tx lookup index with hash %x from database as: %v", txHash, err)
+		return nil, fmt.Errorf("%w: failed to decode tx lookup index with hash %x from database as: %v", dbstore.ErrCorrupted, txHash, err)
+	}
+	if blockStore.txLookupCache.AddIfGeneration(generation, txHash, &txLookupIntex) {
+		indexCopy := txLookupIntex
+		return &indexCopy, nil
 	}
 	return &txLookupIntex, nil
 }
@@ -318,7 +1155,7 @@ func (blockStore *BlockStore) writeTxLookUpIndex(batch dbstore.Batch, blockHash
 			BlockHeight: blockHeight,
 			Index:       uint64(i),
 		}
-		indexByte, err := encodeEntity(index)
+		indexByte, err := blockStore.encodeEntity(index)
 		if err != nil {
 			log.Error("Failed to encode tx lookup index %d to byte, as: %v ", index, err)
 			return fmt.Errorf("Failed to tx lookup index %d to byte, as: %v ", index, err)
@@ -328,10 +1165,6 @@ func (blockStore *BlockStore) writeTxLookUpIndex(batch dbstore.Batch, blockHash
 			log.Error("Failed to store tx lookup index %d to database, as: %v ", index, err)
 			return fmt.Errorf("Failed to store tx lookup index %d to database, as: %v ", index, err)
 		}
-		//check whether the batch size over the max batch size
-		if batch.ValueSize() >= dbstore.MaxBatchSize {
-			batch.Write()
-		}
 	}
 	return nil
 }
@@ -349,12 +1182,27 @@ func encodeBlockHeight(height uint64) []byte {
 	return enc
 }
 
+// encodeSchemaVersion encodes a schema version to byte
+func encodeSchemaVersion(version uint64) []byte {
+	enc := make([]byte, 8)
+	binary.BigEndian.PutUint64(enc, version)
+	return enc
+}
+
+// decodeSchemaVersion decodes a schema version from byte
+func decodeSchemaVersion(versionByte []byte) (uint64, error) {
+	if len(versionByte) != 8 {
+		return 0, fmt.Errorf("invalid schema version record %x", versionByte)
+	}
+	return binary.BigEndian.Uint64(versionByte), nil
+}
+
 // encode entity to byte
-func encodeEntity(block interface{}) ([]byte, error) {
-	return json.Marshal(block)
+func (blockStore *BlockStore) encodeEntity(entity interface{}) ([]byte, error) {
+	return blockStore.codec.Encode(entity)
 }
 
-// decode block from byte
-func decodeEntity(blockByte []byte, entityType interface{}) error {
-	return json.Unmarshal(blockByte, entityType)
+// decode entity from byte
+func (blockStore *BlockStore) decodeEntity(entityByte []byte, entityType interface{}) error {
+	return blockStore.codec.Decode(entityByte, entityType)
 }
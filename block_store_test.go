@@ -1,13 +1,22 @@
 package blockstore
 
 import (
+	"bytes"
+	"errors"
+	"github.com/DSiSc/blockstore/codec"
 	"github.com/DSiSc/blockstore/common"
 	"github.com/DSiSc/blockstore/config"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/blockstore/dbstore/compressedstore"
+	"github.com/DSiSc/blockstore/dbstore/encryptedstore"
+	"github.com/DSiSc/blockstore/dbstore/leveldbstore"
+	"github.com/DSiSc/blockstore/dbstore/memorystore"
 	"github.com/DSiSc/craft/types"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"math/big"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -29,6 +38,65 @@ func mockBlockStoreConfig() *config.BlockStoreConfig {
 	}
 }
 
+// mock block store config changed by the options, the data directory is a temp directory of the test
+func mockTempBlockStoreConfig(t *testing.T, options ...func(*config.BlockStoreConfig)) *config.BlockStoreConfig {
+	blockStoreConfig := mockBlockStoreConfig()
+	blockStoreConfig.DataPath = t.TempDir()
+	for _, option := range options {
+		option(blockStoreConfig)
+	}
+	return blockStoreConfig
+}
+
+// mock block store of the mock config changed by the options
+func mockBlockStore(t *testing.T, options ...func(*config.BlockStoreConfig)) *BlockStore {
+	blockStore, err := NewBlockStore(mockTempBlockStoreConfig(t, options...))
+	assert.Nil(t, err)
+	return blockStore
+}
+
+// options of the mock block store config
+func withLevelDB(blockStoreConfig *config.BlockStoreConfig) {
+	blockStoreConfig.PluginName = PLUGIN_LEVELDB
+}
+
+func withAddressIndex(blockStoreConfig *config.BlockStoreConfig) {
+	blockStoreConfig.AddressIndex = true
+}
+
+func withStrictValidation(blockStoreConfig *config.BlockStoreConfig) {
+	blockStoreConfig.StrictValidation = true
+}
+
+// async write mode, the blocks will not be committed until flush
+func withGroupCommit(blockStoreConfig *config.BlockStoreConfig) {
+	blockStoreConfig.AsyncWrite = true
+	blockStoreConfig.Durability = DURABILITY_GROUP
+	blockStoreConfig.GroupCommitInterval = 3600 * 1000
+}
+
+func withCaches(size int) func(*config.BlockStoreConfig) {
+	return func(blockStoreConfig *config.BlockStoreConfig) {
+		blockStoreConfig.BlockCacheSize = size
+		blockStoreConfig.HeaderCacheSize = size
+		blockStoreConfig.ReceiptCacheSize = size
+		blockStoreConfig.TxLookupCacheSize = size
+	}
+}
+
+func withPruneRetention(retention uint64) func(*config.BlockStoreConfig) {
+	return func(blockStoreConfig *config.BlockStoreConfig) {
+		blockStoreConfig.PruneRetention = retention
+	}
+}
+
+func withFreezer(path string, finality uint64) func(*config.BlockStoreConfig) {
+	return func(blockStoreConfig *config.BlockStoreConfig) {
+		blockStoreConfig.FreezerPath = path
+		blockStoreConfig.FreezerFinality = finality
+	}
+}
+
 // mock block
 func mockBlock() *types.Block {
 	header := types.Header{
@@ -66,6 +134,20 @@ func mockBlockWithTx() (*types.Block, types.Transaction) {
 	return block, tx
 }
 
+// mock child block of the parent block
+func mockChildBlock(parent *types.Block, stateRoot types.Hash) *types.Block {
+	header := types.Header{
+		PrevBlockHash: parent.HeaderHash,
+		Height:        parent.Header.Height + 1,
+		StateRoot:     stateRoot,
+	}
+	block := &types.Block{
+		Header: &header,
+	}
+	block.HeaderHash = common.HeaderHash(block)
+	return block
+}
+
 // mock receipts
 func mockReceipts() []*types.Receipt {
 	receipt := types.Receipt{
@@ -93,6 +175,7 @@ func TestBlockStore_createDBStore(t *testing.T) {
 	database, err = createDBStore(config)
 	assert.Nil(err)
 	assert.NotNil(database)
+	database.Close()
 	os.RemoveAll(config.DataPath)
 }
 
@@ -244,3 +327,471 @@ func TestBlockStore_Delete(t *testing.T) {
 	_, err = blockStore.Get(key)
 	assert.NotNil(err)
 }
+
+// test write side chain block
+func TestBlockStore_WriteSideChainBlock(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	assert.NotNil(blockStore)
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+	block2a := mockChildBlock(block, common.HexToHash("0x2a"))
+	assert.Nil(blockStore.WriteBlock(block2a))
+	block2b := mockChildBlock(block, common.HexToHash("0x2b"))
+	assert.Nil(blockStore.WriteBlock(block2b))
+
+	assert.Equal(block2a.HeaderHash, blockStore.GetCurrentBlock().HeaderHash)
+	blockSaved, err := blockStore.GetBlockByHeight(2)
+	assert.Nil(err)
+	assert.Equal(block2a.HeaderHash, blockSaved.HeaderHash)
+	blockSaved, err = blockStore.GetBlockByHash(block2b.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(block2b.HeaderHash, blockSaved.HeaderHash)
+}
+
+// test reorg to side chain
+func TestBlockStore_Reorg(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	assert.NotNil(blockStore)
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+	block2a, tx := mockBlockWithTx()
+	block2a.Header.PrevBlockHash = block.HeaderHash
+	block2a.Header.Height = 2
+	block2a.HeaderHash = types.Hash{}
+	block2a.HeaderHash = common.HeaderHash(block2a)
+	assert.Nil(blockStore.WriteBlock(block2a))
+	block3a := mockChildBlock(block2a, common.HexToHash("0x3a"))
+	assert.Nil(blockStore.WriteBlock(block3a))
+	block2b := mockChildBlock(block, common.HexToHash("0x2b"))
+	assert.Nil(blockStore.WriteBlock(block2b))
+
+	_, blockHash, _, _, err := blockStore.GetTransactionByHash(common.TxHash(&tx))
+	assert.Nil(err)
+	assert.Equal(block2a.HeaderHash, blockHash)
+
+	assert.Nil(blockStore.Reorg(block2b.HeaderHash))
+	assert.Equal(block2b.HeaderHash, blockStore.GetCurrentBlock().HeaderHash)
+	blockSaved, err := blockStore.GetBlockByHeight(2)
+	assert.Nil(err)
+	assert.Equal(block2b.HeaderHash, blockSaved.HeaderHash)
+	_, err = blockStore.GetBlockByHeight(3)
+	assert.NotNil(err)
+	_, _, _, _, err = blockStore.GetTransactionByHash(common.TxHash(&tx))
+	assert.NotNil(err)
+
+	assert.Nil(blockStore.Reorg(block3a.HeaderHash))
+	assert.Equal(block3a.HeaderHash, blockStore.GetCurrentBlock().HeaderHash)
+	_, blockHash, _, _, err = blockStore.GetTransactionByHash(common.TxHash(&tx))
+	assert.Nil(err)
+	assert.Equal(block2a.HeaderHash, blockHash)
+}
+
+// test rollback to specified height
+func TestBlockStore_Rollback(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	assert.NotNil(blockStore)
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+	block2, tx := mockBlockWithTx()
+	block2.Header.PrevBlockHash = block.HeaderHash
+	block2.Header.Height = 2
+	block2.HeaderHash = types.Hash{}
+	block2.HeaderHash = common.HeaderHash(block2)
+	assert.Nil(blockStore.WriteBlockWithReceipts(block2, mockReceipts()))
+
+	assert.NotNil(blockStore.Rollback(3))
+	assert.Nil(blockStore.Rollback(1))
+	assert.Equal(block.HeaderHash, blockStore.GetCurrentBlock().HeaderHash)
+	_, err = blockStore.GetBlockByHeight(2)
+	assert.NotNil(err)
+	_, err = blockStore.GetBlockByHash(block2.HeaderHash)
+	assert.NotNil(err)
+	_, _, _, _, err = blockStore.GetTransactionByHash(common.TxHash(&tx))
+	assert.NotNil(err)
+	_, err = blockStore.GetReceiptByBlockHash(block2.HeaderHash)
+	assert.True(errors.Is(err, dbstore.ErrNotFound))
+
+	blockStore.loadLatestBlock()
+	assert.Equal(block.HeaderHash, blockStore.GetCurrentBlock().HeaderHash)
+}
+
+// test rollback remove the side chain blocks above the height
+func TestBlockStore_RollbackSideChain(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+	block2a := mockChildBlock(block, common.HexToHash("0x2a"))
+	assert.Nil(blockStore.WriteBlock(block2a))
+	block2b := mockChildBlock(block, common.HexToHash("0x2b"))
+	assert.Nil(blockStore.WriteBlock(block2b))
+	block3b := mockChildBlock(block2b, common.HexToHash("0x3b"))
+	assert.Nil(blockStore.WriteBlock(block3b))
+	assert.Equal(block2a.HeaderHash, blockStore.GetCurrentBlock().HeaderHash)
+
+	assert.Nil(blockStore.Rollback(1))
+	for _, side := range []*types.Block{block2a, block2b, block3b} {
+		_, err = blockStore.GetBlockByHash(side.HeaderHash)
+		assert.True(errors.Is(err, dbstore.ErrNotFound))
+		_, err = blockStore.GetHeaderByHash(side.HeaderHash)
+		assert.True(errors.Is(err, dbstore.ErrNotFound))
+	}
+	blockSaved, err := blockStore.GetBlockByHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(block.HeaderHash, blockSaved.HeaderHash)
+}
+
+// test block store with rlp codec
+func TestBlockStore_RlpCodec(t *testing.T) {
+	assert := assert.New(t)
+	config := mockBlockStoreConfig()
+	config.Codec = codec.RLP
+	blockStore, err := NewBlockStore(config)
+	assert.Nil(err)
+	assert.Equal(codec.RLP, blockStore.codec.Name())
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+
+	blockSaved, err := blockStore.GetBlockByHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(block.HeaderHash, blockSaved.HeaderHash)
+
+	// block with contract creation transaction and receipts with logs
+	creation := &types.Transaction{Data: types.TxData{AccountNonce: 1, Amount: big.NewInt(10), Payload: []byte{0x60}}}
+	block2 := mockChildBlock(block, common.HexToHash("0x1"))
+	block2.Transactions = []*types.Transaction{creation}
+	block2.HeaderHash = types.Hash{}
+	block2.HeaderHash = common.HeaderHash(block2)
+	receipts := []*types.Receipt{{Status: 1, Logs: []*types.Log{{Topics: []types.Hash{common.HexToHash("0x2")}, Data: []byte{0x3}}}}}
+	assert.Nil(blockStore.WriteBlockWithReceipts(block2, receipts))
+	blockSaved, err = blockStore.GetBlockByHash(block2.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(creation.Data, blockSaved.Transactions[0].Data)
+	assert.Equal(common.TxHash(creation), common.TxHash(blockSaved.Transactions[0]))
+	receiptsSaved, err := blockStore.GetReceiptByBlockHash(block2.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(receipts, receiptsSaved)
+}
+
+// test load codec from database
+func TestBlockStore_loadCodec(t *testing.T) {
+	assert := assert.New(t)
+	config := mockBlockStoreConfig()
+	config.Codec = codec.RLP
+
+	// database created before codec is configurable
+	store := memorystore.NewMemDBStore()
+	store.Put([]byte(latestBlockKey), common.HashToBytes(blockHash))
+	entityCodec, err := loadCodec(store, config)
+	assert.Nil(err)
+	assert.Equal(codec.JSON, entityCodec.Name())
+
+	// new database
+	store = memorystore.NewMemDBStore()
+	entityCodec, err = loadCodec(store, config)
+	assert.Nil(err)
+	assert.Equal(codec.RLP, entityCodec.Name())
+	version, err := store.Get([]byte(schemaVersionKey))
+	assert.Nil(err)
+	assert.Equal(encodeSchemaVersion(SCHEMA_VERSION), version)
+
+	// reopen database with different codec
+	config.Codec = codec.JSON
+	entityCodec, err = loadCodec(store, config)
+	assert.Nil(err)
+	assert.Equal(codec.RLP, entityCodec.Name())
+
+	// unknown codec
+	config.Codec = "xml"
+	_, err = loadCodec(memorystore.NewMemDBStore(), config)
+	assert.NotNil(err)
+}
+
+// test get block header and body
+func TestBlockStore_GetHeaderAndBody(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	block, _ := mockBlockWithTx()
+	assert.Nil(blockStore.WriteBlock(block))
+
+	header, err := blockStore.GetHeaderByHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(block.Header, header)
+	header, err = blockStore.GetHeaderByHeight(block.Header.Height)
+	assert.Nil(err)
+	assert.Equal(block.Header, header)
+	body, err := blockStore.GetBodyByHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(1, len(body.Transactions))
+	height, err := blockStore.Get(append(headerHeightPrefix, block.HeaderHash[:]...))
+	assert.Nil(err)
+	assert.Equal(encodeBlockHeight(block.Header.Height), height)
+}
+
+// test headers only block store
+func TestBlockStore_HeadersOnly(t *testing.T) {
+	assert := assert.New(t)
+	config := mockBlockStoreConfig()
+	config.HeadersOnly = true
+	blockStore, err := NewBlockStore(config)
+	assert.Nil(err)
+	block, tx := mockBlockWithTx()
+	assert.Nil(blockStore.WriteBlockWithReceipts(block, mockReceipts()))
+
+	header, err := blockStore.GetHeaderByHeight(block.Header.Height)
+	assert.Nil(err)
+	assert.Equal(block.Header, header)
+	_, err = blockStore.GetBodyByHash(block.HeaderHash)
+	assert.NotNil(err)
+	_, _, _, _, err = blockStore.GetTransactionByHash(common.TxHash(&tx))
+	assert.NotNil(err)
+	_, err = blockStore.GetReceiptByBlockHash(block.HeaderHash)
+	assert.True(errors.Is(err, dbstore.ErrNotFound))
+
+	blockStore.loadLatestBlock()
+	assert.Equal(block.HeaderHash, blockStore.GetCurrentBlock().HeaderHash)
+}
+
+// test close block store
+func TestBlockStore_Close(t *testing.T) {
+	assert := assert.New(t)
+	config := mockBlockStoreConfig()
+	config.PluginName = PLUGIN_LEVELDB
+	defer os.RemoveAll(config.DataPath)
+	blockStore, err := NewBlockStore(config)
+	assert.Nil(err)
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+	assert.Nil(blockStore.Close())
+	assert.Equal(dbstore.ErrClosed, blockStore.WriteBlock(mockChildBlock(block, stateHash)))
+	_, err = blockStore.Get([]byte(latestBlockKey))
+	assert.Equal(dbstore.ErrClosed, err)
+	assert.Equal(dbstore.ErrClosed, blockStore.Close())
+
+	// reopen the same path
+	blockStore, err = NewBlockStore(config)
+	assert.Nil(err)
+	assert.Equal(block.HeaderHash, blockStore.GetCurrentBlock().HeaderHash)
+	assert.Nil(blockStore.Close())
+}
+
+// test block store getters return the errors defined in dbstore
+func TestBlockStore_TypedErrors(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+
+	_, err = blockStore.GetBlockByHash(blockHash)
+	assert.True(errors.Is(err, dbstore.ErrNotFound))
+	_, err = blockStore.GetBlockByHeight(block.Header.Height + 1)
+	assert.True(errors.Is(err, dbstore.ErrNotFound))
+	_, _, _, _, err = blockStore.GetTransactionByHash(blockHash)
+	assert.True(errors.Is(err, dbstore.ErrNotFound))
+	_, _, _, _, err = blockStore.GetReceiptByTxHash(blockHash)
+	assert.True(errors.Is(err, dbstore.ErrNotFound))
+
+	assert.Nil(blockStore.Put(append(headerPrefix, block.HeaderHash[:]...), []byte("corrupted")))
+	_, err = blockStore.GetBlockByHash(block.HeaderHash)
+	assert.True(errors.Is(err, dbstore.ErrCorrupted))
+	_, err = blockStore.GetHeaderByHash(block.HeaderHash)
+	assert.True(errors.Is(err, dbstore.ErrCorrupted))
+	assert.False(errors.Is(err, dbstore.ErrNotFound))
+}
+
+// test the blocks written with compression are readable after compression is disabled
+func TestBlockStore_Compression(t *testing.T) {
+	assert := assert.New(t)
+	config := mockBlockStoreConfig()
+	config.PluginName = PLUGIN_LEVELDB
+	config.Compression = compressedstore.SNAPPY
+	config.CompressionThreshold = 1
+	defer os.RemoveAll(config.DataPath)
+	blockStore, err := NewBlockStore(config)
+	assert.Nil(err)
+	block, _ := mockBlockWithTx()
+	assert.Nil(blockStore.WriteBlockWithReceipts(block, mockReceipts()))
+	assert.Nil(blockStore.Close())
+
+	config.Compression = ""
+	blockStore, err = NewBlockStore(config)
+	assert.Nil(err)
+	storedBlock, err := blockStore.GetBlockByHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(block.HeaderHash, storedBlock.HeaderHash)
+	receipts, err := blockStore.GetReceiptByBlockHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(1, len(receipts))
+	assert.Nil(blockStore.Close())
+
+	config.Compression = "zip"
+	_, err = NewBlockStore(config)
+	assert.NotNil(err)
+}
+
+// test the legacy raw values looking like compressed values are readable
+func TestBlockStore_CompressionLegacyValues(t *testing.T) {
+	assert := assert.New(t)
+	blockStoreConfig := mockTempBlockStoreConfig(t, withLevelDB)
+	legacyHash := append([]byte{0xff, 0xfe, 0x00}, bytes.Repeat([]byte{1}, 29)...)
+	legacyHash2 := append([]byte{0xff, 0xfe, 0x01}, bytes.Repeat([]byte{2}, 29)...)
+	store, err := leveldbstore.NewLevelDBStore(blockStoreConfig.DataPath)
+	assert.Nil(err)
+	assert.Nil(store.Put(append(blockHeightPrefix, encodeBlockHeight(1)...), legacyHash))
+	assert.Nil(store.Put(append(blockHeightPrefix, encodeBlockHeight(2)...), legacyHash2))
+	assert.Nil(store.Close())
+
+	// the database written before compression is supported is read raw
+	blockStore, err := NewBlockStore(blockStoreConfig)
+	assert.Nil(err)
+	value, err := blockStore.Get(append(blockHeightPrefix, encodeBlockHeight(1)...))
+	assert.Nil(err)
+	assert.Equal(legacyHash, value)
+	value, err = blockStore.Get(append(blockHeightPrefix, encodeBlockHeight(2)...))
+	assert.Nil(err)
+	assert.Equal(legacyHash2, value)
+	assert.Nil(blockStore.Close())
+	blockStoreConfig.Compression = compressedstore.SNAPPY
+	_, err = NewBlockStore(blockStoreConfig)
+	assert.NotNil(err)
+
+	// compression can be enabled after migration
+	store, err = leveldbstore.NewLevelDBStore(blockStoreConfig.DataPath)
+	assert.Nil(err)
+	assert.Nil(MigrateDatabase(store, codec.JSON, nil))
+	assert.Nil(store.Close())
+	blockStore, err = NewBlockStore(blockStoreConfig)
+	assert.Nil(err)
+	defer blockStore.Close()
+	value, err = blockStore.Get(append(blockHeightPrefix, encodeBlockHeight(1)...))
+	assert.Nil(err)
+	assert.Equal(legacyHash, value)
+	value, err = blockStore.Get(append(blockHeightPrefix, encodeBlockHeight(2)...))
+	assert.Nil(err)
+	assert.Equal(legacyHash2, value)
+}
+
+// test the values are encrypted on disk and readable after key rotation
+func TestBlockStore_Encryption(t *testing.T) {
+	assert := assert.New(t)
+	config := mockBlockStoreConfig()
+	config.PluginName = PLUGIN_LEVELDB
+	config.EncryptionKey = "1:" + strings.Repeat("01", 32)
+	defer os.RemoveAll(config.DataPath)
+	blockStore, err := NewBlockStore(config)
+	assert.Nil(err)
+	block, _ := mockBlockWithTx()
+	assert.Nil(blockStore.WriteBlockWithReceipts(block, mockReceipts()))
+	assert.Nil(blockStore.Close())
+
+	rawStore, err := leveldbstore.NewLevelDBStore(config.DataPath)
+	assert.Nil(err)
+	raw, err := rawStore.Get(append(bodyPrefix, block.HeaderHash[:]...))
+	assert.Nil(err)
+	assert.False(bytes.Contains(raw, []byte("Transactions")))
+	keys, err := encryptedstore.LoadKeys(config.EncryptionKey+"\n", "")
+	assert.Nil(err)
+	encryptedStore, err := encryptedstore.NewEncryptedStore(rawStore, append(keys, &encryptedstore.Key{ID: 2, Secret: bytes.Repeat([]byte{2}, 16)}))
+	assert.Nil(err)
+	_, err = encryptedStore.Reencrypt(nil)
+	assert.Nil(err)
+	assert.Nil(rawStore.Close())
+
+	// the database can't be opened by the rotated key
+	_, err = NewBlockStore(config)
+	assert.True(errors.Is(err, dbstore.ErrCorrupted))
+	config.EncryptionKey = "2:" + strings.Repeat("02", 16)
+	blockStore, err = NewBlockStore(config)
+	assert.Nil(err)
+	assert.Equal(block.HeaderHash, blockStore.GetCurrentBlock().HeaderHash)
+	receipts, err := blockStore.GetReceiptByBlockHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(1, len(receipts))
+
+	// the backup is encrypted by the same key
+	backupDir, restoreDir := "./encryptedbackup", "./encryptedrestore"
+	defer os.RemoveAll(backupDir)
+	defer os.RemoveAll(restoreDir)
+	_, err = blockStore.Backup(backupDir, false)
+	assert.Nil(err)
+	assert.Nil(blockStore.Close())
+	restoreConfig := *config
+	restoreConfig.DataPath = restoreDir
+	restoreConfig.EncryptionKey = ""
+	assert.NotNil(RestoreBackup(backupDir, &restoreConfig))
+	restoreConfig.EncryptionKey = config.EncryptionKey
+	assert.Nil(RestoreBackup(backupDir, &restoreConfig))
+	blockStore, err = NewBlockStore(&restoreConfig)
+	assert.Nil(err)
+	assert.Equal(block.HeaderHash, blockStore.GetCurrentBlock().HeaderHash)
+	assert.Nil(blockStore.Close())
+}
+
+// test open block store in read-only mode
+func TestBlockStore_ReadOnly(t *testing.T) {
+	assert := assert.New(t)
+	config := mockBlockStoreConfig()
+	config.PluginName = PLUGIN_LEVELDB
+	config.ReadOnly = true
+	defer os.RemoveAll(config.DataPath)
+	_, err := NewBlockStore(config)
+	assert.NotNil(err)
+
+	config.ReadOnly = false
+	blockStore, err := NewBlockStore(config)
+	assert.Nil(err)
+	blocks := writeMockChain(t, blockStore, 3)
+	assert.Nil(blockStore.Close())
+
+	// nothing is written during startup, even the section bloom index and freezer are configured
+	config.ReadOnly = true
+	config.BloomSectionSize = 2
+	config.FreezerPath = t.TempDir()
+	_, err = NewBlockStore(config)
+	assert.NotNil(err)
+	config.FreezerPath = ""
+	config.AsyncWrite = true
+	config.PruneRetention = 1
+	blockStore, err = NewBlockStore(config)
+	assert.Nil(err)
+	defer blockStore.Close()
+	assert.Nil(blockStore.pipeline)
+	assert.Nil(blockStore.pruner)
+	assert.Equal(uint64(0), blockStore.bloomSectionSize)
+	_, err = blockStore.Get([]byte(bloomSectionIndexKey))
+	assert.True(errors.Is(err, dbstore.ErrNotFound))
+
+	assert.Equal(blocks[2].HeaderHash, blockStore.GetCurrentBlock().HeaderHash)
+	block, err := blockStore.GetBlockByHeight(2)
+	assert.Nil(err)
+	assert.Equal(blocks[1].HeaderHash, block.HeaderHash)
+	logs, err := blockStore.FilterLogs(&LogFilter{FromHeight: 1, ToHeight: 3})
+	assert.Nil(err)
+	assert.Equal(0, len(logs))
+	report, err := blockStore.Verify(false)
+	assert.Nil(err)
+	assert.True(report.Consistent())
+
+	child := mockChildBlock(blocks[2], stateHash)
+	assert.Equal(dbstore.ErrReadOnly, blockStore.WriteBlock(child))
+	assert.Equal(dbstore.ErrReadOnly, blockStore.WriteBlockWithReceipts(child, mockReceipts()))
+	assert.Equal(dbstore.ErrReadOnly, blockStore.Put([]byte("key"), []byte("value")))
+	assert.Equal(dbstore.ErrReadOnly, blockStore.Delete([]byte(latestBlockKey)))
+	assert.Equal(dbstore.ErrReadOnly, blockStore.Rollback(1))
+	assert.Equal(dbstore.ErrReadOnly, blockStore.Reorg(blocks[1].HeaderHash))
+	assert.Equal(dbstore.ErrReadOnly, blockStore.ReindexFrom(1))
+	_, err = blockStore.Verify(true)
+	assert.Equal(dbstore.ErrReadOnly, err)
+	_, err = blockStore.ImportChain(bytes.NewReader(nil))
+	assert.Equal(dbstore.ErrReadOnly, err)
+	assert.Equal(uint64(3), blockStore.GetCurrentBlockHeight())
+}
@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// Stats is the statistics of a cache.
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+	Len    int
+}
+
+// LRUCache is a thread-safe cache holding a fixed number of entries, the least recently used entry is
+// evicted when the cache is full. A nil LRUCache is a disabled cache which holds nothing.
+type LRUCache struct {
+	size       int
+	items      map[interface{}]*list.Element
+	evictList  *list.List
+	lock       sync.Mutex
+	hits       uint64
+	misses     uint64
+	generation uint64 // increased when the entries are removed or purged
+}
+
+// entry is the key-value pair stored in evict list.
+type entry struct {
+	key   interface{}
+	value interface{}
+}
+
+// NewLRUCache create a cache holding at most size entries, return nil if size is not positive.
+func NewLRUCache(size int) *LRUCache {
+	if size <= 0 {
+		return nil
+	}
+	return &LRUCache{
+		size:      size,
+		items:     make(map[interface{}]*list.Element),
+		evictList: list.New(),
+	}
+}
+
+// Get get the value of the key and mark it as the most recently used.
+func (c *LRUCache) Get(key interface{}) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if element, ok := c.items[key]; ok {
+		c.evictList.MoveToFront(element)
+		atomic.AddUint64(&c.hits, 1)
+		return element.Value.(*entry).value, true
+	}
+	atomic.AddUint64(&c.misses, 1)
+	return nil, false
+}
+
+// Add add the key-value pair to cache, evict the least recently used entry if cache is full.
+func (c *LRUCache) Add(key interface{}, value interface{}) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.add(key, value)
+}
+
+// add add the key-value pair to cache, caller must hold the lock.
+func (c *LRUCache) add(key interface{}, value interface{}) {
+	if element, ok := c.items[key]; ok {
+		c.evictList.MoveToFront(element)
+		element.Value.(*entry).value = value
+		return
+	}
+	c.items[key] = c.evictList.PushFront(&entry{key: key, value: value})
+	if c.evictList.Len() > c.size {
+		oldest := c.evictList.Back()
+		c.evictList.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry).key)
+	}
+}
+
+// Generation get the generation of cache, it is increased when the entries are removed or purged. The value
+// loaded from database after getting the generation is added by AddIfGeneration.
+func (c *LRUCache) Generation() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.generation
+}
+
+// AddIfGeneration add the key-value pair only if cache is still at generation, so the value loaded before a
+// removal or purge is not cached after it. Return whether the pair is added.
+func (c *LRUCache) AddIfGeneration(generation uint64, key interface{}, value interface{}) bool {
+	if c == nil {
+		return false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.generation != generation {
+		return false
+	}
+	c.add(key, value)
+	return true
+}
+
+// Remove remove the key from cache.
+func (c *LRUCache) Remove(key interface{}) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.generation++
+	if element, ok := c.items[key]; ok {
+		c.evictList.Remove(element)
+		delete(c.items, key)
+	}
+}
+
+// Purge remove all entries from cache, the statistics are kept.
+func (c *LRUCache) Purge() {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.generation++
+	c.items = make(map[interface{}]*list.Element)
+	c.evictList.Init()
+}
+
+// Len return the number of entries in cache.
+func (c *LRUCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.evictList.Len()
+}
+
+// Stats return the hit/miss counters and the number of entries of cache.
+func (c *LRUCache) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+	return Stats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+		Len:    c.Len(),
+	}
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// test new lru cache
+func TestNewLRUCache(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(NewLRUCache(1))
+	assert.Nil(NewLRUCache(0))
+}
+
+// test lru cache evict the least recently used entry
+func TestLRUCache_Evict(t *testing.T) {
+	assert := assert.New(t)
+	c := NewLRUCache(2)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	value, ok := c.Get("a")
+	assert.True(ok)
+	assert.Equal(1, value)
+	c.Add("c", 3)
+	_, ok = c.Get("b")
+	assert.False(ok)
+	_, ok = c.Get("a")
+	assert.True(ok)
+	_, ok = c.Get("c")
+	assert.True(ok)
+	assert.Equal(Stats{Hits: 3, Misses: 1, Len: 2}, c.Stats())
+}
+
+// test remove and purge lru cache
+func TestLRUCache_RemoveAndPurge(t *testing.T) {
+	assert := assert.New(t)
+	c := NewLRUCache(2)
+	c.Add("a", 1)
+	c.Add("a", 2)
+	value, _ := c.Get("a")
+	assert.Equal(2, value)
+	c.Add("b", 2)
+	c.Remove("a")
+	_, ok := c.Get("a")
+	assert.False(ok)
+	assert.Equal(1, c.Len())
+	c.Purge()
+	assert.Equal(0, c.Len())
+}
+
+// test the value loaded before remove or purge is not added
+func TestLRUCache_AddIfGeneration(t *testing.T) {
+	assert := assert.New(t)
+	c := NewLRUCache(2)
+	generation := c.Generation()
+	assert.True(c.AddIfGeneration(generation, "a", 1))
+	c.Remove("b")
+	assert.False(c.AddIfGeneration(generation, "b", 2))
+	_, ok := c.Get("b")
+	assert.False(ok)
+	generation = c.Generation()
+	c.Purge()
+	assert.False(c.AddIfGeneration(generation, "a", 1))
+	assert.Equal(0, c.Len())
+	assert.True(c.AddIfGeneration(c.Generation(), "a", 1))
+}
+
+// test disabled cache
+func TestLRUCache_Nil(t *testing.T) {
+	assert := assert.New(t)
+	var c *LRUCache
+	c.Add("a", 1)
+	_, ok := c.Get("a")
+	assert.False(ok)
+	c.Remove("a")
+	c.Purge()
+	assert.False(c.AddIfGeneration(c.Generation(), "a", 1))
+	assert.Equal(Stats{}, c.Stats())
+}
@@ -0,0 +1,68 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/DSiSc/craft/rlp"
+)
+
+const (
+	// json codec, used by the databases created before codec is configurable.
+	JSON = "json"
+	// rlp codec
+	RLP = "rlp"
+)
+
+// Codec encode the entity to byte before storing it to database and decode it after reading.
+type Codec interface {
+	// Name return the codec name recorded in database.
+	Name() string
+	// Encode encode entity to byte.
+	Encode(entity interface{}) ([]byte, error)
+	// Decode decode byte to the entity.
+	Decode(entityByte []byte, entity interface{}) error
+}
+
+// NewCodec return the codec with specified name.
+func NewCodec(name string) (Codec, error) {
+	switch name {
+	case JSON:
+		return &jsonCodec{}, nil
+	case RLP:
+		return &rlpCodec{}, nil
+	default:
+		return nil, fmt.Errorf("Not support codec type %s", name)
+	}
+}
+
+// jsonCodec encode/decode entity by encoding/json.
+type jsonCodec struct{}
+
+func (c *jsonCodec) Name() string {
+	return JSON
+}
+
+func (c *jsonCodec) Encode(entity interface{}) ([]byte, error) {
+	return json.Marshal(entity)
+}
+
+func (c *jsonCodec) Decode(entityByte []byte, entity interface{}) error {
+	return json.Unmarshal(entityByte, entity)
+}
+
+// rlpCodec encode/decode entity by rlp, the craft types are encoded in storage form.
+type rlpCodec struct{}
+
+func (c *rlpCodec) Name() string {
+	return RLP
+}
+
+func (c *rlpCodec) Encode(entity interface{}) ([]byte, error) {
+	return rlp.EncodeToBytes(toRLP(entity))
+}
+
+func (c *rlpCodec) Decode(entityByte []byte, entity interface{}) error {
+	return fromRLP(entity, func(value interface{}) error {
+		return rlp.DecodeBytes(entityByte, value)
+	})
+}
@@ -0,0 +1,195 @@
+package codec
+
+import (
+	"github.com/DSiSc/blockstore/indexes"
+	"github.com/DSiSc/craft/types"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+var index = indexes.EntityLookupIndex{
+	BlockHash:   types.Hash{0x1, 0x2, 0x3},
+	BlockHeight: 10,
+	Index:       1,
+}
+
+// test create codec
+func TestNewCodec(t *testing.T) {
+	assert := assert.New(t)
+	c, err := NewCodec(JSON)
+	assert.Nil(err)
+	assert.Equal(JSON, c.Name())
+	c, err = NewCodec(RLP)
+	assert.Nil(err)
+	assert.Equal(RLP, c.Name())
+	_, err = NewCodec("xml")
+	assert.NotNil(err)
+}
+
+// test json encode/decode
+func TestJsonCodec(t *testing.T) {
+	assert := assert.New(t)
+	c, _ := NewCodec(JSON)
+	indexByte, err := c.Encode(index)
+	assert.Nil(err)
+	var decoded indexes.EntityLookupIndex
+	assert.Nil(c.Decode(indexByte, &decoded))
+	assert.Equal(index, decoded)
+}
+
+// test rlp encode/decode
+func TestRlpCodec(t *testing.T) {
+	assert := assert.New(t)
+	c, _ := NewCodec(RLP)
+	indexByte, err := c.Encode(index)
+	assert.Nil(err)
+	var decoded indexes.EntityLookupIndex
+	assert.Nil(c.Decode(indexByte, &decoded))
+	assert.Equal(index, decoded)
+}
+
+// mock block with a transfer transaction and a contract creation transaction
+func mockBlock() *types.Block {
+	recipient := types.Address{0x1}
+	hash := types.Hash{0x2}
+	transfer := &types.Transaction{
+		Data: types.TxData{
+			AccountNonce: 1,
+			Price:        big.NewInt(100),
+			Recipient:    &recipient,
+			From:         &recipient,
+			Amount:       big.NewInt(0),
+			Payload:      []byte{},
+			V:            big.NewInt(27),
+			R:            big.NewInt(1),
+			S:            big.NewInt(2),
+			Hash:         &hash,
+		},
+	}
+	creation := &types.Transaction{
+		Data: types.TxData{
+			AccountNonce: 2,
+			Price:        big.NewInt(100),
+			GasLimit:     21000,
+			Amount:       big.NewInt(10),
+			Payload:      []byte{0x60, 0x80},
+		},
+	}
+	return &types.Block{
+		Header: &types.Header{
+			ChainID:   1,
+			StateRoot: types.Hash{0x3},
+			Height:    10,
+			SigData:   [][]byte{{0x4}},
+		},
+		Transactions: []*types.Transaction{transfer, creation},
+		HeaderHash:   types.Hash{0x5},
+	}
+}
+
+// mock receipts with logs
+func mockReceipts() []*types.Receipt {
+	return []*types.Receipt{
+		{
+			Status:            1,
+			CumulativeGasUsed: 21000,
+			Logs: []*types.Log{
+				{
+					Address:     types.Address{0x1},
+					Topics:      []types.Hash{{0x2}, {0x3}},
+					Data:        []byte{0x4},
+					BlockNumber: 10,
+					TxHash:      types.Hash{0x5},
+					BlockHash:   types.Hash{0x6},
+					Removed:     true,
+				},
+				{
+					Address: types.Address{0x7},
+					TxIndex: 1,
+					Index:   1,
+				},
+			},
+			TxHash:  types.Hash{0x5},
+			GasUsed: 21000,
+		},
+		{
+			PostState:       []byte{0x8},
+			ContractAddress: types.Address{0x9},
+			Logs:            []*types.Log{},
+		},
+	}
+}
+
+// mockBody is an entity of other packages converted by RLPConverter
+type mockBody struct {
+	Transactions []*types.Transaction
+}
+
+func (body *mockBody) ToRLP() interface{} {
+	return body.Transactions
+}
+
+func (body *mockBody) FromRLP(decode func(value interface{}) error) error {
+	return decode(&body.Transactions)
+}
+
+// test rlp encode/decode the block with contract creation transaction
+func TestRlpCodec_Block(t *testing.T) {
+	assert := assert.New(t)
+	c, _ := NewCodec(RLP)
+	block := mockBlock()
+	blockByte, err := c.Encode(block)
+	assert.Nil(err)
+	var decoded types.Block
+	assert.Nil(c.Decode(blockByte, &decoded))
+	assert.Equal(block.Header, decoded.Header)
+	assert.Equal(block.HeaderHash, decoded.HeaderHash)
+	assert.Equal(2, len(decoded.Transactions))
+	for i, tx := range block.Transactions {
+		assert.Equal(tx.Data, decoded.Transactions[i].Data)
+	}
+	creation := decoded.Transactions[1].Data
+	assert.Nil(creation.Recipient)
+	assert.Nil(creation.From)
+	assert.Nil(creation.Hash)
+	assert.Nil(creation.V)
+	assert.Nil(creation.R)
+	assert.Nil(creation.S)
+
+	headerByte, err := c.Encode(block.Header)
+	assert.Nil(err)
+	var header types.Header
+	assert.Nil(c.Decode(headerByte, &header))
+	assert.Equal(*block.Header, header)
+
+	bodyByte, err := c.Encode(&mockBody{Transactions: block.Transactions})
+	assert.Nil(err)
+	var body mockBody
+	assert.Nil(c.Decode(bodyByte, &body))
+	assert.Equal(2, len(body.Transactions))
+	assert.Equal(block.Transactions[1].Data, body.Transactions[1].Data)
+
+	// block without header and transactions
+	blockByte, err = c.Encode(&types.Block{HeaderHash: types.Hash{0x1}})
+	assert.Nil(err)
+	decoded = types.Block{}
+	assert.Nil(c.Decode(blockByte, &decoded))
+	assert.Equal(types.Block{HeaderHash: types.Hash{0x1}}, decoded)
+}
+
+// test rlp encode/decode the receipts with logs
+func TestRlpCodec_Receipts(t *testing.T) {
+	assert := assert.New(t)
+	c, _ := NewCodec(RLP)
+	receiptsByte, err := c.Encode(mockReceipts())
+	assert.Nil(err)
+	var decoded []*types.Receipt
+	assert.Nil(c.Decode(receiptsByte, &decoded))
+	assert.Equal(mockReceipts(), decoded)
+
+	// the receipts decoded by migration are encoded by pointer
+	pointerByte, err := c.Encode(&decoded)
+	assert.Nil(err)
+	assert.Equal(receiptsByte, pointerByte)
+}
@@ -0,0 +1,374 @@
+package codec
+
+import (
+	"github.com/DSiSc/craft/types"
+	"math/big"
+)
+
+// The craft types can't be round-tripped by rlp directly. A nil pointer is encoded as the empty value, which
+// fails to decode into an address or a hash and decodes into zero for a big int, and a nil slice is decoded
+// as an empty one. So the rlp codec encodes them in the storage forms below, which fill the nil pointers with
+// zero values and record the nil fields in flags, and restores the nil fields after decoding.
+
+// RLPConverter is implemented by the entities of other packages holding craft types. The rlp codec encodes
+// the value returned by ToRLP in storage form, and FromRLP restores the entity by the decode function.
+type RLPConverter interface {
+	// ToRLP return the value to encode instead of the entity.
+	ToRLP() interface{}
+	// FromRLP restore the entity with decode, which decodes the value returned by ToRLP.
+	FromRLP(decode func(value interface{}) error) error
+}
+
+// flags of the nil fields in storage forms
+const (
+	nilRecipient = 1 << iota
+	nilFrom
+	nilPrice
+	nilAmount
+	nilV
+	nilR
+	nilS
+	nilHash
+	nilPayload
+	nilHeader
+	nilTransactions
+	nilSigData
+	nilPostState
+	nilLogs
+	nilTopics
+	nilData
+)
+
+// rlpTransaction is the storage form of transaction.
+type rlpTransaction struct {
+	Data types.TxData
+	Nils uint64
+}
+
+// rlpHeader is the storage form of block header.
+type rlpHeader struct {
+	Header types.Header
+	Nils   uint64
+}
+
+// rlpBlock is the storage form of block.
+type rlpBlock struct {
+	Header       rlpHeader
+	Transactions []rlpTransaction
+	HeaderHash   types.Hash
+	Nils         uint64
+}
+
+// rlpReceipt is the storage form of receipt.
+type rlpReceipt struct {
+	PostState         []byte
+	Status            uint64
+	CumulativeGasUsed uint64
+	Bloom             types.Bloom
+	Logs              []rlpLog
+	TxHash            types.Hash
+	ContractAddress   types.Address
+	GasUsed           uint64
+	Nils              uint64
+}
+
+// rlpLog is the storage form of receipt log.
+type rlpLog struct {
+	Address     types.Address
+	Topics      []types.Hash
+	Data        []byte
+	BlockNumber uint64
+	TxHash      types.Hash
+	TxIndex     uint64
+	BlockHash   types.Hash
+	Index       uint64
+	Removed     uint64
+	Nils        uint64
+}
+
+// toRLP convert the entity to storage form, the entity without storage form is returned as it is.
+func toRLP(entity interface{}) interface{} {
+	if converter, ok := entity.(RLPConverter); ok {
+		entity = converter.ToRLP()
+	}
+	switch e := entity.(type) {
+	case *types.Block:
+		return toRLPBlock(e)
+	case *types.Header:
+		return toRLPHeader(e)
+	case []*types.Transaction:
+		return toRLPTransactions(e)
+	case *[]*types.Transaction:
+		return toRLPTransactions(*e)
+	case []*types.Receipt:
+		return toRLPReceipts(e)
+	case *[]*types.Receipt:
+		return toRLPReceipts(*e)
+	default:
+		return entity
+	}
+}
+
+// fromRLP decode the entity by decode, the entity with storage form is restored from it.
+func fromRLP(entity interface{}, decode func(value interface{}) error) error {
+	if converter, ok := entity.(RLPConverter); ok {
+		return converter.FromRLP(func(value interface{}) error {
+			return fromRLP(value, decode)
+		})
+	}
+	switch e := entity.(type) {
+	case *types.Block:
+		var form rlpBlock
+		if err := decode(&form); err != nil {
+			return err
+		}
+		*e = *form.block()
+	case *types.Header:
+		var form rlpHeader
+		if err := decode(&form); err != nil {
+			return err
+		}
+		*e = *form.header()
+	case *[]*types.Transaction:
+		var forms []rlpTransaction
+		if err := decode(&forms); err != nil {
+			return err
+		}
+		*e = fromRLPTransactions(forms)
+	case *[]*types.Receipt:
+		var forms []rlpReceipt
+		if err := decode(&forms); err != nil {
+			return err
+		}
+		*e = fromRLPReceipts(forms)
+	default:
+		return decode(entity)
+	}
+	return nil
+}
+
+func toRLPBlock(block *types.Block) *rlpBlock {
+	form := &rlpBlock{
+		Transactions: toRLPTransactions(block.Transactions),
+		HeaderHash:   block.HeaderHash,
+	}
+	if block.Header == nil {
+		form.Nils |= nilHeader
+	} else {
+		form.Header = *toRLPHeader(block.Header)
+	}
+	if block.Transactions == nil {
+		form.Nils |= nilTransactions
+	}
+	return form
+}
+
+func (form *rlpBlock) block() *types.Block {
+	block := &types.Block{
+		Transactions: fromRLPTransactions(form.Transactions),
+		HeaderHash:   form.HeaderHash,
+	}
+	if form.Nils&nilHeader == 0 {
+		block.Header = form.Header.header()
+	}
+	if form.Nils&nilTransactions != 0 {
+		block.Transactions = nil
+	}
+	return block
+}
+
+func toRLPHeader(header *types.Header) *rlpHeader {
+	form := &rlpHeader{Header: *header}
+	if header.SigData == nil {
+		form.Nils |= nilSigData
+	}
+	return form
+}
+
+func (form *rlpHeader) header() *types.Header {
+	header := form.Header
+	if form.Nils&nilSigData != 0 {
+		header.SigData = nil
+	}
+	return &header
+}
+
+// toRLPTransactions convert the transactions to storage forms, the nil transaction is stored as zero value.
+func toRLPTransactions(txs []*types.Transaction) []rlpTransaction {
+	forms := make([]rlpTransaction, len(txs))
+	for i, tx := range txs {
+		if tx != nil {
+			forms[i] = toRLPTransaction(tx)
+		}
+	}
+	return forms
+}
+
+func fromRLPTransactions(forms []rlpTransaction) []*types.Transaction {
+	txs := make([]*types.Transaction, len(forms))
+	for i := range forms {
+		txs[i] = forms[i].transaction()
+	}
+	return txs
+}
+
+func toRLPTransaction(tx *types.Transaction) rlpTransaction {
+	form := rlpTransaction{Data: tx.Data}
+	data := &form.Data
+	for flag, x := range bigIntFields(data) {
+		if *x == nil {
+			*x = new(big.Int)
+			form.Nils |= flag
+		}
+	}
+	for flag, addr := range addressFields(data) {
+		if *addr == nil {
+			*addr = &types.Address{}
+			form.Nils |= flag
+		}
+	}
+	if data.Hash == nil {
+		data.Hash = &types.Hash{}
+		form.Nils |= nilHash
+	}
+	if data.Payload == nil {
+		form.Nils |= nilPayload
+	}
+	return form
+}
+
+func (form *rlpTransaction) transaction() *types.Transaction {
+	tx := &types.Transaction{Data: form.Data}
+	data := &tx.Data
+	for flag, x := range bigIntFields(data) {
+		if form.Nils&flag != 0 {
+			*x = nil
+		}
+	}
+	for flag, addr := range addressFields(data) {
+		if form.Nils&flag != 0 {
+			*addr = nil
+		}
+	}
+	if form.Nils&nilHash != 0 {
+		data.Hash = nil
+	}
+	if form.Nils&nilPayload != 0 {
+		data.Payload = nil
+	}
+	return tx
+}
+
+// bigIntFields get the big int fields of transaction data by their nil flags.
+func bigIntFields(data *types.TxData) map[uint64]**big.Int {
+	return map[uint64]**big.Int{nilPrice: &data.Price, nilAmount: &data.Amount, nilV: &data.V, nilR: &data.R, nilS: &data.S}
+}
+
+// addressFields get the address fields of transaction data by their nil flags.
+func addressFields(data *types.TxData) map[uint64]**types.Address {
+	return map[uint64]**types.Address{nilRecipient: &data.Recipient, nilFrom: &data.From}
+}
+
+// toRLPReceipts convert the receipts to storage forms, the nil receipt or log is stored as zero value.
+func toRLPReceipts(receipts []*types.Receipt) []rlpReceipt {
+	forms := make([]rlpReceipt, len(receipts))
+	for i, receipt := range receipts {
+		if receipt == nil {
+			continue
+		}
+		form := rlpReceipt{
+			PostState:         receipt.PostState,
+			Status:            receipt.Status,
+			CumulativeGasUsed: receipt.CumulativeGasUsed,
+			Bloom:             receipt.Bloom,
+			Logs:              make([]rlpLog, len(receipt.Logs)),
+			TxHash:            receipt.TxHash,
+			ContractAddress:   receipt.ContractAddress,
+			GasUsed:           receipt.GasUsed,
+		}
+		if receipt.PostState == nil {
+			form.Nils |= nilPostState
+		}
+		if receipt.Logs == nil {
+			form.Nils |= nilLogs
+		}
+		for j, log := range receipt.Logs {
+			if log != nil {
+				form.Logs[j] = toRLPLog(log)
+			}
+		}
+		forms[i] = form
+	}
+	return forms
+}
+
+func fromRLPReceipts(forms []rlpReceipt) []*types.Receipt {
+	receipts := make([]*types.Receipt, len(forms))
+	for i, form := range forms {
+		receipt := &types.Receipt{
+			PostState:         form.PostState,
+			Status:            form.Status,
+			CumulativeGasUsed: form.CumulativeGasUsed,
+			Bloom:             form.Bloom,
+			Logs:              make([]*types.Log, len(form.Logs)),
+			TxHash:            form.TxHash,
+			ContractAddress:   form.ContractAddress,
+			GasUsed:           form.GasUsed,
+		}
+		if form.Nils&nilPostState != 0 {
+			receipt.PostState = nil
+		}
+		for j := range form.Logs {
+			receipt.Logs[j] = form.Logs[j].log()
+		}
+		if form.Nils&nilLogs != 0 {
+			receipt.Logs = nil
+		}
+		receipts[i] = receipt
+	}
+	return receipts
+}
+
+func toRLPLog(log *types.Log) rlpLog {
+	form := rlpLog{
+		Address:     log.Address,
+		Topics:      log.Topics,
+		Data:        log.Data,
+		BlockNumber: log.BlockNumber,
+		TxHash:      log.TxHash,
+		TxIndex:     uint64(log.TxIndex),
+		BlockHash:   log.BlockHash,
+		Index:       uint64(log.Index),
+	}
+	if log.Removed {
+		form.Removed = 1
+	}
+	if log.Topics == nil {
+		form.Nils |= nilTopics
+	}
+	if log.Data == nil {
+		form.Nils |= nilData
+	}
+	return form
+}
+
+func (form *rlpLog) log() *types.Log {
+	log := &types.Log{
+		Address:     form.Address,
+		Topics:      form.Topics,
+		Data:        form.Data,
+		BlockNumber: form.BlockNumber,
+		TxHash:      form.TxHash,
+		TxIndex:     uint(form.TxIndex),
+		BlockHash:   form.BlockHash,
+		Index:       uint(form.Index),
+		Removed:     form.Removed != 0,
+	}
+	if form.Nils&nilTopics != 0 {
+		log.Topics = nil
+	}
+	if form.Nils&nilData != 0 {
+		log.Data = nil
+	}
+	return log
+}
@@ -0,0 +1,46 @@
+package common
+
+import "github.com/DSiSc/craft/types"
+
+// MerkleRoot calculate the root of the binary merkle tree built from hashes, the last hash of a level
+// with odd number of hashes is paired with itself. Root of empty hashes is the empty hash.
+func MerkleRoot(hashes []types.Hash) types.Hash {
+	if len(hashes) == 0 {
+		return types.Hash{}
+	}
+	level := append([]types.Hash{}, hashes...)
+	for len(level) > 1 {
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+		next := make([]types.Hash, len(level)/2)
+		for i := range next {
+			hw := HashAlg()
+			hw.Write(level[2*i][:])
+			hw.Write(level[2*i+1][:])
+			hw.Sum(next[i][:0])
+		}
+		level = next
+	}
+	return level[0]
+}
+
+// TxRoot calculate the merkle root of the transactions' hashes, it is the default transaction root of strict
+// validation.
+func TxRoot(txs []*types.Transaction) types.Hash {
+	hashes := make([]types.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = TxHash(tx)
+	}
+	return MerkleRoot(hashes)
+}
+
+// ReceiptsRoot calculate the merkle root of the receipts' hashes, it is the default receipts root of strict
+// validation.
+func ReceiptsRoot(receipts []*types.Receipt) types.Hash {
+	hashes := make([]types.Hash, len(receipts))
+	for i, receipt := range receipts {
+		hashes[i] = rlpHash(receipt)
+	}
+	return MerkleRoot(hashes)
+}
@@ -0,0 +1,31 @@
+package common
+
+import (
+	"github.com/DSiSc/craft/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// test calculate merkle root
+func TestMerkleRoot(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(types.Hash{}, MerkleRoot(nil))
+	hash1 := HexToHash("0x01")
+	hash2 := HexToHash("0x02")
+	hash3 := HexToHash("0x03")
+	assert.Equal(hash1, MerkleRoot([]types.Hash{hash1}))
+
+	root := MerkleRoot([]types.Hash{hash1, hash2, hash3})
+	assert.NotEqual(types.Hash{}, root)
+	assert.Equal(root, MerkleRoot([]types.Hash{hash1, hash2, hash3, hash3}))
+	assert.NotEqual(root, MerkleRoot([]types.Hash{hash2, hash1, hash3}))
+}
+
+// test calculate receipts root
+func TestReceiptsRoot(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(types.Hash{}, ReceiptsRoot(nil))
+	receipts := []*types.Receipt{{Status: 1}, {Status: 0}}
+	assert.Equal(ReceiptsRoot(receipts), ReceiptsRoot(receipts))
+	assert.NotEqual(ReceiptsRoot(receipts), ReceiptsRoot(receipts[:1]))
+}
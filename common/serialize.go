@@ -54,3 +54,24 @@ func WriteVarBytes(writer io.Writer, value []byte) error {
 	_, err = writer.Write(value)
 	return err
 }
+
+func ReadVarUint(reader io.Reader) (uint64, error) {
+	var buf [8]byte
+	_, err := io.ReadFull(reader, buf[:1])
+	if err != nil {
+		return 0, err
+	}
+	switch buf[0] {
+	case 0xFD:
+		_, err = io.ReadFull(reader, buf[:2])
+		return uint64(binary.LittleEndian.Uint16(buf[:2])), err
+	case 0xFE:
+		_, err = io.ReadFull(reader, buf[:4])
+		return uint64(binary.LittleEndian.Uint32(buf[:4])), err
+	case 0xFF:
+		_, err = io.ReadFull(reader, buf[:8])
+		return binary.LittleEndian.Uint64(buf[:8]), err
+	default:
+		return uint64(buf[0]), nil
+	}
+}
@@ -20,3 +20,17 @@ func TestReadWriteInt(t *testing.T) {
 	WriteVarUint(b3, a2)
 	WriteVarBytes(b4, a3)
 }
+
+func TestReadVarUint(t *testing.T) {
+	for _, value := range []uint64{0, 0xFC, 0xFD, 0xFFFF, 0x10000, 0xFFFFFFFF, 0x100000000} {
+		b := new(bytes.Buffer)
+		WriteVarUint(b, value)
+		readValue, err := ReadVarUint(b)
+		if err != nil || readValue != value {
+			t.Errorf("ReadVarUint error %d != %d, %v", readValue, value, err)
+		}
+	}
+	if _, err := ReadVarUint(bytes.NewBuffer([]byte{0xFD, 0x01})); err == nil {
+		t.Errorf("ReadVarUint should fail with truncated value")
+	}
+}
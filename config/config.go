@@ -1,6 +1,73 @@
 package config
 
+import "github.com/DSiSc/craft/types"
+
 type BlockStoreConfig struct {
 	PluginName string
 	DataPath   string
+	// Open the database in read-only mode, such as a copy of a running node's database. The writes return
+	// dbstore.ErrReadOnly and nothing is written during startup, so async write, pruning and freezing are
+	// disabled. The database and freezer must exist.
+	ReadOnly bool
+	// Codec used to encode the entities of a new database, json will be used if not set.
+	Codec string
+	// Only store block headers, used by light nodes.
+	HeadersOnly bool
+	// Index transactions by the sender, recipient and created contract address.
+	AddressIndex bool
+	// Compression algorithm of the values written to database: none or snappy, none will be used if not set.
+	// The values are always read with decompression, so the algorithm can change without migration. The database
+	// created before compression is supported must be migrated once before compression is enabled.
+	Compression string
+	// The min size of the values to compress, 256 will be used if not set.
+	CompressionThreshold int
+	// The AES key encrypting the values in database with AES-GCM, in format <key id>:<hex key>, where key id
+	// is in [0, 255] and the key is 16, 24 or 32 bytes. Encryption is disabled if no key is supplied. The database
+	// with values written before encryption is enabled must be re-encrypted by the reencrypt tool first.
+	EncryptionKey string
+	// The file of the encryption keys, one <key id>:<hex key> per line. The keys in file are followed by
+	// EncryptionKey, the last key encrypts the written values and the others decrypt the values written
+	// before key rotation.
+	EncryptionKeyFile string
+	// The number of blocks in a section of section bloom index, section bloom index is disabled if 0.
+	BloomSectionSize uint64
+	// The number of decoded blocks, block headers, block receipts and tx lookup indexes held in caches, cache
+	// is disabled if 0. The cached blocks and headers are copied when they are returned.
+	BlockCacheSize    int
+	HeaderCacheSize   int
+	ReceiptCacheSize  int
+	TxLookupCacheSize int
+	// Queue the written blocks and commit them in background, the queued blocks are served by lookups.
+	AsyncWrite bool
+	// The capacity of the write queue in async write mode, 256 will be used if not set.
+	WriteQueueSize int
+	// Durability of the committed blocks: sync, group or nosync, nosync will be used if not set.
+	// group is only supported in async write mode.
+	Durability string
+	// The interval in milliseconds of group commit, 10 will be used if not set.
+	GroupCommitInterval int
+	// Validate the parent linkage, height continuity, transaction root and receipts of the written blocks.
+	StrictValidation bool
+	// The functions calculating the transaction root and receipts root of a block in strict validation, they
+	// must be the ones used by the chain producing the blocks. The binary merkle root of common.TxRoot and
+	// common.ReceiptsRoot will be used if not set.
+	TxRootFunc       func(txs []*types.Transaction) types.Hash
+	ReceiptsRootFunc func(receipts []*types.Receipt) types.Hash
+	// Keep the bodies, receipts and tx lookup indexes of the latest N canonical blocks, and prune the older ones
+	// in background. The block headers are always kept, pruning is disabled if 0.
+	PruneRetention uint64
+	// The directory of the freezer holding the finalized blocks in append-only flat files, freezer is disabled
+	// if not set. The frozen blocks keep the codec they are frozen with, which is recorded in freezer, migration
+	// doesn't re-encode them. The frozen blocks are neither compressed nor encrypted, so freezer can't be enabled
+	// along with encryption.
+	FreezerPath string
+	// Keep the latest N canonical blocks in database, and move the older ones to freezer in background.
+	// 90000 will be used if not set.
+	FreezerFinality uint64
+	// Collect the counters, latency histograms and gauges of the block store operations and the database,
+	// which are exposed by BlockStore.Metrics.
+	Metrics bool
+	// The listen address of the local http server serving the metrics at /metrics in the Prometheus text
+	// format, such as 127.0.0.1:9100. The server is disabled if not set, metrics is enabled if it is set.
+	MetricsAddress string
 }
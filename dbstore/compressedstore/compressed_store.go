@@ -0,0 +1,185 @@
+package compressedstore
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/golang/snappy"
+)
+
+const (
+	// no compression, the values are written raw
+	NONE = "none"
+	// snappy compression
+	SNAPPY = "snappy"
+	// the default min size of the values to compress
+	DEFAULT_THRESHOLD = 256
+)
+
+// algorithm ids recorded in the header of compressed values
+const (
+	// escapes the raw value starting with header magic
+	rawAlgorithm    byte = 0
+	snappyAlgorithm byte = 1
+)
+
+// headerMagic starts the header of compressed values, followed by the algorithm id. The values written raw
+// have no header, so the values written before compression is enabled are still readable once the database
+// is formatted. The raw value starting with header magic is written with the raw algorithm header, so it is
+// not mistaken for a header.
+var headerMagic = []byte{0xff, 0xfe}
+
+// CompressedStore wraps a database to compress the values not smaller than the threshold, the values are
+// decompressed transparently by all reads. Compressed and raw values coexist, so the algorithm and threshold
+// can change at any time, the values written with compression are still readable with NONE. The database
+// must be formatted by Format before wrapped.
+type CompressedStore struct {
+	store     dbstore.DBStore
+	algorithm byte
+	threshold int
+}
+
+// NewCompressedStore wrap the database with the compression algorithm, DEFAULT_THRESHOLD will be used if
+// threshold is not positive. The values are not compressed if algorithm is NONE or empty.
+func NewCompressedStore(store dbstore.DBStore, algorithm string, threshold int) (*CompressedStore, error) {
+	compressedStore := &CompressedStore{
+		store:     store,
+		threshold: threshold,
+	}
+	switch algorithm {
+	case "", NONE:
+	case SNAPPY:
+		compressedStore.algorithm = snappyAlgorithm
+	default:
+		return nil, fmt.Errorf("Not support compression algorithm %s", algorithm)
+	}
+	if compressedStore.threshold <= 0 {
+		compressedStore.threshold = DEFAULT_THRESHOLD
+	}
+	return compressedStore, nil
+}
+
+// Put save the value compressed if it is large enough.
+func (s *CompressedStore) Put(key []byte, value []byte) error {
+	return s.store.Put(key, s.compress(value))
+}
+
+// Get get the decompressed value from database.
+func (s *CompressedStore) Get(key []byte) ([]byte, error) {
+	value, err := s.store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return decompress(value)
+}
+
+func (s *CompressedStore) Delete(key []byte) error {
+	return s.store.Delete(key)
+}
+
+func (s *CompressedStore) NewIteratorWithPrefix(prefix []byte, start []byte) dbstore.Iterator {
+	return &iterator{Iterator: s.store.NewIteratorWithPrefix(prefix, start)}
+}
+
+func (s *CompressedStore) NewBatch() dbstore.Batch {
+	return &batch{Batch: s.store.NewBatch(), store: s}
+}
+
+// Snapshot take a snapshot of the database, which decompresses the values it reads.
+func (s *CompressedStore) Snapshot() (dbstore.DBSnapshot, error) {
+	snap, err := s.store.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot{DBSnapshot: snap}, nil
+}
+
+func (s *CompressedStore) Close() error {
+	return s.store.Close()
+}
+
+// compress compress the value not smaller than threshold, the value is kept raw if compression doesn't make it
+// smaller. The raw value starting with header magic is escaped with the raw algorithm header.
+func (s *CompressedStore) compress(value []byte) []byte {
+	if s.algorithm != rawAlgorithm && len(value) >= s.threshold {
+		compressed := append(append([]byte{}, headerMagic...), s.algorithm)
+		compressed = append(compressed, snappy.Encode(nil, value)...)
+		if len(compressed) < len(value) {
+			return compressed
+		}
+	}
+	if bytes.HasPrefix(value, headerMagic) {
+		return escape(value)
+	}
+	return value
+}
+
+// decompress decompress the value with header, the value without a valid header is returned as it is.
+// ErrCorrupted is returned if the value with a valid header can not be decompressed.
+func decompress(value []byte) ([]byte, error) {
+	if len(value) <= len(headerMagic) || !bytes.HasPrefix(value, headerMagic) {
+		return value, nil
+	}
+	payload := value[len(headerMagic)+1:]
+	switch value[len(headerMagic)] {
+	case rawAlgorithm:
+		return payload, nil
+	case snappyAlgorithm:
+		decoded, err := snappy.Decode(nil, payload)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decompress value, as: %v", dbstore.ErrCorrupted, err)
+		}
+		return decoded, nil
+	default:
+		return value, nil
+	}
+}
+
+// batch compress the values put to the wrapped batch.
+type batch struct {
+	dbstore.Batch
+	store *CompressedStore
+}
+
+func (b *batch) Put(key, value []byte) error {
+	return b.Batch.Put(key, b.store.compress(value))
+}
+
+// iterator decompress the values of the wrapped iterator.
+type iterator struct {
+	dbstore.Iterator
+	err error
+}
+
+// Value return nil if the value can not be decompressed, the error is reported by Error.
+func (iter *iterator) Value() []byte {
+	value, err := decompress(iter.Iterator.Value())
+	if err != nil && iter.err == nil {
+		iter.err = err
+	}
+	return value
+}
+
+func (iter *iterator) Error() error {
+	if iter.err != nil {
+		return iter.err
+	}
+	return iter.Iterator.Error()
+}
+
+// snapshot decompress the values read from the wrapped snapshot.
+type snapshot struct {
+	dbstore.DBSnapshot
+}
+
+func (snap *snapshot) Get(key []byte) ([]byte, error) {
+	value, err := snap.DBSnapshot.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return decompress(value)
+}
+
+func (snap *snapshot) NewIteratorWithPrefix(prefix []byte, start []byte) dbstore.Iterator {
+	return &iterator{Iterator: snap.DBSnapshot.NewIteratorWithPrefix(prefix, start)}
+}
@@ -0,0 +1,192 @@
+package compressedstore
+
+import (
+	"bytes"
+	"errors"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/blockstore/dbstore/memorystore"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var (
+	key        = []byte("hello")
+	largeValue = bytes.Repeat([]byte("world"), 100)
+	smallValue = []byte("world")
+)
+
+// test new compressed store
+func TestNewCompressedStore(t *testing.T) {
+	assert := assert.New(t)
+	store, err := NewCompressedStore(memorystore.NewMemDBStore(), SNAPPY, 0)
+	assert.Nil(err)
+	assert.Equal(DEFAULT_THRESHOLD, store.threshold)
+	_, err = NewCompressedStore(memorystore.NewMemDBStore(), "zip", 0)
+	assert.NotNil(err)
+}
+
+// test the values above threshold are compressed
+func TestCompressedStore_PutAndGet(t *testing.T) {
+	assert := assert.New(t)
+	memDB := memorystore.NewMemDBStore()
+	store, err := NewCompressedStore(memDB, SNAPPY, 100)
+	assert.Nil(err)
+	assert.Nil(store.Put(key, largeValue))
+	assert.Nil(store.Put([]byte("small"), smallValue))
+
+	raw, err := memDB.Get(key)
+	assert.Nil(err)
+	assert.True(len(raw) < len(largeValue))
+	raw, err = memDB.Get([]byte("small"))
+	assert.Nil(err)
+	assert.Equal(smallValue, raw)
+
+	value, err := store.Get(key)
+	assert.Nil(err)
+	assert.Equal(largeValue, value)
+	value, err = store.Get([]byte("small"))
+	assert.Nil(err)
+	assert.Equal(smallValue, value)
+	assert.Nil(store.Delete(key))
+	_, err = store.Get(key)
+	assert.True(errors.Is(err, dbstore.ErrNotFound))
+}
+
+// test compressed and raw values coexist after the algorithm changes
+func TestCompressedStore_ChangeAlgorithm(t *testing.T) {
+	assert := assert.New(t)
+	memDB := memorystore.NewMemDBStore()
+	assert.Nil(memDB.Put([]byte("legacy"), largeValue))
+	store, err := NewCompressedStore(memDB, SNAPPY, 0)
+	assert.Nil(err)
+	assert.Nil(store.Put(key, largeValue))
+
+	store, err = NewCompressedStore(memDB, NONE, 0)
+	assert.Nil(err)
+	assert.Nil(store.Put([]byte("raw"), largeValue))
+	raw, err := memDB.Get([]byte("raw"))
+	assert.Nil(err)
+	assert.Equal(largeValue, raw)
+	for _, k := range []string{"legacy", "hello", "raw"} {
+		value, err := store.Get([]byte(k))
+		assert.Nil(err)
+		assert.Equal(largeValue, value)
+	}
+
+	// the raw value looking like a header is kept intact
+	magicValue := append(append([]byte{}, headerMagic...), snappyAlgorithm, 1, 2)
+	assert.Nil(store.Put([]byte("magic"), magicValue))
+	value, err := store.Get([]byte("magic"))
+	assert.Nil(err)
+	assert.Equal(magicValue, value)
+	raw, err = memDB.Get([]byte("magic"))
+	assert.Nil(err)
+	assert.Equal(append(append([]byte{}, headerMagic...), rawAlgorithm), raw[:len(headerMagic)+1])
+
+	// the small value looking like a header is escaped too
+	store, err = NewCompressedStore(memDB, SNAPPY, 100)
+	assert.Nil(err)
+	assert.Nil(store.Put([]byte("magic"), magicValue))
+	value, err = store.Get([]byte("magic"))
+	assert.Nil(err)
+	assert.Equal(magicValue, value)
+}
+
+// test the value with a valid header which can not be decompressed
+func TestCompressedStore_Corrupted(t *testing.T) {
+	assert := assert.New(t)
+	memDB := memorystore.NewMemDBStore()
+	store, err := NewCompressedStore(memDB, SNAPPY, 0)
+	assert.Nil(err)
+	corrupted := append(append([]byte{}, headerMagic...), snappyAlgorithm, 0xff, 0xff, 0xff)
+	assert.Nil(memDB.Put(key, corrupted))
+
+	_, err = store.Get(key)
+	assert.True(errors.Is(err, dbstore.ErrCorrupted))
+	snap, err := store.Snapshot()
+	assert.Nil(err)
+	_, err = snap.Get(key)
+	assert.True(errors.Is(err, dbstore.ErrCorrupted))
+	snap.Release()
+
+	iter := store.NewIteratorWithPrefix(key, nil)
+	assert.True(iter.Next())
+	assert.Nil(iter.Value())
+	assert.True(errors.Is(iter.Error(), dbstore.ErrCorrupted))
+	iter.Release()
+}
+
+// test batch, iterator and snapshot of compressed store
+func TestCompressedStore_BatchIteratorAndSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	memDB := memorystore.NewMemDBStore()
+	store, err := NewCompressedStore(memDB, SNAPPY, 0)
+	assert.Nil(err)
+	batch := store.NewBatch()
+	assert.Nil(batch.Put([]byte("k1"), largeValue))
+	assert.Nil(batch.Put([]byte("k2"), smallValue))
+	assert.Nil(batch.Write())
+	raw, err := memDB.Get([]byte("k1"))
+	assert.Nil(err)
+	assert.NotEqual(largeValue, raw)
+
+	iter := store.NewIteratorWithPrefix([]byte("k"), nil)
+	values := make([][]byte, 0)
+	for iter.Next() {
+		values = append(values, append([]byte{}, iter.Value()...))
+	}
+	iter.Release()
+	assert.Nil(iter.Error())
+	assert.Equal([][]byte{largeValue, smallValue}, values)
+
+	snapshot, err := store.Snapshot()
+	assert.Nil(err)
+	defer snapshot.Release()
+	assert.Nil(store.Put([]byte("k1"), smallValue))
+	value, err := snapshot.Get([]byte("k1"))
+	assert.Nil(err)
+	assert.Equal(largeValue, value)
+	snapIter := snapshot.NewIteratorWithPrefix([]byte("k1"), nil)
+	assert.True(snapIter.Next())
+	assert.Equal(largeValue, snapIter.Value())
+	snapIter.Release()
+}
+
+// test format the database with the raw values looking like compressed values
+func TestCompressedStore_Format(t *testing.T) {
+	assert := assert.New(t)
+	memDB := memorystore.NewMemDBStore()
+	empty, err := Empty(memDB)
+	assert.Nil(err)
+	assert.True(empty)
+	escaped := append(append([]byte{}, headerMagic...), rawAlgorithm, 1)
+	legacy := append(append([]byte{}, headerMagic...), snappyAlgorithm, 2)
+	assert.Nil(memDB.Put([]byte("a"), escape(escaped)))
+	assert.Nil(memDB.Put([]byte("b"), legacy))
+	assert.Nil(memDB.Put([]byte("c"), smallValue))
+	// resume the format interrupted after escaping "a"
+	assert.Nil(memDB.Put([]byte(formatCheckpointKey), []byte("a")))
+	formatted, err := Formatted(memDB)
+	assert.Nil(err)
+	assert.False(formatted)
+
+	count, err := Format(memDB)
+	assert.Nil(err)
+	assert.Equal(uint64(1), count)
+	formatted, err = Formatted(memDB)
+	assert.Nil(err)
+	assert.True(formatted)
+	_, err = memDB.Get([]byte(formatCheckpointKey))
+	assert.True(errors.Is(err, dbstore.ErrNotFound))
+	count, err = Format(memDB)
+	assert.Nil(err)
+	assert.Equal(uint64(0), count)
+
+	store, err := NewCompressedStore(memDB, SNAPPY, 0)
+	assert.Nil(err)
+	for k, v := range map[string][]byte{"a": escaped, "b": legacy, "c": smallValue} {
+		storedValue, err := store.Get([]byte(k))
+		assert.Nil(err)
+		assert.Equal(v, storedValue)
+	}
+}
@@ -0,0 +1,114 @@
+package compressedstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/DSiSc/blockstore/dbstore"
+)
+
+// formatKey records that the database is in the compressed store format, where the raw values starting with
+// header magic are escaped. The values of a database without the record are all raw, and some of them, such
+// as hashes, may start with header magic, so the database must be formatted before wrapped.
+const formatKey = "CompressionFormat"
+
+// formatCheckpointKey records the last escaped key of an unfinished format.
+const formatCheckpointKey = "CompressionFormatCheckpoint"
+
+// Formatted check whether the database is in the compressed store format.
+func Formatted(store dbstore.DBStore) (bool, error) {
+	_, err := store.Get([]byte(formatKey))
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, dbstore.ErrNotFound) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to load compression format record, as: %w", err)
+}
+
+// Empty check whether the database has no record, an empty database can be formatted at once.
+func Empty(store dbstore.DBStore) (bool, error) {
+	iter := store.NewIteratorWithPrefix(nil, nil)
+	defer iter.Release()
+	empty := !iter.Next()
+	if err := iter.Error(); err != nil {
+		return false, fmt.Errorf("failed to iterate database records, as: %w", err)
+	}
+	return empty, nil
+}
+
+// Format escape the raw values starting with header magic, then record the database is in the compressed store
+// format. It is a no-op for a formatted database, and an interrupted format is resumed from the checkpoint
+// committed with each batch. Return the number of escaped values.
+func Format(store dbstore.DBStore) (uint64, error) {
+	formatted, err := Formatted(store)
+	if err != nil || formatted {
+		return 0, err
+	}
+	snap, err := store.Snapshot()
+	if err != nil {
+		return 0, fmt.Errorf("failed to take database snapshot, as: %w", err)
+	}
+	defer snap.Release()
+	var start []byte
+	checkpoint, err := snap.Get([]byte(formatCheckpointKey))
+	if err == nil {
+		start = append(checkpoint, 0)
+	} else if !errors.Is(err, dbstore.ErrNotFound) {
+		return 0, fmt.Errorf("failed to load compression format checkpoint, as: %w", err)
+	}
+
+	var count uint64
+	batch := store.NewBatch()
+	batchSize := 0
+	iter := snap.NewIteratorWithPrefix(nil, start)
+	defer iter.Release()
+	for iter.Next() {
+		value := iter.Value()
+		if !bytes.HasPrefix(value, headerMagic) || bytes.Equal(iter.Key(), []byte(formatCheckpointKey)) {
+			continue
+		}
+		key := append([]byte{}, iter.Key()...)
+		err = batch.Put(key, escape(value))
+		if err != nil {
+			return count, err
+		}
+		count++
+		batchSize += len(key) + len(value) + len(headerMagic) + 1
+		if batchSize < dbstore.MaxBatchSize {
+			continue
+		}
+		err = batch.Put([]byte(formatCheckpointKey), key)
+		if err != nil {
+			return count, err
+		}
+		err = batch.Write()
+		if err != nil {
+			return count, fmt.Errorf("failed to write escaped values, as: %w", err)
+		}
+		batch.Reset()
+		batchSize = 0
+	}
+	if err := iter.Error(); err != nil {
+		return count, fmt.Errorf("failed to iterate database records, as: %w", err)
+	}
+	err = batch.Put([]byte(formatKey), []byte{1})
+	if err != nil {
+		return count, err
+	}
+	err = batch.Delete([]byte(formatCheckpointKey))
+	if err != nil {
+		return count, err
+	}
+	err = batch.WriteSync()
+	if err != nil {
+		return count, fmt.Errorf("failed to write escaped values, as: %w", err)
+	}
+	return count, nil
+}
+
+// escape escape the raw value with the raw algorithm header.
+func escape(value []byte) []byte {
+	return append(append(append([]byte{}, headerMagic...), rawAlgorithm), value...)
+}
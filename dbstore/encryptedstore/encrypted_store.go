@@ -0,0 +1,354 @@
+package encryptedstore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/DSiSc/blockstore/dbstore"
+)
+
+// headerMagic starts the header of encrypted values, followed by the id of the key encrypting the value and
+// the nonce. The values without header are plaintext written before encryption is enabled, they are only
+// readable by the migration store.
+var headerMagic = []byte{0xff, 0xfd}
+
+// sealedKey records that all values of the database are encrypted, it is written when encryption is enabled on
+// an empty database or all plaintext values are re-encrypted.
+const sealedKey = "EncryptionSealed"
+
+// EncryptedStore wraps a database to encrypt all written values with AES-GCM by the current key, the values
+// are decrypted transparently by all reads with the key recorded in their header. The record key is
+// authenticated along with the value, so an encrypted value can't be moved to another record.
+//
+// The value failing to decrypt is ErrCorrupted, so is the value without header. The database with plaintext
+// values written before encryption is enabled must be sealed by Reencrypt of the migration store first.
+type EncryptedStore struct {
+	store     dbstore.DBStore
+	ciphers   map[byte]cipher.AEAD
+	current   byte
+	sealed    bool
+	migration bool
+}
+
+// NewEncryptedStore wrap the sealed or empty database with the keys, the last key encrypts the written values
+// and the others decrypt the values written before key rotation.
+func NewEncryptedStore(store dbstore.DBStore, keys []*Key) (*EncryptedStore, error) {
+	encryptedStore, err := newEncryptedStore(store, keys, false)
+	if err != nil {
+		return nil, err
+	}
+	if encryptedStore.sealed {
+		return encryptedStore, nil
+	}
+	empty, err := encryptedStore.empty()
+	if err != nil {
+		return nil, err
+	}
+	if !empty {
+		return nil, fmt.Errorf("database has plaintext values written before encryption is enabled, please re-encrypt it first")
+	}
+	return encryptedStore, nil
+}
+
+// NewMigrationEncryptedStore wrap the database with the keys for Reencrypt. Until the database is sealed, the
+// value without header or failing to decrypt is read as plaintext, as the plaintext values written before
+// encryption is enabled may start with the header magic.
+func NewMigrationEncryptedStore(store dbstore.DBStore, keys []*Key) (*EncryptedStore, error) {
+	return newEncryptedStore(store, keys, true)
+}
+
+// newEncryptedStore wrap the database with the keys and load the seal.
+func newEncryptedStore(store dbstore.DBStore, keys []*Key, migration bool) (*EncryptedStore, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no encryption key")
+	}
+	encryptedStore := &EncryptedStore{
+		store:     store,
+		ciphers:   make(map[byte]cipher.AEAD),
+		migration: migration,
+	}
+	secrets := make(map[byte][]byte)
+	for _, key := range keys {
+		if secret, ok := secrets[key.ID]; ok && !bytes.Equal(secret, key.Secret) {
+			return nil, fmt.Errorf("different encryption keys with the same id %d", key.ID)
+		}
+		block, err := aes.NewCipher(key.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key %d, as: %v", key.ID, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key %d, as: %v", key.ID, err)
+		}
+		secrets[key.ID] = key.Secret
+		encryptedStore.ciphers[key.ID] = aead
+		encryptedStore.current = key.ID
+	}
+	err := encryptedStore.loadSealed()
+	if err != nil {
+		return nil, err
+	}
+	return encryptedStore, nil
+}
+
+// loadSealed check whether all values of the database are encrypted, the empty database is sealed at once.
+func (s *EncryptedStore) loadSealed() error {
+	_, err := s.store.Get([]byte(sealedKey))
+	if err == nil {
+		s.sealed = true
+		return nil
+	}
+	if !errors.Is(err, dbstore.ErrNotFound) {
+		return fmt.Errorf("failed to load encryption seal, as: %w", err)
+	}
+	empty, err := s.empty()
+	if err != nil || !empty {
+		return err
+	}
+	err = s.Put([]byte(sealedKey), []byte{1})
+	if errors.Is(err, dbstore.ErrReadOnly) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to seal encrypted database, as: %w", err)
+	}
+	s.sealed = true
+	return nil
+}
+
+// empty check whether the database has no record.
+func (s *EncryptedStore) empty() (bool, error) {
+	iter := s.store.NewIteratorWithPrefix(nil, nil)
+	defer iter.Release()
+	empty := !iter.Next()
+	if err := iter.Error(); err != nil {
+		return false, fmt.Errorf("failed to iterate database records, as: %w", err)
+	}
+	return empty, nil
+}
+
+// Put save the value encrypted by the current key.
+func (s *EncryptedStore) Put(key []byte, value []byte) error {
+	encrypted, err := s.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+	return s.store.Put(key, encrypted)
+}
+
+// Get get the decrypted value from database.
+func (s *EncryptedStore) Get(key []byte) ([]byte, error) {
+	value, err := s.store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return s.decrypt(key, value)
+}
+
+func (s *EncryptedStore) Delete(key []byte) error {
+	return s.store.Delete(key)
+}
+
+func (s *EncryptedStore) NewIteratorWithPrefix(prefix []byte, start []byte) dbstore.Iterator {
+	return &iterator{Iterator: s.store.NewIteratorWithPrefix(prefix, start), store: s}
+}
+
+func (s *EncryptedStore) NewBatch() dbstore.Batch {
+	return &batch{Batch: s.store.NewBatch(), store: s}
+}
+
+// Snapshot take a snapshot of the database, which decrypts the values it reads.
+func (s *EncryptedStore) Snapshot() (dbstore.DBSnapshot, error) {
+	snap, err := s.store.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot{DBSnapshot: snap, store: s}, nil
+}
+
+func (s *EncryptedStore) Close() error {
+	return s.store.Close()
+}
+
+// Reencrypt encrypt the values not encrypted by the current key again with the current key, including the
+// plaintext values written before encryption is enabled if it is the migration store, then seal the database. The progress is called after
+// each committed batch with the number of values re-encrypted so far. Return the number of re-encrypted values.
+func (s *EncryptedStore) Reencrypt(progress func(count uint64)) (uint64, error) {
+	snap, err := s.store.Snapshot()
+	if err != nil {
+		return 0, fmt.Errorf("failed to take database snapshot, as: %w", err)
+	}
+	defer snap.Release()
+
+	var count uint64
+	batch := s.NewBatch()
+	batchSize := 0
+	iter := snap.NewIteratorWithPrefix(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		key, value := iter.Key(), iter.Value()
+		if keyID, ok := encryptedBy(value); ok && keyID == s.current {
+			if s.sealed {
+				continue
+			}
+			// the plaintext looking like encrypted by the current key is re-encrypted before sealed
+			if _, err := s.open(key, value); err == nil {
+				continue
+			}
+		}
+		key = append([]byte{}, key...)
+		plaintext, err := s.decrypt(key, value)
+		if err != nil {
+			return count, err
+		}
+		err = batch.Put(key, plaintext)
+		if err != nil {
+			return count, err
+		}
+		count++
+		batchSize += len(key) + len(value)
+		if batchSize < dbstore.MaxBatchSize {
+			continue
+		}
+		err = batch.Write()
+		if err != nil {
+			return count, fmt.Errorf("failed to write re-encrypted values, as: %w", err)
+		}
+		batch.Reset()
+		batchSize = 0
+		if progress != nil {
+			progress(count)
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return count, fmt.Errorf("failed to iterate database records, as: %w", err)
+	}
+	if !s.sealed {
+		err = batch.Put([]byte(sealedKey), []byte{1})
+		if err != nil {
+			return count, err
+		}
+	}
+	err = batch.WriteSync()
+	if err != nil {
+		return count, fmt.Errorf("failed to write re-encrypted values, as: %w", err)
+	}
+	s.sealed = true
+	if progress != nil {
+		progress(count)
+	}
+	return count, nil
+}
+
+// encrypt encrypt the value of the record key with the current key.
+func (s *EncryptedStore) encrypt(key, value []byte) ([]byte, error) {
+	aead := s.ciphers[s.current]
+	nonce := make([]byte, aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nonce, as: %v", err)
+	}
+	header := append(append(append([]byte{}, headerMagic...), s.current), nonce...)
+	return aead.Seal(header, nonce, value, key), nil
+}
+
+// decrypt decrypt the value of the record key with the key recorded in its header. The migration store returns
+// the value without header or failing to decrypt as it is before the database is sealed.
+func (s *EncryptedStore) decrypt(key, value []byte) ([]byte, error) {
+	plaintext, err := s.open(key, value)
+	if err != nil && s.migration && !s.sealed {
+		return value, nil
+	}
+	return plaintext, err
+}
+
+// open decrypt the value with header, the value without header is ErrCorrupted.
+func (s *EncryptedStore) open(key, value []byte) ([]byte, error) {
+	keyID, ok := encryptedBy(value)
+	if !ok {
+		return nil, fmt.Errorf("%w: record %x is not encrypted", dbstore.ErrCorrupted, key)
+	}
+	aead, ok := s.ciphers[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: record %x is encrypted by unknown key %d", dbstore.ErrCorrupted, key, keyID)
+	}
+	headerSize := len(headerMagic) + 1 + aead.NonceSize()
+	if len(value) < headerSize+aead.Overhead() {
+		return nil, fmt.Errorf("%w: encrypted record %x is truncated", dbstore.ErrCorrupted, key)
+	}
+	plaintext, err := aead.Open(nil, value[len(headerMagic)+1:headerSize], value[headerSize:], key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decrypt record %x, as: %v", dbstore.ErrCorrupted, key, err)
+	}
+	return plaintext, nil
+}
+
+// encryptedBy get the id of the key encrypting the value, return false if the value has no header.
+func encryptedBy(value []byte) (byte, bool) {
+	if len(value) <= len(headerMagic) || !bytes.HasPrefix(value, headerMagic) {
+		return 0, false
+	}
+	return value[len(headerMagic)], true
+}
+
+// batch encrypt the values put to the wrapped batch.
+type batch struct {
+	dbstore.Batch
+	store *EncryptedStore
+}
+
+func (b *batch) Put(key, value []byte) error {
+	encrypted, err := b.store.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+	return b.Batch.Put(key, encrypted)
+}
+
+// iterator decrypt the values of the wrapped iterator, the iteration stops at the first value failing to decrypt.
+type iterator struct {
+	dbstore.Iterator
+	store *EncryptedStore
+	value []byte
+	err   error
+}
+
+func (iter *iterator) Next() bool {
+	if iter.err != nil || !iter.Iterator.Next() {
+		return false
+	}
+	iter.value, iter.err = iter.store.decrypt(iter.Iterator.Key(), iter.Iterator.Value())
+	return iter.err == nil
+}
+
+func (iter *iterator) Value() []byte {
+	return iter.value
+}
+
+func (iter *iterator) Error() error {
+	if iter.err != nil {
+		return iter.err
+	}
+	return iter.Iterator.Error()
+}
+
+// snapshot decrypt the values read from the wrapped snapshot.
+type snapshot struct {
+	dbstore.DBSnapshot
+	store *EncryptedStore
+}
+
+func (snap *snapshot) Get(key []byte) ([]byte, error) {
+	value, err := snap.DBSnapshot.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return snap.store.decrypt(key, value)
+}
+
+func (snap *snapshot) NewIteratorWithPrefix(prefix []byte, start []byte) dbstore.Iterator {
+	return &iterator{Iterator: snap.DBSnapshot.NewIteratorWithPrefix(prefix, start), store: snap.store}
+}
@@ -0,0 +1,183 @@
+package encryptedstore
+
+import (
+	"bytes"
+	"errors"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/blockstore/dbstore/memorystore"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var (
+	key   = []byte("hello")
+	value = []byte("world")
+	key1  = &Key{ID: 1, Secret: bytes.Repeat([]byte{1}, 32)}
+	key2  = &Key{ID: 2, Secret: bytes.Repeat([]byte{2}, 16)}
+)
+
+// test new encrypted store
+func TestNewEncryptedStore(t *testing.T) {
+	assert := assert.New(t)
+	_, err := NewEncryptedStore(memorystore.NewMemDBStore(), nil)
+	assert.NotNil(err)
+	_, err = NewEncryptedStore(memorystore.NewMemDBStore(), []*Key{{ID: 1, Secret: []byte("short")}})
+	assert.NotNil(err)
+	_, err = NewEncryptedStore(memorystore.NewMemDBStore(), []*Key{key1, {ID: 1, Secret: key2.Secret}})
+	assert.NotNil(err)
+	store, err := NewEncryptedStore(memorystore.NewMemDBStore(), []*Key{key1, key2})
+	assert.Nil(err)
+	assert.Equal(byte(2), store.current)
+}
+
+// test the values are encrypted on disk and decrypted by reads
+func TestEncryptedStore_PutAndGet(t *testing.T) {
+	assert := assert.New(t)
+	memDB := memorystore.NewMemDBStore()
+	store, err := NewEncryptedStore(memDB, []*Key{key1})
+	assert.Nil(err)
+	assert.Nil(store.Put(key, value))
+	raw, err := memDB.Get(key)
+	assert.Nil(err)
+	assert.False(bytes.Contains(raw, value))
+	storedValue, err := store.Get(key)
+	assert.Nil(err)
+	assert.Equal(value, storedValue)
+
+	// the plaintext value can't be read
+	assert.Nil(memDB.Put([]byte("plain"), value))
+	_, err = store.Get([]byte("plain"))
+	assert.True(errors.Is(err, dbstore.ErrCorrupted))
+
+	// the encrypted value can't be moved to another record
+	assert.Nil(memDB.Put([]byte("moved"), raw))
+	_, err = store.Get([]byte("moved"))
+	assert.True(errors.Is(err, dbstore.ErrCorrupted))
+
+	// the value encrypted by an unknown key can't be read
+	other, err := NewEncryptedStore(memDB, []*Key{key2})
+	assert.Nil(err)
+	_, err = other.Get(key)
+	assert.True(errors.Is(err, dbstore.ErrCorrupted))
+}
+
+// test batch, iterator and snapshot of encrypted store
+func TestEncryptedStore_BatchIteratorAndSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	memDB := memorystore.NewMemDBStore()
+	store, err := NewEncryptedStore(memDB, []*Key{key1})
+	assert.Nil(err)
+	batch := store.NewBatch()
+	assert.Nil(batch.Put([]byte("k1"), value))
+	assert.Nil(batch.Put([]byte("k2"), value))
+	assert.Nil(batch.Write())
+	raw, err := memDB.Get([]byte("k1"))
+	assert.Nil(err)
+	assert.NotEqual(value, raw)
+
+	snapshot, err := store.Snapshot()
+	assert.Nil(err)
+	defer snapshot.Release()
+	storedValue, err := snapshot.Get([]byte("k1"))
+	assert.Nil(err)
+	assert.Equal(value, storedValue)
+
+	iter := store.NewIteratorWithPrefix([]byte("k"), nil)
+	count := 0
+	for iter.Next() {
+		assert.Equal(value, iter.Value())
+		count++
+	}
+	iter.Release()
+	assert.Nil(iter.Error())
+	assert.Equal(2, count)
+
+	// iteration stops at the value failing to decrypt
+	assert.Nil(memDB.Put([]byte("k2"), raw))
+	iter = snapshot.NewIteratorWithPrefix([]byte("k"), nil)
+	assert.True(iter.Next())
+	assert.True(iter.Next())
+	iter.Release()
+	iter = store.NewIteratorWithPrefix([]byte("k"), nil)
+	assert.True(iter.Next())
+	assert.False(iter.Next())
+	assert.True(errors.Is(iter.Error(), dbstore.ErrCorrupted))
+	iter.Release()
+}
+
+// test re-encrypt the values with the rotated key
+func TestEncryptedStore_Reencrypt(t *testing.T) {
+	assert := assert.New(t)
+	memDB := memorystore.NewMemDBStore()
+	assert.Nil(memDB.Put([]byte("plain"), value))
+	_, err := NewEncryptedStore(memDB, []*Key{key1})
+	assert.NotNil(err)
+	store, err := NewMigrationEncryptedStore(memDB, []*Key{key1})
+	assert.Nil(err)
+	assert.Nil(store.Put(key, value))
+	count, err := store.Reencrypt(nil)
+	assert.Nil(err)
+	assert.Equal(uint64(1), count)
+
+	// the seal is re-encrypted too
+	rotated, err := NewEncryptedStore(memDB, []*Key{key1, key2})
+	assert.Nil(err)
+	count, err = rotated.Reencrypt(nil)
+	assert.Nil(err)
+	assert.Equal(uint64(3), count)
+	count, err = rotated.Reencrypt(nil)
+	assert.Nil(err)
+	assert.Equal(uint64(0), count)
+
+	// the old key is not needed any more
+	newStore, err := NewEncryptedStore(memDB, []*Key{key2})
+	assert.Nil(err)
+	for _, k := range []string{"plain", "hello"} {
+		storedValue, err := newStore.Get([]byte(k))
+		assert.Nil(err)
+		assert.Equal(value, storedValue)
+	}
+}
+
+// test the plaintext looking like encrypted is readable by the migration store until the database is sealed
+func TestEncryptedStore_Sealed(t *testing.T) {
+	assert := assert.New(t)
+	store, err := NewEncryptedStore(memorystore.NewMemDBStore(), []*Key{key1})
+	assert.Nil(err)
+	assert.True(store.sealed)
+
+	memDB := memorystore.NewMemDBStore()
+	plain := append(append([]byte{}, headerMagic...), key1.ID, 1, 2, 3)
+	assert.Nil(memDB.Put([]byte("plain"), plain))
+	_, err = NewEncryptedStore(memDB, []*Key{key1})
+	assert.NotNil(err)
+	store, err = NewMigrationEncryptedStore(memDB, []*Key{key1})
+	assert.Nil(err)
+	assert.False(store.sealed)
+	storedValue, err := store.Get([]byte("plain"))
+	assert.Nil(err)
+	assert.Equal(plain, storedValue)
+
+	count, err := store.Reencrypt(nil)
+	assert.Nil(err)
+	assert.Equal(uint64(1), count)
+	assert.True(store.sealed)
+	storedValue, err = store.Get([]byte("plain"))
+	assert.Nil(err)
+	assert.Equal(plain, storedValue)
+
+	// the sealed database reports the corrupted values, even by the migration store
+	for _, newStore := range []func(dbstore.DBStore, []*Key) (*EncryptedStore, error){NewEncryptedStore, NewMigrationEncryptedStore} {
+		store, err = newStore(memDB, []*Key{key1})
+		assert.Nil(err)
+		assert.True(store.sealed)
+	}
+	assert.Nil(memDB.Put([]byte("plain"), plain))
+	_, err = store.Get([]byte("plain"))
+	assert.True(errors.Is(err, dbstore.ErrCorrupted))
+
+	// the database can't be opened after the seal is removed
+	assert.Nil(memDB.Delete([]byte(sealedKey)))
+	_, err = NewEncryptedStore(memDB, []*Key{key1})
+	assert.NotNil(err)
+}
@@ -0,0 +1,88 @@
+package encryptedstore
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Key is an AES key identified by the id recorded in the values it encrypts.
+type Key struct {
+	ID     byte
+	Secret []byte
+}
+
+// ParseKey parse the key in format <key id>:<hex key>, where key id is in [0, 255] and the key is 16, 24 or
+// 32 bytes for AES-128, AES-192 or AES-256.
+func ParseKey(s string) (*Key, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid encryption key format, expect <key id>:<hex key>")
+	}
+	id, err := strconv.ParseUint(parts[0], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key id %s, as: %v", parts[0], err)
+	}
+	secret, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key %d, as: %v", id, err)
+	}
+	switch len(secret) {
+	case 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("invalid encryption key %d, as: key size %d is not 16, 24 or 32 bytes", id, len(secret))
+	}
+	return &Key{ID: byte(id), Secret: secret}, nil
+}
+
+// LoadKeyFile load the keys in the file, one <key id>:<hex key> per line, the empty lines and the lines
+// starting with # are ignored. The last key is the current key.
+func LoadKeyFile(path string) ([]*Key, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open encryption key file %s, as: %v", path, err)
+	}
+	defer file.Close()
+
+	keys := make([]*Key, 0)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := ParseKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse line %d of encryption key file %s, as: %v", lineNumber, path, err)
+		}
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read encryption key file %s, as: %v", path, err)
+	}
+	return keys, nil
+}
+
+// LoadKeys load the keys in the key file followed by the key, either of them may be empty. The last key
+// is the current key.
+func LoadKeys(key, keyFile string) ([]*Key, error) {
+	keys := make([]*Key, 0)
+	if keyFile != "" {
+		fileKeys, err := LoadKeyFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, fileKeys...)
+	}
+	if key != "" {
+		parsedKey, err := ParseKey(key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, parsedKey)
+	}
+	return keys, nil
+}
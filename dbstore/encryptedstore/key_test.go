@@ -0,0 +1,50 @@
+package encryptedstore
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// test parse encryption key
+func TestParseKey(t *testing.T) {
+	assert := assert.New(t)
+	key, err := ParseKey("7:" + strings.Repeat("ab", 16))
+	assert.Nil(err)
+	assert.Equal(byte(7), key.ID)
+	assert.Equal(16, len(key.Secret))
+
+	for _, s := range []string{"", "7", "256:" + strings.Repeat("ab", 16), "1:xyz", "1:abcd"} {
+		_, err = ParseKey(s)
+		assert.NotNil(err)
+	}
+}
+
+// test load keys from key file
+func TestLoadKeys(t *testing.T) {
+	assert := assert.New(t)
+	keyFile := "./keyfile"
+	defer os.RemoveAll(keyFile)
+	content := "# rotated keys\n1:" + strings.Repeat("01", 32) + "\n\n2:" + strings.Repeat("02", 16) + "\n"
+	assert.Nil(ioutil.WriteFile(keyFile, []byte(content), 0600))
+
+	keys, err := LoadKeys("", keyFile)
+	assert.Nil(err)
+	assert.Equal(2, len(keys))
+	assert.Equal(byte(2), keys[1].ID)
+	keys, err = LoadKeys("3:"+strings.Repeat("03", 24), keyFile)
+	assert.Nil(err)
+	assert.Equal(3, len(keys))
+	assert.Equal(byte(3), keys[2].ID)
+	keys, err = LoadKeys("", "")
+	assert.Nil(err)
+	assert.Equal(0, len(keys))
+
+	assert.Nil(ioutil.WriteFile(keyFile, []byte("bad key\n"), 0600))
+	_, err = LoadKeys("", keyFile)
+	assert.NotNil(err)
+	_, err = LoadKeys("", "./missing")
+	assert.NotNil(err)
+}
@@ -0,0 +1,16 @@
+package dbstore
+
+import "errors"
+
+// The errors returned by every database backend, the block store wraps them with the context of the
+// failed lookup, so callers should check them by errors.Is.
+var (
+	// ErrNotFound is returned when the record doesn't exist in database.
+	ErrNotFound = errors.New("not found")
+	// ErrCorrupted is returned when the record or database file can not be decoded.
+	ErrCorrupted = errors.New("database corrupted")
+	// ErrClosed is returned when operating a closed database.
+	ErrClosed = errors.New("database closed")
+	// ErrReadOnly is returned when writing a database opened in read-only mode.
+	ErrReadOnly = errors.New("database is read-only")
+)
@@ -0,0 +1,96 @@
+package leveldbstore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DSiSc/blockstore/dbstore"
+	"io/ioutil"
+	"os"
+)
+
+// BackupSelector select the keys to copy from the snapshot by calling copy for each of them, the keys not in
+// the snapshot are skipped.
+type BackupSelector func(snapshot dbstore.DBSnapshot, copyKey func(key []byte) error) error
+
+// Backup copy all records to a new leveldb database in destDir from a snapshot, the store remains writable
+// during backup. The destDir must not exist or be empty.
+func (self *LevelDBStore) Backup(destDir string) error {
+	entries, err := ioutil.ReadDir(destDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read backup directory %s, as: %v", destDir, err)
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("backup directory %s is not empty", destDir)
+	}
+
+	snapshot, err := self.Snapshot()
+	if err != nil {
+		return err
+	}
+	defer snapshot.Release()
+	dest, err := NewLevelDBStore(destDir)
+	if err != nil {
+		return fmt.Errorf("failed to create backup database in %s, as: %v", destDir, err)
+	}
+	err = CopySnapshot(snapshot, dest, nil)
+	if err != nil {
+		dest.Close()
+		return err
+	}
+	return dest.Close()
+}
+
+// CopySnapshot copy the records selected from the snapshot to the destination database in batches, all records
+// are copied if selector is nil. The last batch is flushed to stable storage.
+func CopySnapshot(snapshot dbstore.DBSnapshot, dest dbstore.DBStore, selector BackupSelector) error {
+	batch := dest.NewBatch()
+	batchSize := 0
+	put := func(key, value []byte) error {
+		batch.Put(append([]byte{}, key...), append([]byte{}, value...))
+		batchSize += len(key) + len(value)
+		if batchSize < dbstore.MaxBatchSize {
+			return nil
+		}
+		err := batch.Write()
+		if err != nil {
+			return fmt.Errorf("failed to write backup records, as: %v", err)
+		}
+		batch.Reset()
+		batchSize = 0
+		return nil
+	}
+
+	if selector == nil {
+		iter := snapshot.NewIteratorWithPrefix(nil, nil)
+		defer iter.Release()
+		for iter.Next() {
+			err := put(iter.Key(), iter.Value())
+			if err != nil {
+				return err
+			}
+		}
+		if err := iter.Error(); err != nil {
+			return fmt.Errorf("failed to iterate snapshot records, as: %v", err)
+		}
+	} else {
+		err := selector(snapshot, func(key []byte) error {
+			value, err := snapshot.Get(key)
+			if errors.Is(err, dbstore.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to get snapshot record %x, as: %w", key, err)
+			}
+			return put(key, value)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err := batch.WriteSync()
+	if err != nil {
+		return fmt.Errorf("failed to write backup records, as: %v", err)
+	}
+	return nil
+}
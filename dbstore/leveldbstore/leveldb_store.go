@@ -1,31 +1,50 @@
 package leveldbstore
 
 import (
+	"fmt"
 	"github.com/DSiSc/blockstore/dbstore"
 	"github.com/DSiSc/craft/log"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/errors"
 	"github.com/syndtr/goleveldb/leveldb/filter"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"sync"
 )
 
 type LevelDBStore struct {
-	db *leveldb.DB
+	db       *leveldb.DB
+	lock     sync.RWMutex // held by operations for reading, by close for writing
+	closed   bool
+	readOnly bool // the writes return dbstore.ErrReadOnly
 }
 
 // used to compute the size of bloom filter bits array .
 // too small will lead to high false positive rate.
 const BITSPERKEY = 10
 
+// NewLevelDBStore open the leveldb in file, creating it if not exist.
 func NewLevelDBStore(file string) (*LevelDBStore, error) {
+	return openLevelDBStore(file, false)
+}
+
+// NewReadOnlyLevelDBStore open the existing leveldb in file in read-only mode, the database is neither
+// recovered nor modified, and the writes return dbstore.ErrReadOnly.
+func NewReadOnlyLevelDBStore(file string) (*LevelDBStore, error) {
+	return openLevelDBStore(file, true)
+}
+
+func openLevelDBStore(file string, readOnly bool) (*LevelDBStore, error) {
 	// default opt
 	o := opt.Options{
-		NoSync: false,
-		Filter: filter.NewBloomFilter(BITSPERKEY),
+		NoSync:   false,
+		Filter:   filter.NewBloomFilter(BITSPERKEY),
+		ReadOnly: readOnly,
 	}
 	db, err := leveldb.OpenFile(file, &o)
 
-	if _, corrupted := err.(*errors.ErrCorrupted); corrupted {
+	if _, corrupted := err.(*errors.ErrCorrupted); corrupted && !readOnly {
 		log.Error("Recover db file.")
 		db, err = leveldb.RecoverFile(file, nil)
 	}
@@ -36,52 +55,129 @@ func NewLevelDBStore(file string) (*LevelDBStore, error) {
 	}
 
 	return &LevelDBStore{
-		db: db,
+		db:       db,
+		readOnly: readOnly,
 	}, nil
 }
 
 // Put a key-value pair to leveldb
 func (self *LevelDBStore) Put(key []byte, value []byte) error {
-	return self.db.Put(key, value, nil)
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	if self.closed {
+		return dbstore.ErrClosed
+	}
+	if self.readOnly {
+		return dbstore.ErrReadOnly
+	}
+	return convertError(self.db.Put(key, value, nil))
 }
 
 // Get the value of a key from leveldb
 func (self *LevelDBStore) Get(key []byte) ([]byte, error) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	if self.closed {
+		return nil, dbstore.ErrClosed
+	}
 	value, err := self.db.Get(key, nil)
 	if err != nil {
-		if err == leveldb.ErrNotFound {
-			return nil, err
-		}
-		return nil, err
+		return nil, convertError(err)
 	}
 	return value, nil
 }
 
 // Has return whether the key is exist in leveldb
 func (self *LevelDBStore) Has(key []byte) (bool, error) {
-	return self.db.Has(key, nil)
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	if self.closed {
+		return false, dbstore.ErrClosed
+	}
+	exist, err := self.db.Has(key, nil)
+	return exist, convertError(err)
 }
 
 // Delete the the in leveldb
 func (self *LevelDBStore) Delete(key []byte) error {
-	return self.db.Delete(key, nil)
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	if self.closed {
+		return dbstore.ErrClosed
+	}
+	if self.readOnly {
+		return dbstore.ErrReadOnly
+	}
+	return convertError(self.db.Delete(key, nil))
+}
+
+// NewIteratorWithPrefix create an iterator over the keys with the specified prefix in ascending order,
+// starting at the key prefix+start. The iterators must be released before closing the database.
+func (self *LevelDBStore) NewIteratorWithPrefix(prefix []byte, start []byte) dbstore.Iterator {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	if self.closed {
+		return iterator.NewEmptyIterator(dbstore.ErrClosed)
+	}
+	r := util.BytesPrefix(prefix)
+	r.Start = append(append([]byte{}, prefix...), start...)
+	return self.db.NewIterator(r, nil)
+}
+
+// Snapshot take a leveldb snapshot of the current state of the database.
+func (self *LevelDBStore) Snapshot() (dbstore.DBSnapshot, error) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	if self.closed {
+		return nil, dbstore.ErrClosed
+	}
+	snapshot, err := self.db.GetSnapshot()
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return &ldbSnapshot{snapshot: snapshot}, nil
 }
 
 //NewBatch create db batch
 func (self *LevelDBStore) NewBatch() dbstore.Batch {
-	return &ldbBatch{db: self.db, b: new(leveldb.Batch)}
+	return &ldbBatch{store: self, b: new(leveldb.Batch)}
 }
 
-// Close leveldb
+// Close leveldb after the in-flight operations complete.
 func (self *LevelDBStore) Close() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.closed {
+		return dbstore.ErrClosed
+	}
+	self.closed = true
 	err := self.db.Close()
-	return err
+	return convertError(err)
+}
+
+// convertError convert the leveldb errors to the errors defined in dbstore, the corrupted errors are wrapped
+// to keep the detail.
+func convertError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case err == leveldb.ErrNotFound:
+		return dbstore.ErrNotFound
+	case err == leveldb.ErrClosed:
+		return dbstore.ErrClosed
+	case err == leveldb.ErrReadOnly:
+		return dbstore.ErrReadOnly
+	case errors.IsCorrupted(err):
+		return fmt.Errorf("%w: %v", dbstore.ErrCorrupted, err)
+	default:
+		return err
+	}
 }
 
 type ldbBatch struct {
-	db   *leveldb.DB
-	b    *leveldb.Batch
-	size int
+	store *LevelDBStore
+	b     *leveldb.Batch
+	size  int
 }
 
 func (b *ldbBatch) Put(key, value []byte) error {
@@ -97,7 +193,27 @@ func (b *ldbBatch) Delete(key []byte) error {
 }
 
 func (b *ldbBatch) Write() error {
-	return b.db.Write(b.b, nil)
+	b.store.lock.RLock()
+	defer b.store.lock.RUnlock()
+	if b.store.closed {
+		return dbstore.ErrClosed
+	}
+	if b.store.readOnly {
+		return dbstore.ErrReadOnly
+	}
+	return convertError(b.store.db.Write(b.b, nil))
+}
+
+func (b *ldbBatch) WriteSync() error {
+	b.store.lock.RLock()
+	defer b.store.lock.RUnlock()
+	if b.store.closed {
+		return dbstore.ErrClosed
+	}
+	if b.store.readOnly {
+		return dbstore.ErrReadOnly
+	}
+	return convertError(b.store.db.Write(b.b, &opt.WriteOptions{Sync: true}))
 }
 
 func (b *ldbBatch) ValueSize() int {
@@ -108,3 +224,44 @@ func (b *ldbBatch) Reset() {
 	b.b.Reset()
 	b.size = 0
 }
+
+type ldbSnapshot struct {
+	snapshot *leveldb.Snapshot
+	lock     sync.RWMutex // held by operations for reading, by release for writing
+	released bool
+}
+
+// Get the value of a key from the snapshot
+func (s *ldbSnapshot) Get(key []byte) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.released {
+		return nil, dbstore.ErrClosed
+	}
+	value, err := s.snapshot.Get(key, nil)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return value, nil
+}
+
+// NewIteratorWithPrefix create an iterator over the keys of the snapshot with the specified prefix in ascending
+// order, starting at the key prefix+start. The iterators are still valid after the snapshot is released.
+func (s *ldbSnapshot) NewIteratorWithPrefix(prefix []byte, start []byte) dbstore.Iterator {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.released {
+		return iterator.NewEmptyIterator(dbstore.ErrClosed)
+	}
+	r := util.BytesPrefix(prefix)
+	r.Start = append(append([]byte{}, prefix...), start...)
+	return s.snapshot.NewIterator(r, nil)
+}
+
+// Release the snapshot, it can be called multiple times.
+func (s *ldbSnapshot) Release() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.released = true
+	s.snapshot.Release()
+}
@@ -1,8 +1,13 @@
 package leveldbstore
 
 import (
+	"errors"
 	"fmt"
+	"github.com/DSiSc/blockstore/dbstore"
 	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb"
+	ldberrors "github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/storage"
 	"os"
 	"testing"
 )
@@ -102,3 +107,147 @@ func TestLdbBatch_Write(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal([]byte("value"), savedValue)
 }
+
+func TestLdbBatch_WriteSync(t *testing.T) {
+	assert := assert.New(t)
+	batch := testLevelDB.NewBatch()
+	batch.Put([]byte("syncKey"), []byte("value"))
+	assert.Nil(batch.WriteSync())
+	savedValue, err := testLevelDB.Get([]byte("syncKey"))
+	assert.Nil(err)
+	assert.Equal([]byte("value"), savedValue)
+}
+
+func TestLevelDBStore_NewIteratorWithPrefix(t *testing.T) {
+	assert := assert.New(t)
+	testLevelDB.Put([]byte("p1"), []byte("v1"))
+	testLevelDB.Put([]byte("p2"), []byte("v2"))
+	testLevelDB.Put([]byte("p3"), []byte("v3"))
+	testLevelDB.Put([]byte("q1"), []byte("v4"))
+	iter := testLevelDB.NewIteratorWithPrefix([]byte("p"), []byte("2"))
+	defer iter.Release()
+	keys := make([]string, 0)
+	for iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	assert.Nil(iter.Error())
+	assert.Equal([]string{"p2", "p3"}, keys)
+}
+
+func TestLevelDBStore_Close(t *testing.T) {
+	assert := assert.New(t)
+	dbFile := "./closedata"
+	defer os.RemoveAll(dbFile)
+	db, err := NewLevelDBStore(dbFile)
+	assert.Nil(err)
+	batch := db.NewBatch()
+	batch.Put([]byte("key"), []byte("value"))
+	assert.Nil(db.Close())
+	assert.Equal(dbstore.ErrClosed, db.Put([]byte("key"), []byte("value")))
+	_, err = db.Get([]byte("key"))
+	assert.Equal(dbstore.ErrClosed, err)
+	_, err = db.Has([]byte("key"))
+	assert.Equal(dbstore.ErrClosed, err)
+	assert.Equal(dbstore.ErrClosed, db.Delete([]byte("key")))
+	assert.Equal(dbstore.ErrClosed, batch.Write())
+	iter := db.NewIteratorWithPrefix(nil, nil)
+	assert.False(iter.Next())
+	assert.Equal(dbstore.ErrClosed, iter.Error())
+	assert.Equal(dbstore.ErrClosed, db.Close())
+
+	// reopen the same path
+	db, err = NewLevelDBStore(dbFile)
+	assert.Nil(err)
+	assert.Nil(db.Close())
+}
+
+// test open leveldb in read-only mode
+func TestLevelDBStore_ReadOnly(t *testing.T) {
+	assert := assert.New(t)
+	dbFile := "./readonlydata"
+	defer os.RemoveAll(dbFile)
+	_, err := NewReadOnlyLevelDBStore(dbFile)
+	assert.NotNil(err)
+	db, err := NewLevelDBStore(dbFile)
+	assert.Nil(err)
+	assert.Nil(db.Put([]byte("key"), []byte("value")))
+	assert.Nil(db.Close())
+
+	db, err = NewReadOnlyLevelDBStore(dbFile)
+	assert.Nil(err)
+	defer db.Close()
+	value, err := db.Get([]byte("key"))
+	assert.Nil(err)
+	assert.Equal([]byte("value"), value)
+	assert.Equal(dbstore.ErrReadOnly, db.Put([]byte("key"), []byte("other")))
+	assert.Equal(dbstore.ErrReadOnly, db.Delete([]byte("key")))
+	batch := db.NewBatch()
+	assert.Nil(batch.Put([]byte("key"), []byte("other")))
+	assert.Equal(dbstore.ErrReadOnly, batch.Write())
+	assert.Equal(dbstore.ErrReadOnly, batch.WriteSync())
+	assert.Equal(dbstore.ErrReadOnly, convertError(leveldb.ErrReadOnly))
+	snapshot, err := db.Snapshot()
+	assert.Nil(err)
+	value, err = snapshot.Get([]byte("key"))
+	assert.Nil(err)
+	assert.Equal([]byte("value"), value)
+	snapshot.Release()
+}
+
+// test the leveldb errors are converted to dbstore errors
+func TestLevelDBStore_GetNotFound(t *testing.T) {
+	assert := assert.New(t)
+	_, err := testLevelDB.Get([]byte("missing"))
+	assert.True(errors.Is(err, dbstore.ErrNotFound))
+	assert.Nil(convertError(nil))
+	assert.Equal(dbstore.ErrClosed, convertError(leveldb.ErrClosed))
+	err = convertError(ldberrors.NewErrCorrupted(storage.FileDesc{}, ldberrors.New("bad block")))
+	assert.True(errors.Is(err, dbstore.ErrCorrupted))
+}
+
+// test the snapshot is not affected by the writes after it is taken
+func TestLevelDBStore_Snapshot(t *testing.T) {
+	assert := assert.New(t)
+	// the keys may be left in the shared database by the previous run
+	assert.Nil(testLevelDB.Delete([]byte("snap1")))
+	assert.Nil(testLevelDB.Delete([]byte("snap2")))
+	assert.Nil(testLevelDB.Put([]byte("snap1"), []byte("v1")))
+	snapshot, err := testLevelDB.Snapshot()
+	assert.Nil(err)
+	assert.Nil(testLevelDB.Put([]byte("snap1"), []byte("v2")))
+	assert.Nil(testLevelDB.Put([]byte("snap2"), []byte("v3")))
+
+	value, err := snapshot.Get([]byte("snap1"))
+	assert.Nil(err)
+	assert.Equal([]byte("v1"), value)
+	_, err = snapshot.Get([]byte("snap2"))
+	assert.Equal(dbstore.ErrNotFound, err)
+	iter := snapshot.NewIteratorWithPrefix([]byte("snap"), nil)
+	keys := make([]string, 0)
+	for iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	iter.Release()
+	assert.Equal([]string{"snap1"}, keys)
+
+	snapshot.Release()
+	_, err = snapshot.Get([]byte("snap1"))
+	assert.Equal(dbstore.ErrClosed, err)
+}
+
+// test backup the database to another directory
+func TestLevelDBStore_Backup(t *testing.T) {
+	assert := assert.New(t)
+	backupDir := "./backupdata"
+	defer os.RemoveAll(backupDir)
+	assert.Nil(testLevelDB.Put([]byte("backup"), []byte("value")))
+	assert.Nil(testLevelDB.Backup(backupDir))
+	assert.NotNil(testLevelDB.Backup(backupDir))
+
+	backup, err := NewLevelDBStore(backupDir)
+	assert.Nil(err)
+	defer backup.Close()
+	value, err := backup.Get([]byte("backup"))
+	assert.Nil(err)
+	assert.Equal([]byte("value"), value)
+}
@@ -0,0 +1,135 @@
+package leveldbstore
+
+import (
+	"fmt"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/blockstore/metrics"
+	"github.com/DSiSc/craft/log"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"strconv"
+	"time"
+)
+
+// the number of levels reported by the files per level gauges
+const metricsLevels = 7
+
+// GetProperty get the internal property of leveldb, such as leveldb.stats, see leveldb.DB.GetProperty.
+func (self *LevelDBStore) GetProperty(name string) (string, error) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	if self.closed {
+		return "", dbstore.ErrClosed
+	}
+	value, err := self.db.GetProperty(name)
+	return value, convertError(err)
+}
+
+// Size get the approximate size of the database files in bytes.
+func (self *LevelDBStore) Size() (int64, error) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	if self.closed {
+		return 0, dbstore.ErrClosed
+	}
+	sizes, err := self.db.SizeOf([]util.Range{{}})
+	if err != nil {
+		return 0, convertError(err)
+	}
+	return sizes.Sum(), nil
+}
+
+// RegisterMetrics register the gauges of the database size and the leveldb internal stats to registry, the
+// gauges read the stats when the metrics are collected.
+func (self *LevelDBStore) RegisterMetrics(registry *metrics.Registry) {
+	registry.GaugeFunc("leveldb_size_bytes", "Approximate size of the leveldb files in bytes.", func() float64 {
+		size, err := self.Size()
+		if err != nil {
+			return 0
+		}
+		return float64(size)
+	})
+	for level := 0; level < metricsLevels; level++ {
+		registry.GaugeFunc("leveldb_files", "Number of leveldb table files per level.",
+			self.propertyGauge(fmt.Sprintf("leveldb.num-files-at-level%d", level)), "level", strconv.Itoa(level))
+	}
+	registry.GaugeFunc("leveldb_cached_block_bytes", "Size of the leveldb block cache in bytes.", self.propertyGauge("leveldb.cachedblock"))
+	registry.GaugeFunc("leveldb_opened_tables", "Number of opened leveldb tables.", self.propertyGauge("leveldb.openedtables"))
+	registry.GaugeFunc("leveldb_alive_snapshots", "Number of alive leveldb snapshots.", self.propertyGauge("leveldb.alivesnaps"))
+	registry.GaugeFunc("leveldb_alive_iterators", "Number of alive leveldb iterators.", self.propertyGauge("leveldb.aliveiters"))
+	registry.GaugeFunc("leveldb_io_bytes", "Bytes read from and written to the leveldb files.", func() float64 {
+		read, _ := self.ioStats()
+		return read
+	}, "op", "read")
+	registry.GaugeFunc("leveldb_io_bytes", "Bytes read from and written to the leveldb files.", func() float64 {
+		_, write := self.ioStats()
+		return write
+	}, "op", "write")
+	registry.GaugeFunc("leveldb_write_delays", "Number of the writes delayed by compaction.", func() float64 {
+		count, _, _ := self.writeDelay()
+		return count
+	})
+	registry.GaugeFunc("leveldb_write_delay_seconds", "Total time of the writes delayed by compaction in seconds.", func() float64 {
+		_, delay, _ := self.writeDelay()
+		return delay
+	})
+	registry.GaugeFunc("leveldb_write_paused", "Whether the writes are paused by compaction, 1 if paused.", func() float64 {
+		_, _, paused := self.writeDelay()
+		return paused
+	})
+}
+
+// propertyGauge get the gauge func reading the numeric property, the value is 0 if the property is unavailable.
+func (self *LevelDBStore) propertyGauge(name string) func() float64 {
+	return func() float64 {
+		value, err := self.GetProperty(name)
+		if err != nil {
+			return 0
+		}
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0
+		}
+		return number
+	}
+}
+
+// ioStats get the bytes read from and written to the leveldb files.
+func (self *LevelDBStore) ioStats() (float64, float64) {
+	value, err := self.GetProperty("leveldb.iostats")
+	if err != nil {
+		return 0, 0
+	}
+	var readMB, writeMB float64
+	_, err = fmt.Sscanf(value, "Read(MB):%f Write(MB):%f", &readMB, &writeMB)
+	if err != nil {
+		log.Debug("Failed to parse leveldb io stats %s, as: %v", value, err)
+		return 0, 0
+	}
+	return readMB * 1048576, writeMB * 1048576
+}
+
+// writeDelay get the number and the total seconds of the delayed writes, and whether the writes are paused.
+func (self *LevelDBStore) writeDelay() (float64, float64, float64) {
+	value, err := self.GetProperty("leveldb.writedelay")
+	if err != nil {
+		return 0, 0, 0
+	}
+	var count int64
+	var delay string
+	var paused bool
+	_, err = fmt.Sscanf(value, "DelayN:%d Delay:%s Paused:%t", &count, &delay, &paused)
+	if err != nil {
+		log.Debug("Failed to parse leveldb write delay %s, as: %v", value, err)
+		return 0, 0, 0
+	}
+	duration, err := time.ParseDuration(delay)
+	if err != nil {
+		log.Debug("Failed to parse leveldb write delay %s, as: %v", value, err)
+		return 0, 0, 0
+	}
+	pausedValue := 0.0
+	if paused {
+		pausedValue = 1
+	}
+	return float64(count), duration.Seconds(), pausedValue
+}
@@ -0,0 +1,35 @@
+package leveldbstore
+
+import (
+	"bytes"
+	"github.com/DSiSc/blockstore/metrics"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// test get leveldb properties and register leveldb metrics
+func TestLevelDBStore_Metrics(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(testLevelDB.Put([]byte("metrics"), bytes.Repeat([]byte{1}, 1024)))
+	stats, err := testLevelDB.GetProperty("leveldb.stats")
+	assert.Nil(err)
+	assert.True(strings.HasPrefix(stats, "Compactions"))
+	_, err = testLevelDB.GetProperty("unknown")
+	assert.NotNil(err)
+	_, err = testLevelDB.Size()
+	assert.Nil(err)
+
+	registry := metrics.NewRegistry()
+	testLevelDB.RegisterMetrics(registry)
+	var buf bytes.Buffer
+	assert.Nil(registry.WriteText(&buf))
+	text := buf.String()
+	for _, sample := range []string{"leveldb_size_bytes ", `leveldb_files{level="0"} `, `leveldb_io_bytes{op="write"} `, "leveldb_write_paused 0"} {
+		assert.True(strings.Contains(text, sample), sample)
+	}
+	read, write := testLevelDB.ioStats()
+	assert.True(read >= 0 && write >= 0)
+	_, _, paused := testLevelDB.writeDelay()
+	assert.Equal(float64(0), paused)
+}
@@ -1,15 +1,18 @@
 package memorystore
 
 import (
-	"errors"
 	"github.com/DSiSc/blockstore/dbstore"
+	"sort"
+	"strings"
 	"sync"
 )
 
 // MemDBStore is a test memory database.
 type MemDBStore struct {
-	db   map[string][]byte
-	lock sync.RWMutex
+	db     map[string][]byte
+	shared bool // db is referenced by snapshots, it is copied before the next write
+	lock   sync.RWMutex
+	closed bool
 }
 
 // NewMemDBStore create a memory database instance.
@@ -23,7 +26,11 @@ func NewMemDBStore() *MemDBStore {
 func (db *MemDBStore) Put(key []byte, value []byte) error {
 	db.lock.Lock()
 	defer db.lock.Unlock()
+	if db.closed {
+		return dbstore.ErrClosed
+	}
 
+	db.copyOnWrite()
 	db.db[string(key)] = copyBytes(value)
 	return nil
 }
@@ -32,24 +39,97 @@ func (db *MemDBStore) Put(key []byte, value []byte) error {
 func (db *MemDBStore) Get(key []byte) ([]byte, error) {
 	db.lock.RLock()
 	defer db.lock.RUnlock()
+	if db.closed {
+		return nil, dbstore.ErrClosed
+	}
 
 	if entry, ok := db.db[string(key)]; ok {
 		return copyBytes(entry), nil
 	}
-	return nil, errors.New("not found")
+	return nil, dbstore.ErrNotFound
 }
 
 func (db *MemDBStore) Delete(key []byte) error {
 	db.lock.Lock()
 	defer db.lock.Unlock()
+	if db.closed {
+		return dbstore.ErrClosed
+	}
 
+	db.copyOnWrite()
 	delete(db.db, string(key))
 	return nil
 }
 
+// NewIteratorWithPrefix create an iterator over the keys with the specified prefix in ascending order,
+// starting at the key prefix+start. The iterator works on a copy of the matched records.
+func (db *MemDBStore) NewIteratorWithPrefix(prefix []byte, start []byte) dbstore.Iterator {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	if db.closed {
+		return &memIterator{index: -1, err: dbstore.ErrClosed}
+	}
+	return newMemIterator(db.db, prefix, start)
+}
+
+// newMemIterator create an iterator over a copy of the records with the specified prefix, starting at the key prefix+start.
+func newMemIterator(db map[string][]byte, prefix []byte, start []byte) *memIterator {
+	pre := string(prefix)
+	st := pre + string(start)
+	keys := make([]string, 0)
+	for key := range db {
+		if strings.HasPrefix(key, pre) && key >= st {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = copyBytes(db[key])
+	}
+	return &memIterator{keys: keys, values: values, index: -1}
+}
+
+// Close release the memory database, the operations after close return ErrClosed.
+func (db *MemDBStore) Close() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if db.closed {
+		return dbstore.ErrClosed
+	}
+	db.closed = true
+	db.db = nil
+	return nil
+}
+
+// Snapshot take a copy-on-write snapshot of the database, the records are copied by the next write
+// rather than by the snapshot.
+func (db *MemDBStore) Snapshot() (dbstore.DBSnapshot, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if db.closed {
+		return nil, dbstore.ErrClosed
+	}
+	db.shared = true
+	return &memSnapshot{db: db.db}, nil
+}
+
+// copyOnWrite copy the records referenced by snapshots before writing, must be called with the write lock held.
+func (db *MemDBStore) copyOnWrite() {
+	if !db.shared {
+		return
+	}
+	copied := make(map[string][]byte, len(db.db))
+	for key, value := range db.db {
+		copied[key] = value
+	}
+	db.db = copied
+	db.shared = false
+}
+
 //NewBatch create db batch
 func (self *MemDBStore) NewBatch() dbstore.Batch {
-	return &memBatch{db: self, batchCache: make(map[string][]byte)}
+	return &memBatch{db: self, batchCache: make(map[string][]byte), deleteCache: make(map[string]struct{})}
 }
 
 // copy byte from sources byte array.
@@ -62,35 +142,123 @@ func copyBytes(b []byte) (copiedBytes []byte) {
 	return copiedBytes
 }
 
+type memSnapshot struct {
+	db   map[string][]byte
+	lock sync.RWMutex
+}
+
+// Get get content from the snapshot.
+func (s *memSnapshot) Get(key []byte) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.db == nil {
+		return nil, dbstore.ErrClosed
+	}
+	if entry, ok := s.db[string(key)]; ok {
+		return copyBytes(entry), nil
+	}
+	return nil, dbstore.ErrNotFound
+}
+
+// NewIteratorWithPrefix create an iterator over the keys of the snapshot with the specified prefix in ascending
+// order, starting at the key prefix+start.
+func (s *memSnapshot) NewIteratorWithPrefix(prefix []byte, start []byte) dbstore.Iterator {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.db == nil {
+		return &memIterator{index: -1, err: dbstore.ErrClosed}
+	}
+	return newMemIterator(s.db, prefix, start)
+}
+
+// Release drop the reference to the records, it can be called multiple times.
+func (s *memSnapshot) Release() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.db = nil
+}
+
+type memIterator struct {
+	keys   []string
+	values [][]byte
+	index  int
+	err    error
+}
+
+func (it *memIterator) Next() bool {
+	if it.index < len(it.keys) {
+		it.index++
+	}
+	return it.index < len(it.keys)
+}
+
+func (it *memIterator) Key() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return []byte(it.keys[it.index])
+}
+
+func (it *memIterator) Value() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return it.values[it.index]
+}
+
+func (it *memIterator) Error() error {
+	return it.err
+}
+
+func (it *memIterator) Release() {
+	it.keys, it.values = nil, nil
+}
+
 type memBatch struct {
-	db         *MemDBStore
-	batchCache map[string][]byte
+	db          *MemDBStore
+	batchCache  map[string][]byte
+	deleteCache map[string]struct{}
 }
 
 func (b *memBatch) Put(key, value []byte) error {
+	delete(b.deleteCache, string(key))
 	b.batchCache[string(key)] = value
 	return nil
 }
 
 func (b *memBatch) Delete(key []byte) error {
 	delete(b.batchCache, string(key))
+	b.deleteCache[string(key)] = struct{}{}
 	return nil
 }
 
 func (b *memBatch) Write() error {
 	b.db.lock.Lock()
 	defer b.db.lock.Unlock()
+	if b.db.closed {
+		return dbstore.ErrClosed
+	}
+	b.db.copyOnWrite()
+	for key := range b.deleteCache {
+		delete(b.db.db, key)
+	}
 	for key, value := range b.batchCache {
 		b.db.db[key] = value
 	}
-	b.batchCache = make(map[string][]byte)
+	b.Reset()
 	return nil
 }
 
+// WriteSync is same as Write, as memory database has no stable storage.
+func (b *memBatch) WriteSync() error {
+	return b.Write()
+}
+
 func (b *memBatch) ValueSize() int {
 	return len(b.batchCache)
 }
 
 func (b *memBatch) Reset() {
 	b.batchCache = make(map[string][]byte)
+	b.deleteCache = make(map[string]struct{})
 }
@@ -1,6 +1,8 @@
 package memorystore
 
 import (
+	"errors"
+	"github.com/DSiSc/blockstore/dbstore"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -37,6 +39,9 @@ func TestMemDBStore_Get(t *testing.T) {
 	dbContent, err := memDB.Get(key)
 	assert.Nil(err)
 	assert.Equal(value, dbContent)
+
+	_, err = memDB.Get([]byte("missing"))
+	assert.True(errors.Is(err, dbstore.ErrNotFound))
 }
 
 // test delete from database.
@@ -107,3 +112,95 @@ func TestMemBatch_Write(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal([]byte("value"), savedValue)
 }
+
+func TestMemBatch_WriteDelete(t *testing.T) {
+	assert := assert.New(t)
+	memDB := NewMemDBStore()
+	assert.NotNil(memDB)
+	memDB.Put([]byte("key"), []byte("value"))
+	batch := memDB.NewBatch()
+	assert.NotNil(batch)
+	batch.Delete([]byte("key"))
+	batch.Write()
+	_, err := memDB.Get([]byte("key"))
+	assert.NotNil(err)
+}
+
+func TestMemDBStore_NewIteratorWithPrefix(t *testing.T) {
+	assert := assert.New(t)
+	memDB := NewMemDBStore()
+	assert.NotNil(memDB)
+	memDB.Put([]byte("p3"), []byte("v3"))
+	memDB.Put([]byte("p1"), []byte("v1"))
+	memDB.Put([]byte("q1"), []byte("v4"))
+	memDB.Put([]byte("p2"), []byte("v2"))
+	iter := memDB.NewIteratorWithPrefix([]byte("p"), []byte("2"))
+	defer iter.Release()
+	keys := make([]string, 0)
+	values := make([]string, 0)
+	for iter.Next() {
+		keys = append(keys, string(iter.Key()))
+		values = append(values, string(iter.Value()))
+	}
+	assert.Nil(iter.Error())
+	assert.Equal([]string{"p2", "p3"}, keys)
+	assert.Equal([]string{"v2", "v3"}, values)
+	assert.False(iter.Next())
+}
+
+func TestMemDBStore_Close(t *testing.T) {
+	assert := assert.New(t)
+	memDB := NewMemDBStore()
+	assert.NotNil(memDB)
+	batch := memDB.NewBatch()
+	batch.Put(key, value)
+	assert.Nil(memDB.Close())
+	assert.Equal(dbstore.ErrClosed, memDB.Put(key, value))
+	_, err := memDB.Get(key)
+	assert.Equal(dbstore.ErrClosed, err)
+	assert.Equal(dbstore.ErrClosed, memDB.Delete(key))
+	assert.Equal(dbstore.ErrClosed, batch.Write())
+	iter := memDB.NewIteratorWithPrefix(nil, nil)
+	assert.False(iter.Next())
+	assert.Equal(dbstore.ErrClosed, iter.Error())
+	assert.Equal(dbstore.ErrClosed, memDB.Close())
+}
+
+// test the snapshot is not affected by the writes after it is taken
+func TestMemDBStore_Snapshot(t *testing.T) {
+	assert := assert.New(t)
+	memDB := NewMemDBStore()
+	assert.Nil(memDB.Put([]byte("p1"), []byte("v1")))
+	assert.Nil(memDB.Put([]byte("p2"), []byte("v2")))
+	snapshot, err := memDB.Snapshot()
+	assert.Nil(err)
+
+	assert.Nil(memDB.Put([]byte("p1"), []byte("v3")))
+	assert.Nil(memDB.Delete([]byte("p2")))
+	batch := memDB.NewBatch()
+	batch.Put([]byte("p4"), []byte("v4"))
+	assert.Nil(batch.Write())
+
+	value, err := snapshot.Get([]byte("p1"))
+	assert.Nil(err)
+	assert.Equal([]byte("v1"), value)
+	_, err = snapshot.Get([]byte("p4"))
+	assert.Equal(dbstore.ErrNotFound, err)
+	iter := snapshot.NewIteratorWithPrefix([]byte("p"), nil)
+	keys := make([]string, 0)
+	for iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	iter.Release()
+	assert.Equal([]string{"p1", "p2"}, keys)
+	value, err = memDB.Get([]byte("p1"))
+	assert.Nil(err)
+	assert.Equal([]byte("v3"), value)
+
+	snapshot.Release()
+	_, err = snapshot.Get([]byte("p1"))
+	assert.Equal(dbstore.ErrClosed, err)
+	assert.Nil(memDB.Close())
+	_, err = memDB.Snapshot()
+	assert.Equal(dbstore.ErrClosed, err)
+}
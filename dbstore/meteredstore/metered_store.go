@@ -0,0 +1,155 @@
+package meteredstore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/blockstore/metrics"
+	"time"
+)
+
+// names of the metered database operations
+const (
+	opGet        = "get"
+	opPut        = "put"
+	opDelete     = "delete"
+	opIterate    = "iterate"
+	opBatchPut   = "batch_put"
+	opBatchWrite = "batch_write"
+	opBatchSync  = "batch_write_sync"
+)
+
+// the buckets of the number of records in the written batches
+var recordBuckets = metrics.ExponentialBuckets(1, 4, 8)
+
+// MeteredStore wraps a database to count the operations, the read and written bytes and the operation latency
+// per key prefix, along with the size of the written batches. The snapshots are not metered.
+type MeteredStore struct {
+	store    dbstore.DBStore
+	registry *metrics.Registry
+	prefixOf func(key []byte) string
+}
+
+// NewMeteredStore wrap the database to record the metrics to registry, prefixOf get the key prefix label of
+// a key, the first byte of the key will be used if it is nil.
+func NewMeteredStore(store dbstore.DBStore, registry *metrics.Registry, prefixOf func(key []byte) string) *MeteredStore {
+	if prefixOf == nil {
+		prefixOf = firstByte
+	}
+	return &MeteredStore{
+		store:    store,
+		registry: registry,
+		prefixOf: prefixOf,
+	}
+}
+
+func (s *MeteredStore) Put(key []byte, value []byte) error {
+	start := time.Now()
+	err := s.store.Put(key, value)
+	prefix := s.prefixOf(key)
+	s.observe(opPut, prefix, start, err)
+	s.registry.Counter("dbstore_bytes_total", "Bytes of the values read from and written to database.", "op", opPut, "prefix", prefix).Add(uint64(len(value)))
+	return err
+}
+
+func (s *MeteredStore) Get(key []byte) ([]byte, error) {
+	start := time.Now()
+	value, err := s.store.Get(key)
+	prefix := s.prefixOf(key)
+	s.observe(opGet, prefix, start, err)
+	s.registry.Counter("dbstore_bytes_total", "Bytes of the values read from and written to database.", "op", opGet, "prefix", prefix).Add(uint64(len(value)))
+	return value, err
+}
+
+func (s *MeteredStore) Delete(key []byte) error {
+	start := time.Now()
+	err := s.store.Delete(key)
+	s.observe(opDelete, s.prefixOf(key), start, err)
+	return err
+}
+
+// NewIteratorWithPrefix count the created iterators, the iteration is not metered.
+func (s *MeteredStore) NewIteratorWithPrefix(prefix []byte, start []byte) dbstore.Iterator {
+	s.registry.Counter("dbstore_operations_total", "Number of database operations.", "op", opIterate, "prefix", s.prefixOf(prefix)).Inc()
+	return s.store.NewIteratorWithPrefix(prefix, start)
+}
+
+func (s *MeteredStore) NewBatch() dbstore.Batch {
+	return &batch{Batch: s.store.NewBatch(), store: s}
+}
+
+func (s *MeteredStore) Snapshot() (dbstore.DBSnapshot, error) {
+	return s.store.Snapshot()
+}
+
+func (s *MeteredStore) Close() error {
+	return s.store.Close()
+}
+
+// observe record the count, the errors and the latency of an operation, not found is not an error.
+func (s *MeteredStore) observe(op, prefix string, start time.Time, err error) {
+	s.registry.Counter("dbstore_operations_total", "Number of database operations.", "op", op, "prefix", prefix).Inc()
+	if err != nil && !errors.Is(err, dbstore.ErrNotFound) {
+		s.registry.Counter("dbstore_operation_errors_total", "Number of failed database operations.", "op", op, "prefix", prefix).Inc()
+	}
+	s.registry.Histogram("dbstore_operation_duration_seconds", "Latency of database operations in seconds.", metrics.LatencyBuckets, "op", op, "prefix", prefix).Observe(time.Since(start).Seconds())
+}
+
+// firstByte get the first byte of the key as label, the unprintable byte is formatted in hex.
+func firstByte(key []byte) string {
+	switch {
+	case len(key) == 0:
+		return ""
+	case key[0] >= 0x20 && key[0] < 0x7f:
+		return string(key[:1])
+	default:
+		return fmt.Sprintf("0x%02x", key[0])
+	}
+}
+
+// batch count the records put to the wrapped batch, and record the size of the batch when it is written.
+type batch struct {
+	dbstore.Batch
+	store   *MeteredStore
+	records int
+	bytes   int
+}
+
+func (b *batch) Put(key, value []byte) error {
+	b.records++
+	b.bytes += len(key) + len(value)
+	prefix := b.store.prefixOf(key)
+	b.store.registry.Counter("dbstore_operations_total", "Number of database operations.", "op", opBatchPut, "prefix", prefix).Inc()
+	b.store.registry.Counter("dbstore_bytes_total", "Bytes of the values read from and written to database.", "op", opBatchPut, "prefix", prefix).Add(uint64(len(value)))
+	return b.Batch.Put(key, value)
+}
+
+func (b *batch) Delete(key []byte) error {
+	b.records++
+	b.bytes += len(key)
+	return b.Batch.Delete(key)
+}
+
+func (b *batch) Write() error {
+	return b.write(opBatchWrite, b.Batch.Write)
+}
+
+func (b *batch) WriteSync() error {
+	return b.write(opBatchSync, b.Batch.WriteSync)
+}
+
+func (b *batch) Reset() {
+	b.Batch.Reset()
+	b.records = 0
+	b.bytes = 0
+}
+
+// write commit the batch with commit, and record the latency and the size of the batch.
+func (b *batch) write(op string, commit func() error) error {
+	start := time.Now()
+	err := commit()
+	b.store.observe(op, "", start, err)
+	b.store.registry.Histogram("dbstore_batch_size_bytes", "Size of the written batches in bytes.", metrics.SizeBuckets).Observe(float64(b.bytes))
+	b.store.registry.Histogram("dbstore_batch_records", "Number of records in the written batches.", recordBuckets).Observe(float64(b.records))
+	return err
+}
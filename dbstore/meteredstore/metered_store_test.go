@@ -0,0 +1,71 @@
+package meteredstore
+
+import (
+	"bytes"
+	"errors"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/blockstore/dbstore/memorystore"
+	"github.com/DSiSc/blockstore/metrics"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// test the operations are metered per key prefix
+func TestMeteredStore(t *testing.T) {
+	assert := assert.New(t)
+	registry := metrics.NewRegistry()
+	store := NewMeteredStore(memorystore.NewMemDBStore(), registry, nil)
+	assert.Nil(store.Put([]byte("hello"), []byte("world")))
+	value, err := store.Get([]byte("hello"))
+	assert.Nil(err)
+	assert.Equal([]byte("world"), value)
+	_, err = store.Get([]byte{0x01})
+	assert.True(errors.Is(err, dbstore.ErrNotFound))
+	assert.Nil(store.Delete([]byte("hello")))
+
+	assert.Equal(uint64(1), registry.Counter("dbstore_operations_total", "", "op", opPut, "prefix", "h").Value())
+	assert.Equal(uint64(1), registry.Counter("dbstore_operations_total", "", "op", opGet, "prefix", "h").Value())
+	assert.Equal(uint64(1), registry.Counter("dbstore_operations_total", "", "op", opGet, "prefix", "0x01").Value())
+	assert.Equal(uint64(1), registry.Counter("dbstore_operations_total", "", "op", opDelete, "prefix", "h").Value())
+	assert.Equal(uint64(0), registry.Counter("dbstore_operation_errors_total", "", "op", opGet, "prefix", "0x01").Value())
+	assert.Equal(uint64(5), registry.Counter("dbstore_bytes_total", "", "op", opGet, "prefix", "h").Value())
+	latency := registry.Histogram("dbstore_operation_duration_seconds", "", nil, "op", opPut, "prefix", "h").Snapshot()
+	assert.Equal(uint64(1), latency.Count)
+}
+
+// test the batches are metered by size
+func TestMeteredStore_Batch(t *testing.T) {
+	assert := assert.New(t)
+	registry := metrics.NewRegistry()
+	store := NewMeteredStore(memorystore.NewMemDBStore(), registry, func(key []byte) string {
+		return strings.ToUpper(string(key[:1]))
+	})
+	batch := store.NewBatch()
+	assert.Nil(batch.Put([]byte("k1"), bytes.Repeat([]byte{1}, 100)))
+	assert.Nil(batch.Put([]byte("k2"), bytes.Repeat([]byte{2}, 200)))
+	assert.Nil(batch.Delete([]byte("k3")))
+	assert.Nil(batch.Write())
+	batch.Reset()
+	assert.Nil(batch.Put([]byte("k4"), []byte{4}))
+	assert.Nil(batch.WriteSync())
+
+	assert.Equal(uint64(3), registry.Counter("dbstore_operations_total", "", "op", opBatchPut, "prefix", "K").Value())
+	assert.Equal(uint64(301), registry.Counter("dbstore_bytes_total", "", "op", opBatchPut, "prefix", "K").Value())
+	assert.Equal(uint64(1), registry.Counter("dbstore_operations_total", "", "op", opBatchWrite, "prefix", "").Value())
+	assert.Equal(uint64(1), registry.Counter("dbstore_operations_total", "", "op", opBatchSync, "prefix", "").Value())
+	size := registry.Histogram("dbstore_batch_size_bytes", "", nil).Snapshot()
+	assert.Equal(uint64(2), size.Count)
+	assert.Equal(float64(306+3), size.Sum)
+	records := registry.Histogram("dbstore_batch_records", "", nil).Snapshot()
+	assert.Equal(float64(4), records.Sum)
+
+	iter := store.NewIteratorWithPrefix([]byte("k"), nil)
+	count := 0
+	for iter.Next() {
+		count++
+	}
+	iter.Release()
+	assert.Equal(3, count)
+	assert.Equal(uint64(1), registry.Counter("dbstore_operations_total", "", "op", opIterate, "prefix", "K").Value())
+}
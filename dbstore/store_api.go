@@ -13,14 +13,52 @@ type DBDeleter interface {
 	Delete(key []byte) error
 }
 
+// DBIteratee wraps the NewIteratorWithPrefix method of a database.
+type DBIteratee interface {
+	// NewIteratorWithPrefix create an iterator over the keys with the specified prefix in ascending order,
+	// starting at the key prefix+start.
+	NewIteratorWithPrefix(prefix []byte, start []byte) Iterator
+}
+
 // DBStore represent the low level database to store block
 type DBStore interface {
 	DBPutter
 	DBDeleter
+	DBIteratee
 	// Get get from db
 	Get(key []byte) ([]byte, error)
 	// NewBatch create db batch
 	NewBatch() Batch
+	// Snapshot take a read-only snapshot of the current state of the database.
+	Snapshot() (DBSnapshot, error)
+	// Close close the database after the in-flight operations complete, the operations after close return ErrClosed.
+	Close() error
+}
+
+// DBSnapshot is a read-only view of the database frozen at the time it is taken, the writes after that
+// are invisible to it. Snapshot must be released after use.
+type DBSnapshot interface {
+	DBIteratee
+	// Get get from the snapshot
+	Get(key []byte) ([]byte, error)
+	// Release releases the snapshot, the operations after release return ErrClosed.
+	Release()
+}
+
+// Iterator iterates over a database's key/value pairs in ascending key order. The key/value returned
+// may be reused by the next call of Next, caller should copy them if needed. Iterator must be released
+// after use.
+type Iterator interface {
+	// Next moves the iterator to the next key/value pair, return false if the iterator is exhausted.
+	Next() bool
+	// Key return the key of the current key/value pair.
+	Key() []byte
+	// Value return the value of the current key/value pair.
+	Value() []byte
+	// Error return any accumulated error.
+	Error() error
+	// Release releases associated resources.
+	Release()
 }
 
 // Batch is a write-only database that commits changes to its host database
@@ -30,6 +68,8 @@ type Batch interface {
 	DBDeleter
 	ValueSize() int // amount of data in the batch
 	Write() error
+	// WriteSync commits the batch and flushes it to stable storage before returning.
+	WriteSync() error
 	// Reset resets the batch for reuse
 	Reset()
 }
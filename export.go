@@ -0,0 +1,316 @@
+package blockstore
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/DSiSc/blockstore/codec"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// The export stream is the header followed by the payload, the payload is gzip compressed if the gzip flag
+// is set. The payload is the codec name, the block records and the end marker, followed by the sha256
+// checksum of them. Each block record is the record marker, the encoded block, the receipts flag and the
+// encoded receipts if the flag is set, the variable length fields are prefixed by the length.
+const (
+	// the version of export format
+	exportVersion = 1
+	// export flag of gzip compressed payload
+	exportFlagGzip = 0x01
+	// marker of a block record
+	exportRecordMarker = 1
+	// marker of the end of block records
+	exportEndMarker = 0
+	// the max size of an encoded block or receipts in export stream
+	maxExportRecordSize = 64 * 1024 * 1024
+)
+
+// exportMagic is the leading bytes of export stream.
+var exportMagic = []byte("BLKSTORE")
+
+// ExportChain write the canonical blocks with height in [from, to] and their receipts to the writer in export
+// format, the payload is gzip compressed if compress is true. Blocks above the current block are not exported.
+func (blockStore *BlockStore) ExportChain(w io.Writer, from, to uint64, compress bool) error {
+	if from > to {
+		return fmt.Errorf("invalid block range [%d, %d]", from, to)
+	}
+	if currentHeight := blockStore.GetCurrentBlockHeight(); to > currentHeight {
+		to = currentHeight
+	}
+	log.Info("Start exporting blocks in [%d, %d]", from, to)
+
+	var flags byte
+	if compress {
+		flags |= exportFlagGzip
+	}
+	header := append(append([]byte{}, exportMagic...), exportVersion, flags)
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("failed to write export header, as: %v", err)
+	}
+	payloadWriter := w
+	var gzipWriter *gzip.Writer
+	if compress {
+		gzipWriter = gzip.NewWriter(w)
+		payloadWriter = gzipWriter
+	}
+	bufWriter := bufio.NewWriter(payloadWriter)
+	hasher := sha256.New()
+	writer := io.MultiWriter(bufWriter, hasher)
+
+	err := common.WriteVarBytes(writer, []byte(blockStore.codec.Name()))
+	if err != nil {
+		return fmt.Errorf("failed to write export codec, as: %v", err)
+	}
+	for height := from; height <= to; height++ {
+		err = blockStore.exportBlock(writer, height)
+		if err != nil {
+			return err
+		}
+	}
+	err = common.WriteVarUint(writer, exportEndMarker)
+	if err != nil {
+		return fmt.Errorf("failed to write export end marker, as: %v", err)
+	}
+	if _, err = bufWriter.Write(hasher.Sum(nil)); err != nil {
+		return fmt.Errorf("failed to write export checksum, as: %v", err)
+	}
+	if err = bufWriter.Flush(); err != nil {
+		return fmt.Errorf("failed to flush export stream, as: %v", err)
+	}
+	if gzipWriter != nil {
+		if err = gzipWriter.Close(); err != nil {
+			return fmt.Errorf("failed to flush gzip payload, as: %v", err)
+		}
+	}
+	log.Info("Finish exporting blocks in [%d, %d]", from, to)
+	return nil
+}
+
+// exportBlock write the record of the canonical block with specified height.
+func (blockStore *BlockStore) exportBlock(writer io.Writer, height uint64) error {
+	blockHash, err := blockStore.getCanonicalHash(height)
+	if err != nil {
+		return err
+	}
+	block, err := blockStore.GetBlockByHash(blockHash)
+	if err != nil {
+		return err
+	}
+	blockByte, err := blockStore.encodeEntity(block)
+	if err != nil {
+		return fmt.Errorf("failed to encode block %x, as: %v", blockHash, err)
+	}
+	receipts, err := blockStore.GetReceiptByBlockHash(blockHash)
+	if err != nil && !errors.Is(err, dbstore.ErrNotFound) {
+		return err
+	}
+
+	var receiptsByte []byte
+	if receipts != nil {
+		receiptsByte, err = blockStore.encodeEntity(receipts)
+		if err != nil {
+			return fmt.Errorf("failed to encode receipts of block %x, as: %v", blockHash, err)
+		}
+	}
+
+	var record bytes.Buffer
+	common.WriteVarUint(&record, exportRecordMarker)
+	common.WriteVarBytes(&record, blockByte)
+	if receiptsByte == nil {
+		common.WriteVarUint(&record, 0)
+	} else {
+		common.WriteVarUint(&record, 1)
+		common.WriteVarBytes(&record, receiptsByte)
+	}
+	_, err = writer.Write(record.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to write block record with height %d, as: %v", height, err)
+	}
+	return nil
+}
+
+// ImportChain read the blocks in export format from the reader and write them to store in order, the blocks
+// already in store are skipped. The payload is spooled to a temporary file and its checksum and receipts are
+// verified before any block is written, so nothing is imported from a corrupted stream. Return the number of
+// imported blocks.
+func (blockStore *BlockStore) ImportChain(r io.Reader) (uint64, error) {
+	if blockStore.readOnly {
+		return 0, dbstore.ErrReadOnly
+	}
+	header := make([]byte, len(exportMagic)+2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, fmt.Errorf("failed to read export header, as: %v", err)
+	}
+	if !bytes.Equal(header[:len(exportMagic)], exportMagic) {
+		return 0, fmt.Errorf("%w: invalid export magic %x", dbstore.ErrCorrupted, header[:len(exportMagic)])
+	}
+	if version := header[len(exportMagic)]; version != exportVersion {
+		return 0, fmt.Errorf("not support export format version %d", version)
+	}
+	payloadReader := r
+	if header[len(exportMagic)+1]&exportFlagGzip != 0 {
+		gzipReader, err := gzip.NewReader(r)
+		if err != nil {
+			return 0, fmt.Errorf("%w: failed to read gzip payload, as: %v", dbstore.ErrCorrupted, err)
+		}
+		defer gzipReader.Close()
+		payloadReader = gzipReader
+	}
+
+	spool, err := ioutil.TempFile("", "blockstore-import")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create import spool file, as: %v", err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+	spoolWriter := bufio.NewWriter(spool)
+	bufReader := bufio.NewReader(payloadReader)
+	hasher := sha256.New()
+	reader := io.TeeReader(bufReader, io.MultiWriter(hasher, spoolWriter))
+	err = readExportRecords(reader, blockStore.checkImportRecord)
+	if err != nil {
+		return 0, err
+	}
+	checksum := make([]byte, sha256.Size)
+	if _, err = io.ReadFull(bufReader, checksum); err != nil {
+		return 0, fmt.Errorf("%w: failed to read export checksum, as: %v", dbstore.ErrCorrupted, err)
+	}
+	if !bytes.Equal(checksum, hasher.Sum(nil)) {
+		return 0, fmt.Errorf("%w: export checksum mismatch", dbstore.ErrCorrupted)
+	}
+	if err = spoolWriter.Flush(); err != nil {
+		return 0, fmt.Errorf("failed to write import spool file, as: %v", err)
+	}
+	if _, err = spool.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to rewind import spool file, as: %v", err)
+	}
+
+	var count uint64
+	err = readExportRecords(bufio.NewReader(spool), func(block *types.Block, receipts []*types.Receipt, hasReceipts bool) error {
+		imported, err := blockStore.importBlock(block, receipts, hasReceipts)
+		if imported {
+			count++
+		}
+		return err
+	})
+	if err != nil {
+		return count, err
+	}
+	log.Info("Finish importing %d blocks", count)
+	return count, nil
+}
+
+// readExportRecords read the codec name and the block records of export payload until the end marker, and
+// call fn with each decoded record.
+func readExportRecords(reader io.Reader, fn func(block *types.Block, receipts []*types.Receipt, hasReceipts bool) error) error {
+	codecName, err := readExportBytes(reader)
+	if err != nil {
+		return err
+	}
+	exportCodec, err := codec.NewCodec(string(codecName))
+	if err != nil {
+		return err
+	}
+	for {
+		marker, err := common.ReadVarUint(reader)
+		if err != nil {
+			return fmt.Errorf("%w: failed to read record marker, as: %v", dbstore.ErrCorrupted, err)
+		}
+		if marker == exportEndMarker {
+			return nil
+		}
+		if marker != exportRecordMarker {
+			return fmt.Errorf("%w: invalid record marker %d", dbstore.ErrCorrupted, marker)
+		}
+		block, receipts, hasReceipts, err := readExportRecord(reader, exportCodec)
+		if err != nil {
+			return err
+		}
+		err = fn(block, receipts, hasReceipts)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readExportRecord read and decode a block record.
+func readExportRecord(reader io.Reader, exportCodec codec.Codec) (*types.Block, []*types.Receipt, bool, error) {
+	blockByte, err := readExportBytes(reader)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	var block types.Block
+	err = exportCodec.Decode(blockByte, &block)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("%w: failed to decode block record, as: %v", dbstore.ErrCorrupted, err)
+	}
+	hasReceipts, err := common.ReadVarUint(reader)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("%w: failed to read receipts flag, as: %v", dbstore.ErrCorrupted, err)
+	}
+	var receipts []*types.Receipt
+	if hasReceipts != 0 {
+		receiptsByte, err := readExportBytes(reader)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		err = exportCodec.Decode(receiptsByte, &receipts)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("%w: failed to decode receipts record, as: %v", dbstore.ErrCorrupted, err)
+		}
+	}
+	return &block, receipts, hasReceipts != 0, nil
+}
+
+// checkImportRecord check the receipts of an import record against the receipts root in block header.
+func (blockStore *BlockStore) checkImportRecord(block *types.Block, receipts []*types.Receipt, hasReceipts bool) error {
+	if !hasReceipts {
+		return nil
+	}
+	if receiptsRoot := blockStore.receiptsRoot(receipts); receiptsRoot != block.Header.ReceiptsRoot {
+		return fmt.Errorf("%w: block %x has receipts root %x, but the imported receipts root is %x", ErrReceiptsRootMismatch, block.HeaderHash, block.Header.ReceiptsRoot, receiptsRoot)
+	}
+	return nil
+}
+
+// importBlock write the imported block to store, return false if the block is already in store.
+func (blockStore *BlockStore) importBlock(block *types.Block, receipts []*types.Receipt, hasReceipts bool) (bool, error) {
+	if _, err := blockStore.GetHeaderByHash(block.HeaderHash); err == nil {
+		return false, nil
+	}
+	var err error
+	if hasReceipts {
+		err = blockStore.WriteBlockWithReceipts(block, receipts)
+	} else {
+		err = blockStore.WriteBlock(block)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to import block %x, as: %w", block.HeaderHash, err)
+	}
+	return true, nil
+}
+
+// readExportBytes read a length prefixed field of export stream.
+func readExportBytes(reader io.Reader) ([]byte, error) {
+	length, err := common.ReadVarUint(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read record length, as: %v", dbstore.ErrCorrupted, err)
+	}
+	if length > maxExportRecordSize {
+		return nil, fmt.Errorf("%w: record length %d exceeds the max size %d", dbstore.ErrCorrupted, length, maxExportRecordSize)
+	}
+	value := make([]byte, length)
+	if _, err = io.ReadFull(reader, value); err != nil {
+		return nil, fmt.Errorf("%w: failed to read record, as: %v", dbstore.ErrCorrupted, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,81 @@
+package blockstore
+
+import (
+	"bytes"
+	"errors"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/craft/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// test export the chain and import it to another store
+func TestBlockStore_ExportImportChain(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		assert := assert.New(t)
+		blockStore, block2, tx := mockVerifiedBlockStore(t)
+		var buf bytes.Buffer
+		assert.Nil(blockStore.ExportChain(&buf, 1, 10, compress))
+
+		importedStore, err := NewBlockStore(mockBlockStoreConfig())
+		assert.Nil(err)
+		count, err := importedStore.ImportChain(bytes.NewReader(buf.Bytes()))
+		assert.Nil(err)
+		assert.Equal(uint64(2), count)
+		assert.Equal(block2.HeaderHash, importedStore.GetCurrentBlock().HeaderHash)
+		_, txBlockHash, _, _, err := importedStore.GetTransactionByHash(common.TxHash(&tx))
+		assert.Nil(err)
+		assert.Equal(block2.HeaderHash, txBlockHash)
+		receipts, err := importedStore.GetReceiptByBlockHash(block2.HeaderHash)
+		assert.Nil(err)
+		assert.Equal(mockReceipts(), receipts)
+		_, err = importedStore.GetReceiptByBlockHash(block2.Header.PrevBlockHash)
+		assert.True(errors.Is(err, dbstore.ErrNotFound))
+
+		// the imported blocks are skipped
+		count, err = importedStore.ImportChain(bytes.NewReader(buf.Bytes()))
+		assert.Nil(err)
+		assert.Equal(uint64(0), count)
+	}
+}
+
+// test import the corrupted export stream
+func TestBlockStore_ImportCorruptedChain(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, _, _ := mockVerifiedBlockStore(t)
+	var buf bytes.Buffer
+	assert.Nil(blockStore.ExportChain(&buf, 2, 2, false))
+	assert.NotNil(blockStore.ExportChain(&buf, 2, 1, false))
+
+	exported := buf.Bytes()
+	exported[len(exported)-1] ^= 0xFF
+	importedStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	count, err := importedStore.ImportChain(bytes.NewReader(exported))
+	assert.True(errors.Is(err, dbstore.ErrCorrupted))
+	assert.Equal(uint64(0), count)
+	assert.Nil(importedStore.GetCurrentBlock())
+
+	_, err = importedStore.ImportChain(bytes.NewReader([]byte("invalid export stream")))
+	assert.True(errors.Is(err, dbstore.ErrCorrupted))
+}
+
+// test import the block whose receipts don't match the receipts root in header
+func TestBlockStore_ImportMismatchedReceipts(t *testing.T) {
+	assert := assert.New(t)
+	blockStore := mockBlockStore(t)
+	block2, _ := mockBlockWithTx()
+	block2.Header.ReceiptsRoot = common.HexToHash("0x01")
+	block2.HeaderHash = types.Hash{}
+	block2.HeaderHash = common.HeaderHash(block2)
+	assert.Nil(blockStore.WriteBlockWithReceipts(block2, mockReceipts()))
+	var buf bytes.Buffer
+	assert.Nil(blockStore.ExportChain(&buf, 1, 1, false))
+
+	importedStore := mockBlockStore(t)
+	count, err := importedStore.ImportChain(bytes.NewReader(buf.Bytes()))
+	assert.True(errors.Is(err, ErrReceiptsRootMismatch))
+	assert.Equal(uint64(0), count)
+	assert.Nil(importedStore.GetCurrentBlock())
+}
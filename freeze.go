@@ -0,0 +1,256 @@
+package blockstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/DSiSc/blockstore/codec"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/blockstore/freezer"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+)
+
+const (
+	// the default number of latest canonical blocks kept in database instead of freezer
+	DEFAULT_FREEZER_FINALITY = 90000
+	// the number of blocks frozen in one batch
+	freezeBatchBlocks = 100
+	// the freezer metadata key of the codec encoding the frozen items
+	freezerCodecKey = "codec"
+)
+
+// frozenTables map the prefix of the block records moved to freezer to the freezer tables.
+var frozenTables = map[string]string{
+	string(headerPrefix):  freezer.HEADERS,
+	string(bodyPrefix):    freezer.BODIES,
+	string(receiptPrefix): freezer.RECEIPTS,
+}
+
+// frozenBlock is the records of a canonical block to append to freezer, all of them are empty if there is no
+// block with the height.
+type frozenBlock struct {
+	hash     types.Hash
+	header   []byte
+	body     []byte
+	receipts []byte
+}
+
+// loadFreezerCodec load the codec encoding the frozen items recorded in freezer, migration doesn't re-encode
+// the frozen items so it may differ from the codec of database. A freezer without the record is encoded by the
+// codec of database, which is recorded unless in read-only mode.
+func (blockStore *BlockStore) loadFreezerCodec() error {
+	codecName, ok := blockStore.freezer.Metadata(freezerCodecKey)
+	if !ok {
+		blockStore.freezerCodec = blockStore.codec
+		if blockStore.readOnly {
+			return nil
+		}
+		return blockStore.freezer.SetMetadata(freezerCodecKey, blockStore.codec.Name())
+	}
+	freezerCodec, err := codec.NewCodec(codecName)
+	if err != nil {
+		return fmt.Errorf("failed to create codec %s of freezer, as: %v", codecName, err)
+	}
+	blockStore.freezerCodec = freezerCodec
+	return nil
+}
+
+// freeze move the canonical blocks below the current height minus finality from database to freezer in
+// batches, stop when quit is closed or a batch fails.
+func (blockStore *BlockStore) freeze(finality uint64, quit <-chan struct{}) {
+	currentHeight := blockStore.GetCurrentBlockHeight()
+	if blockStore.GetCurrentBlock() == nil || currentHeight < finality {
+		return
+	}
+	target := currentHeight - finality + 1
+	for frozen := blockStore.freezer.Frozen(); frozen < target; {
+		select {
+		case <-quit:
+			return
+		default:
+		}
+		to := frozen + freezeBatchBlocks
+		if to > target {
+			to = target
+		}
+		next, err := blockStore.freezeBlocks(frozen, to)
+		if err != nil {
+			log.Error("Failed to freeze blocks from height %d, as: %v", frozen, err)
+			return
+		}
+		if next == frozen {
+			// the block at frozen height is still queued in write pipeline
+			return
+		}
+		frozen = next
+	}
+}
+
+// freezeBlocks append the canonical blocks with height in [from, to) to freezer, then delete their headers,
+// bodies, receipts and height mappings from database. The hash to height mappings, tx lookup indexes, address
+// index and blooms are kept in database. Return the next height to freeze, which is below to if a block in
+// range is still queued in write pipeline.
+func (blockStore *BlockStore) freezeBlocks(from, to uint64) (uint64, error) {
+	blockStore.lock.Lock()
+	defer blockStore.lock.Unlock()
+
+	blocks := make([]*frozenBlock, 0, to-from)
+	for height := from; height < to; height++ {
+		if _, ok := blockStore.pipeline.getCanonicalBlock(height); ok {
+			break
+		}
+		block, err := blockStore.loadFrozenBlock(height)
+		if err != nil {
+			return from, err
+		}
+		blocks = append(blocks, block)
+	}
+	if len(blocks) == 0 {
+		return from, nil
+	}
+
+	for i, block := range blocks {
+		var hashByte []byte
+		if block.hash != (types.Hash{}) {
+			hashByte = common.HashToBytes(block.hash)
+		}
+		err := blockStore.freezer.Append(from+uint64(i), hashByte, block.header, block.body, block.receipts)
+		if err != nil {
+			return from, err
+		}
+	}
+	// the records are deleted from database only after the frozen blocks are durable
+	err := blockStore.freezer.Sync()
+	if err != nil {
+		return from, err
+	}
+	batch := blockStore.store.NewBatch()
+	for i, block := range blocks {
+		if block.hash == (types.Hash{}) {
+			continue
+		}
+		hashByte := common.HashToBytes(block.hash)
+		batch.Delete(append(blockHeightPrefix, encodeBlockHeight(from+uint64(i))...))
+		batch.Delete(append(headerPrefix, hashByte...))
+		batch.Delete(append(bodyPrefix, hashByte...))
+		batch.Delete(append(blockPrefix, hashByte...))
+		batch.Delete(append(receiptPrefix, hashByte...))
+	}
+	err = batch.Write()
+	if err != nil {
+		// the records left in database are shadowed by freezer
+		log.Warn("Failed to delete the frozen blocks from database, as: %v", err)
+	}
+	next := from + uint64(len(blocks))
+	log.Debug("Froze blocks with height in [%d, %d)", from, next)
+	return next, nil
+}
+
+// loadFrozenBlock load the records of the canonical block with the height to freeze, the header and body are
+// encoded in the current format even if the block is a legacy whole block record. The records are encoded by
+// the codec of freezer.
+func (blockStore *BlockStore) loadFrozenBlock(height uint64) (*frozenBlock, error) {
+	blockHash, err := blockStore.getCanonicalHash(height)
+	if errors.Is(err, dbstore.ErrNotFound) {
+		// no block with this height, such as the height before genesis block
+		return &frozenBlock{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	block := &frozenBlock{hash: blockHash}
+	header, _, err := blockStore.getHeaderWithSize(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	block.header, err = blockStore.freezerCodec.Encode(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode block header %x, as: %v", blockHash, err)
+	}
+	if !blockStore.headersOnly {
+		body, _, err := blockStore.getBodyWithSize(blockHash)
+		if err == nil {
+			block.body, err = blockStore.freezerCodec.Encode(body)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode block body %x, as: %v", blockHash, err)
+			}
+		} else if !errors.Is(err, dbstore.ErrNotFound) && !errors.Is(err, ErrPruned) {
+			return nil, err
+		}
+	}
+	block.receipts, err = blockStore.store.Get(append(receiptPrefix, common.HashToBytes(blockHash)...))
+	if errors.Is(err, dbstore.ErrNotFound) {
+		return block, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get receipts with block hash %x, as: %w", blockHash, err)
+	}
+	if blockStore.freezerCodec.Name() != blockStore.codec.Name() {
+		var receipts []*types.Receipt
+		err = blockStore.decodeEntity(block.receipts, &receipts)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decode receipts with block hash %x, as: %v", dbstore.ErrCorrupted, blockHash, err)
+		}
+		block.receipts, err = blockStore.freezerCodec.Encode(receipts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode receipts with block hash %x, as: %v", blockHash, err)
+		}
+	}
+	return block, nil
+}
+
+// getFrozen get the record of a frozen canonical block from the freezer table of the record prefix, return
+// dbstore.ErrNotFound if the block is not frozen or the record is empty.
+func (blockStore *BlockStore) getFrozen(prefix []byte, hash types.Hash) ([]byte, error) {
+	table, ok := frozenTables[string(prefix)]
+	if !ok || blockStore.freezer.Frozen() == 0 {
+		return nil, dbstore.ErrNotFound
+	}
+	heightByte, err := blockStore.store.Get(append(headerHeightPrefix, common.HashToBytes(hash)...))
+	if err != nil {
+		return nil, err
+	}
+	if len(heightByte) != 8 {
+		return nil, dbstore.ErrNotFound
+	}
+	height := binary.BigEndian.Uint64(heightByte)
+	frozenHash, err := blockStore.getFrozenHash(height)
+	if err != nil {
+		return nil, err
+	}
+	if frozenHash != hash {
+		// side chain blocks are never frozen
+		return nil, dbstore.ErrNotFound
+	}
+	item, err := blockStore.freezer.Retrieve(table, height)
+	if err != nil {
+		return nil, err
+	}
+	if len(item) == 0 {
+		return nil, dbstore.ErrNotFound
+	}
+	return item, nil
+}
+
+// getFrozenHash get the hash of the frozen canonical block with the height, return dbstore.ErrNotFound if
+// the height is not frozen or there is no block with the height.
+func (blockStore *BlockStore) getFrozenHash(height uint64) (types.Hash, error) {
+	hashByte, err := blockStore.freezer.Retrieve(freezer.HASHES, height)
+	if err != nil {
+		return types.Hash{}, err
+	}
+	if len(hashByte) == 0 {
+		return types.Hash{}, dbstore.ErrNotFound
+	}
+	return common.BytesToHash(hashByte), nil
+}
+
+// checkFrozen return error if the canonical block with the height is frozen, the frozen blocks are immutable.
+func (blockStore *BlockStore) checkFrozen(height uint64) error {
+	if frozen := blockStore.freezer.Frozen(); height < frozen {
+		return fmt.Errorf("the blocks below height %d are frozen", frozen)
+	}
+	return nil
+}
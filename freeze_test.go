@@ -0,0 +1,134 @@
+package blockstore
+
+import (
+	"errors"
+	"github.com/DSiSc/blockstore/codec"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/config"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/blockstore/dbstore/leveldbstore"
+	"github.com/DSiSc/blockstore/freezer"
+	"github.com/DSiSc/craft/types"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// test freeze the finalized blocks and read them from freezer
+func TestBlockStore_FreezeBlocks(t *testing.T) {
+	assert := assert.New(t)
+	blockStore := mockBlockStore(t, withAddressIndex, withCaches(10), withFreezer(t.TempDir(), 100))
+	blocks := writeMockChain(t, blockStore, 5)
+	defer blockStore.Close()
+	assert.Equal(uint64(0), blockStore.freezer.Frozen())
+	blockStore.freeze(2, make(chan struct{}))
+	assert.Equal(uint64(4), blockStore.freezer.Frozen())
+	blockStore.blockCache.Purge()
+
+	for _, block := range blocks[:3] {
+		_, err := blockStore.store.Get(append(headerPrefix, common.HashToBytes(block.HeaderHash)...))
+		assert.True(errors.Is(err, dbstore.ErrNotFound))
+		_, err = blockStore.store.Get(append(blockHeightPrefix, encodeBlockHeight(block.Header.Height)...))
+		assert.True(errors.Is(err, dbstore.ErrNotFound))
+
+		frozenBlock, err := blockStore.GetBlockByHeight(block.Header.Height)
+		assert.Nil(err)
+		assert.Equal(block.HeaderHash, frozenBlock.HeaderHash)
+		assert.Equal(block.Header.Height, frozenBlock.Header.Height)
+		assert.Equal(1, len(frozenBlock.Transactions))
+		receipts, err := blockStore.GetReceiptByBlockHash(block.HeaderHash)
+		assert.Nil(err)
+		assert.Equal(1, len(receipts))
+		tx, blockHash, _, _, err := blockStore.GetTransactionByHash(common.TxHash(block.Transactions[0]))
+		assert.Nil(err)
+		assert.NotNil(tx)
+		assert.Equal(block.HeaderHash, blockHash)
+	}
+	_, err := blockStore.store.Get(append(headerPrefix, common.HashToBytes(blocks[3].HeaderHash)...))
+	assert.Nil(err)
+
+	heights := make([]uint64, 0)
+	assert.Nil(blockStore.GetBlocksByRange(0, 5, 0, func(block *types.Block) bool {
+		heights = append(heights, block.Header.Height)
+		return true
+	}))
+	assert.Equal([]uint64{1, 2, 3, 4, 5}, heights)
+	logs, err := blockStore.FilterLogs(&LogFilter{FromHeight: 1, ToHeight: 5})
+	assert.Nil(err)
+	assert.Equal(0, len(logs))
+	report, err := blockStore.Verify(false)
+	assert.Nil(err)
+	assert.True(report.Consistent())
+
+	// the frozen blocks are immutable
+	assert.NotNil(blockStore.Rollback(2))
+	assert.Nil(blockStore.Rollback(3))
+	assert.Equal(uint64(3), blockStore.GetCurrentBlockHeight())
+	_, err = blockStore.Backup(t.TempDir(), false)
+	assert.NotNil(err)
+}
+
+// test the background chain freezer freezes the blocks after they are written
+func TestBlockStore_BackgroundFreezer(t *testing.T) {
+	assert := assert.New(t)
+	blockStore := mockBlockStore(t, withAddressIndex, withCaches(10), withFreezer(t.TempDir(), 1))
+	blocks := writeMockChain(t, blockStore, 3)
+	for i := 0; i < 100 && blockStore.freezer.Frozen() < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(uint64(3), blockStore.freezer.Frozen())
+	block, err := blockStore.GetBlockByHash(blocks[1].HeaderHash)
+	assert.Nil(err)
+	assert.Equal(blocks[1].HeaderHash, block.HeaderHash)
+	assert.Nil(blockStore.Close())
+	_, err = blockStore.freezer.Retrieve(freezer.HEADERS, 1)
+	assert.True(errors.Is(err, dbstore.ErrClosed))
+}
+
+// test the frozen blocks keep their codec after the database is migrated to another codec
+func TestBlockStore_FreezerCodec(t *testing.T) {
+	assert := assert.New(t)
+	blockStoreConfig := mockTempBlockStoreConfig(t, withLevelDB, withFreezer(t.TempDir(), 0))
+	blockStore, err := NewBlockStore(blockStoreConfig)
+	assert.Nil(err)
+	blocks := writeMockChain(t, blockStore, 5)
+	blockStore.freeze(2, make(chan struct{}))
+	assert.Equal(uint64(4), blockStore.freezer.Frozen())
+	assert.Nil(blockStore.Close())
+
+	store, err := leveldbstore.NewLevelDBStore(blockStoreConfig.DataPath)
+	assert.Nil(err)
+	assert.Nil(MigrateDatabase(store, codec.RLP, nil))
+	assert.Nil(store.Close())
+
+	blockStore, err = NewBlockStore(blockStoreConfig)
+	assert.Nil(err)
+	defer blockStore.Close()
+	assert.Equal(codec.RLP, blockStore.codec.Name())
+	assert.Equal(codec.JSON, blockStore.freezerCodec.Name())
+	blockStore.freeze(1, make(chan struct{}))
+	assert.Equal(uint64(5), blockStore.freezer.Frozen())
+	for _, block := range blocks {
+		blockSaved, err := blockStore.GetBlockByHeight(block.Header.Height)
+		assert.Nil(err)
+		assert.Equal(block.HeaderHash, blockSaved.HeaderHash)
+		receipts, err := blockStore.GetReceiptByBlockHash(block.HeaderHash)
+		assert.Nil(err)
+		assert.Equal(1, len(receipts))
+	}
+}
+
+// test freezer can't be enabled along with encryption
+func TestBlockStore_FreezerEncryption(t *testing.T) {
+	assert := assert.New(t)
+	freezerPath := filepath.Join(t.TempDir(), "freezer")
+	_, err := NewBlockStore(mockTempBlockStoreConfig(t, withFreezer(freezerPath, 0), func(blockStoreConfig *config.BlockStoreConfig) {
+		blockStoreConfig.EncryptionKey = "1:" + strings.Repeat("01", 32)
+	}))
+	assert.NotNil(err)
+	_, err = os.Stat(freezerPath)
+	assert.True(os.IsNotExist(err))
+}
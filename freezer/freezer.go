@@ -0,0 +1,261 @@
+package freezer
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/DSiSc/blockstore/dbstore"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// names of the freezer tables
+const (
+	HASHES   = "hashes"
+	HEADERS  = "headers"
+	BODIES   = "bodies"
+	RECEIPTS = "receipts"
+)
+
+var tableNames = []string{HASHES, HEADERS, BODIES, RECEIPTS}
+
+// the name of the file holding the metadata of freezer
+const metadataFile = "metadata.json"
+
+// Freezer stores the finalized blocks in append-only flat files, one table for the block hashes, headers, bodies
+// and receipts respectively. Item n of each table belongs to the block with height n, the item is empty if there
+// is no such block or the block has no such data. A nil Freezer is a disabled freezer which holds nothing.
+type Freezer struct {
+	frozen   uint64 // Number of frozen blocks, accessed atomically so keep it first for 64-bit alignment
+	dir      string
+	tables   map[string]*table
+	metadata map[string]string // Metadata recorded by the freezer user, such as the codec of the items
+	readOnly bool
+	closed   bool
+	lock     sync.RWMutex
+}
+
+// NewFreezer open the freezer in dir, creating it if not exist. The items appended by an interrupted Append
+// are dropped, so all tables have the same number of items. In read-only mode the freezer must exist, its
+// files are not modified and Append returns dbstore.ErrReadOnly.
+func NewFreezer(dir string, readOnly bool) (*Freezer, error) {
+	var err error
+	if readOnly {
+		_, err = os.Stat(dir)
+	} else {
+		err = os.MkdirAll(dir, 0755)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open freezer directory %s, as: %v", dir, err)
+	}
+	metadata, err := loadMetadata(dir)
+	if err != nil {
+		return nil, err
+	}
+	freezer := &Freezer{dir: dir, tables: make(map[string]*table), metadata: metadata, readOnly: readOnly}
+	for i, name := range tableNames {
+		t, err := openTable(dir, name, readOnly)
+		if err != nil {
+			freezer.closeTables()
+			return nil, err
+		}
+		freezer.tables[name] = t
+		if i == 0 || t.items < freezer.frozen {
+			freezer.frozen = t.items
+		}
+	}
+	for name, t := range freezer.tables {
+		if t.items == freezer.frozen || readOnly {
+			continue
+		}
+		err = t.truncate(freezer.frozen)
+		if err != nil {
+			freezer.closeTables()
+			return nil, fmt.Errorf("failed to truncate table %s to %d items, as: %v", name, freezer.frozen, err)
+		}
+	}
+	return freezer, nil
+}
+
+// Frozen get the number of frozen blocks, which is also the height of the next block to freeze.
+func (freezer *Freezer) Frozen() uint64 {
+	if freezer == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&freezer.frozen)
+}
+
+// Retrieve get the item of the block with the height from table, return dbstore.ErrNotFound if the block is
+// not frozen.
+func (freezer *Freezer) Retrieve(name string, height uint64) ([]byte, error) {
+	if freezer == nil {
+		return nil, dbstore.ErrNotFound
+	}
+	freezer.lock.RLock()
+	defer freezer.lock.RUnlock()
+	if freezer.closed {
+		return nil, dbstore.ErrClosed
+	}
+	t, ok := freezer.tables[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown freezer table %s", name)
+	}
+	if height >= atomic.LoadUint64(&freezer.frozen) {
+		return nil, dbstore.ErrNotFound
+	}
+	item, err := t.retrieve(height)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read item %d of table %s, as: %v", dbstore.ErrCorrupted, height, name, err)
+	}
+	return item, nil
+}
+
+// Append freeze the block with the height, which must be the next block to freeze. The tables are rolled back
+// if any of them fails.
+func (freezer *Freezer) Append(height uint64, hash, header, body, receipts []byte) error {
+	freezer.lock.Lock()
+	defer freezer.lock.Unlock()
+	if freezer.closed {
+		return dbstore.ErrClosed
+	}
+	if freezer.readOnly {
+		return dbstore.ErrReadOnly
+	}
+	frozen := atomic.LoadUint64(&freezer.frozen)
+	if height != frozen {
+		return fmt.Errorf("can not freeze block with height %d, as the next block to freeze is %d", height, frozen)
+	}
+	items := map[string][]byte{HASHES: hash, HEADERS: header, BODIES: body, RECEIPTS: receipts}
+	for _, name := range tableNames {
+		err := freezer.tables[name].append(items[name])
+		if err != nil {
+			for _, t := range freezer.tables {
+				t.truncate(frozen)
+			}
+			return fmt.Errorf("failed to append item %d to table %s, as: %v", height, name, err)
+		}
+	}
+	atomic.StoreUint64(&freezer.frozen, frozen+1)
+	return nil
+}
+
+// Metadata get the metadata value of the key, return false if it is not recorded.
+func (freezer *Freezer) Metadata(key string) (string, bool) {
+	if freezer == nil {
+		return "", false
+	}
+	freezer.lock.RLock()
+	defer freezer.lock.RUnlock()
+	value, ok := freezer.metadata[key]
+	return value, ok
+}
+
+// SetMetadata record the metadata value of the key, the metadata file is replaced atomically.
+func (freezer *Freezer) SetMetadata(key, value string) error {
+	freezer.lock.Lock()
+	defer freezer.lock.Unlock()
+	if freezer.closed {
+		return dbstore.ErrClosed
+	}
+	if freezer.readOnly {
+		return dbstore.ErrReadOnly
+	}
+	metadata := make(map[string]string, len(freezer.metadata)+1)
+	for k, v := range freezer.metadata {
+		metadata[k] = v
+	}
+	metadata[key] = value
+	metadataByte, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode freezer metadata, as: %v", err)
+	}
+	path := filepath.Join(freezer.dir, metadataFile)
+	err = writeFileSync(path+".tmp", metadataByte)
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write freezer metadata, as: %v", err)
+	}
+	freezer.metadata = metadata
+	return nil
+}
+
+// loadMetadata load the metadata file in dir, the metadata is empty if the file doesn't exist.
+func loadMetadata(dir string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	metadataByte, err := ioutil.ReadFile(filepath.Join(dir, metadataFile))
+	if os.IsNotExist(err) {
+		return metadata, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read freezer metadata, as: %v", err)
+	}
+	err = json.Unmarshal(metadataByte, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode freezer metadata, as: %v", dbstore.ErrCorrupted, err)
+	}
+	return metadata, nil
+}
+
+// writeFileSync write the data to the file and flush it to stable storage.
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Sync flush the frozen blocks to stable storage.
+func (freezer *Freezer) Sync() error {
+	freezer.lock.Lock()
+	defer freezer.lock.Unlock()
+	if freezer.closed {
+		return dbstore.ErrClosed
+	}
+	if freezer.readOnly {
+		return nil
+	}
+	for name, t := range freezer.tables {
+		err := t.sync()
+		if err != nil {
+			return fmt.Errorf("failed to sync table %s, as: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// Close close the freezer, the operations after close return dbstore.ErrClosed.
+func (freezer *Freezer) Close() error {
+	if freezer == nil {
+		return nil
+	}
+	freezer.lock.Lock()
+	defer freezer.lock.Unlock()
+	if freezer.closed {
+		return nil
+	}
+	freezer.closed = true
+	return freezer.closeTables()
+}
+
+// closeTables close the files of all opened tables.
+func (freezer *Freezer) closeTables() error {
+	var err error
+	for name, t := range freezer.tables {
+		if closeErr := t.close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close table %s, as: %v", name, closeErr)
+		}
+	}
+	return err
+}
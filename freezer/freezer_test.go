@@ -0,0 +1,161 @@
+package freezer
+
+import (
+	"errors"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const freezerDir = "./freezerdata"
+
+// test append and retrieve frozen blocks
+func TestFreezer_AppendAndRetrieve(t *testing.T) {
+	defer os.RemoveAll(freezerDir)
+	assert := assert.New(t)
+	freezer, err := NewFreezer(freezerDir, false)
+	assert.Nil(err)
+	assert.Equal(uint64(0), freezer.Frozen())
+
+	assert.Nil(freezer.Append(0, nil, nil, nil, nil))
+	assert.Nil(freezer.Append(1, []byte("hash1"), []byte("header1"), []byte("body1"), []byte("receipts1")))
+	assert.NotNil(freezer.Append(3, []byte("hash3"), nil, nil, nil))
+	assert.Equal(uint64(2), freezer.Frozen())
+
+	item, err := freezer.Retrieve(HASHES, 0)
+	assert.Nil(err)
+	assert.Empty(item)
+	item, err = freezer.Retrieve(BODIES, 1)
+	assert.Nil(err)
+	assert.Equal([]byte("body1"), item)
+	_, err = freezer.Retrieve(HEADERS, 2)
+	assert.True(errors.Is(err, dbstore.ErrNotFound))
+	_, err = freezer.Retrieve("unknown", 1)
+	assert.NotNil(err)
+
+	assert.Nil(freezer.Sync())
+	assert.Nil(freezer.Close())
+	_, err = freezer.Retrieve(HEADERS, 1)
+	assert.True(errors.Is(err, dbstore.ErrClosed))
+	assert.True(errors.Is(freezer.Append(2, nil, nil, nil, nil), dbstore.ErrClosed))
+
+	// frozen blocks are kept after reopening
+	freezer, err = NewFreezer(freezerDir, false)
+	assert.Nil(err)
+	defer freezer.Close()
+	assert.Equal(uint64(2), freezer.Frozen())
+	item, err = freezer.Retrieve(RECEIPTS, 1)
+	assert.Nil(err)
+	assert.Equal([]byte("receipts1"), item)
+}
+
+// test reopening freezer drops the items of an interrupted append
+func TestNewFreezer_Repair(t *testing.T) {
+	defer os.RemoveAll(freezerDir)
+	assert := assert.New(t)
+	freezer, err := NewFreezer(freezerDir, false)
+	assert.Nil(err)
+	assert.Nil(freezer.Append(0, []byte("hash0"), []byte("header0"), []byte("body0"), []byte("receipts0")))
+	assert.Nil(freezer.Append(1, []byte("hash1"), []byte("header1"), []byte("body1"), []byte("receipts1")))
+	assert.Nil(freezer.Close())
+
+	// the data of the last body is not completely written
+	dataFile := filepath.Join(freezerDir, BODIES+".dat")
+	info, err := os.Stat(dataFile)
+	assert.Nil(err)
+	assert.Nil(os.Truncate(dataFile, info.Size()-1))
+	// a partial index entry is left in receipts table
+	indexFile, err := os.OpenFile(filepath.Join(freezerDir, RECEIPTS+".idx"), os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(err)
+	_, err = indexFile.Write([]byte{0, 1, 2})
+	assert.Nil(err)
+	indexFile.Close()
+
+	freezer, err = NewFreezer(freezerDir, false)
+	assert.Nil(err)
+	defer freezer.Close()
+	assert.Equal(uint64(1), freezer.Frozen())
+	item, err := freezer.Retrieve(BODIES, 0)
+	assert.Nil(err)
+	assert.Equal([]byte("body0"), item)
+	assert.Nil(freezer.Append(1, []byte("hash1"), []byte("header1"), []byte("body1"), []byte("receipts1")))
+	item, err = freezer.Retrieve(RECEIPTS, 1)
+	assert.Nil(err)
+	assert.Equal([]byte("receipts1"), item)
+}
+
+// test open freezer in read-only mode
+func TestNewFreezer_ReadOnly(t *testing.T) {
+	defer os.RemoveAll(freezerDir)
+	assert := assert.New(t)
+	_, err := NewFreezer(freezerDir, true)
+	assert.NotNil(err)
+	freezer, err := NewFreezer(freezerDir, false)
+	assert.Nil(err)
+	assert.Nil(freezer.Append(0, []byte("hash0"), []byte("header0"), []byte("body0"), []byte("receipts0")))
+	assert.Nil(freezer.Append(1, []byte("hash1"), []byte("header1"), []byte("body1"), []byte("receipts1")))
+	assert.Nil(freezer.Close())
+
+	// the item of an interrupted append is ignored but not truncated
+	dataFile := filepath.Join(freezerDir, BODIES+".dat")
+	info, err := os.Stat(dataFile)
+	assert.Nil(err)
+	assert.Nil(os.Truncate(dataFile, info.Size()-1))
+	indexInfo, err := os.Stat(filepath.Join(freezerDir, HASHES+".idx"))
+	assert.Nil(err)
+
+	freezer, err = NewFreezer(freezerDir, true)
+	assert.Nil(err)
+	assert.Equal(uint64(1), freezer.Frozen())
+	item, err := freezer.Retrieve(HEADERS, 0)
+	assert.Nil(err)
+	assert.Equal([]byte("header0"), item)
+	assert.True(errors.Is(freezer.Append(1, nil, nil, nil, nil), dbstore.ErrReadOnly))
+	assert.Nil(freezer.Sync())
+	assert.Nil(freezer.Close())
+	newIndexInfo, err := os.Stat(filepath.Join(freezerDir, HASHES+".idx"))
+	assert.Nil(err)
+	assert.Equal(indexInfo.Size(), newIndexInfo.Size())
+}
+
+// test record the metadata of freezer
+func TestFreezer_Metadata(t *testing.T) {
+	defer os.RemoveAll(freezerDir)
+	assert := assert.New(t)
+	freezer, err := NewFreezer(freezerDir, false)
+	assert.Nil(err)
+	_, ok := freezer.Metadata("codec")
+	assert.False(ok)
+	assert.Nil(freezer.SetMetadata("codec", "json"))
+	assert.Nil(freezer.SetMetadata("codec", "rlp"))
+	value, _ := freezer.Metadata("codec")
+	assert.Equal("rlp", value)
+	assert.Nil(freezer.Close())
+
+	freezer, err = NewFreezer(freezerDir, true)
+	assert.Nil(err)
+	value, ok = freezer.Metadata("codec")
+	assert.True(ok)
+	assert.Equal("rlp", value)
+	assert.True(errors.Is(freezer.SetMetadata("codec", "json"), dbstore.ErrReadOnly))
+	assert.Nil(freezer.Close())
+
+	assert.Nil(ioutil.WriteFile(filepath.Join(freezerDir, metadataFile), []byte("{"), 0644))
+	_, err = NewFreezer(freezerDir, false)
+	assert.True(errors.Is(err, dbstore.ErrCorrupted))
+}
+
+// test nil freezer holds nothing
+func TestFreezer_Nil(t *testing.T) {
+	assert := assert.New(t)
+	var freezer *Freezer
+	assert.Equal(uint64(0), freezer.Frozen())
+	_, err := freezer.Retrieve(HASHES, 0)
+	assert.True(errors.Is(err, dbstore.ErrNotFound))
+	_, ok := freezer.Metadata("codec")
+	assert.False(ok)
+	assert.Nil(freezer.Close())
+}
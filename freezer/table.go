@@ -0,0 +1,182 @@
+package freezer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// indexEntrySize is the size of an index entry, which is the end offset of the item in data file.
+const indexEntrySize = 8
+
+// table is an append-only table of items stored in a data file, with a fixed-width index file recording the
+// end offset of each item. Item n starts at the end offset of item n-1, or 0 for the first item.
+type table struct {
+	data  *os.File
+	index *os.File
+	items uint64 // Number of items in table
+	size  uint64 // Size of the data of all items
+}
+
+// openTable open the table files of name in dir, creating them if not exist. The partial index entry and the
+// items whose data is not completely written by an interrupted append are dropped. In read-only mode the files
+// must exist and are not modified, the dropped items are only ignored.
+func openTable(dir, name string, readOnly bool) (*table, error) {
+	flag := os.O_RDWR | os.O_CREATE
+	if readOnly {
+		flag = os.O_RDONLY
+	}
+	data, err := os.OpenFile(filepath.Join(dir, name+".dat"), flag, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open data file of table %s, as: %v", name, err)
+	}
+	index, err := os.OpenFile(filepath.Join(dir, name+".idx"), flag, 0644)
+	if err != nil {
+		data.Close()
+		return nil, fmt.Errorf("failed to open index file of table %s, as: %v", name, err)
+	}
+	t := &table{data: data, index: index}
+	err = t.repair(readOnly)
+	if err != nil {
+		t.close()
+		return nil, fmt.Errorf("failed to repair table %s, as: %v", name, err)
+	}
+	return t, nil
+}
+
+// repair drop the items not completely written and truncate the files to the remaining items, the files are
+// not truncated in read-only mode.
+func (t *table) repair(readOnly bool) error {
+	indexInfo, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	dataInfo, err := t.data.Stat()
+	if err != nil {
+		return err
+	}
+	items := uint64(indexInfo.Size()) / indexEntrySize
+	for ; items > 0; items-- {
+		end, err := t.end(items - 1)
+		if err != nil {
+			return err
+		}
+		if end <= uint64(dataInfo.Size()) {
+			break
+		}
+	}
+	if readOnly {
+		return t.drop(items)
+	}
+	return t.truncate(items)
+}
+
+// end read the end offset of item n in data file from index.
+func (t *table) end(n uint64) (uint64, error) {
+	entry := make([]byte, indexEntrySize)
+	_, err := t.index.ReadAt(entry, int64(n*indexEntrySize))
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(entry), nil
+}
+
+// append write the item as the next item of table, the data is written before the index entry so an
+// interrupted append leaves no index entry pointing to the missing data.
+func (t *table) append(item []byte) error {
+	_, err := t.data.WriteAt(item, int64(t.size))
+	if err != nil {
+		return err
+	}
+	entry := make([]byte, indexEntrySize)
+	binary.BigEndian.PutUint64(entry, t.size+uint64(len(item)))
+	_, err = t.index.WriteAt(entry, int64(t.items*indexEntrySize))
+	if err != nil {
+		return err
+	}
+	t.size += uint64(len(item))
+	t.items++
+	return nil
+}
+
+// retrieve read item n of table.
+func (t *table) retrieve(n uint64) ([]byte, error) {
+	var start uint64
+	if n > 0 {
+		var err error
+		start, err = t.end(n - 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	end, err := t.end(n)
+	if err != nil {
+		return nil, err
+	}
+	if end < start {
+		return nil, fmt.Errorf("invalid item %d with offset range [%d, %d)", n, start, end)
+	}
+	item := make([]byte, end-start)
+	_, err = t.data.ReadAt(item, int64(start))
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// truncate drop the items from n on.
+func (t *table) truncate(n uint64) error {
+	var size uint64
+	if n > 0 {
+		var err error
+		size, err = t.end(n - 1)
+		if err != nil {
+			return err
+		}
+	}
+	err := t.index.Truncate(int64(n * indexEntrySize))
+	if err != nil {
+		return err
+	}
+	err = t.data.Truncate(int64(size))
+	if err != nil {
+		return err
+	}
+	t.items = n
+	t.size = size
+	return nil
+}
+
+// drop ignore the items from n on without truncating the files.
+func (t *table) drop(n uint64) error {
+	var size uint64
+	if n > 0 {
+		var err error
+		size, err = t.end(n - 1)
+		if err != nil {
+			return err
+		}
+	}
+	t.items = n
+	t.size = size
+	return nil
+}
+
+// sync flush the data and index of table to stable storage.
+func (t *table) sync() error {
+	err := t.data.Sync()
+	if err != nil {
+		return err
+	}
+	return t.index.Sync()
+}
+
+// close close the table files.
+func (t *table) close() error {
+	err := t.data.Close()
+	if indexErr := t.index.Close(); err == nil {
+		err = indexErr
+	}
+	return err
+}
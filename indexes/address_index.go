@@ -0,0 +1,9 @@
+package indexes
+
+import "github.com/DSiSc/craft/types"
+
+// AddressTransaction is a transaction sent from or to an address, along with its position in the chain.
+type AddressTransaction struct {
+	Transaction *types.Transaction
+	EntityLookupIndex
+}
@@ -0,0 +1,64 @@
+package indexes
+
+import (
+	"crypto/sha256"
+	"github.com/DSiSc/craft/types"
+)
+
+const (
+	// bytes of the bloom filter
+	bloomByteLength = uint(len(types.Bloom{}))
+	// bits of the bloom filter
+	bloomBitLength = 8 * bloomByteLength
+)
+
+// CreateBloom create the bloom filter of the log addresses and topics in receipts.
+func CreateBloom(receipts []*types.Receipt) types.Bloom {
+	var bloom types.Bloom
+	for _, receipt := range receipts {
+		if receipt == nil {
+			continue
+		}
+		for _, log := range receipt.Logs {
+			BloomAdd(&bloom, log.Address[:])
+			for _, topic := range log.Topics {
+				BloomAdd(&bloom, topic[:])
+			}
+		}
+	}
+	return bloom
+}
+
+// BloomAdd add the data to bloom filter, three bits are set for each data.
+func BloomAdd(bloom *types.Bloom, data []byte) {
+	for _, bit := range bloomBits(data) {
+		bloom[bloomByteLength-1-bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// BloomLookup check whether the data may be in bloom filter.
+func BloomLookup(bloom types.Bloom, data []byte) bool {
+	for _, bit := range bloomBits(data) {
+		if bloom[bloomByteLength-1-bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// BloomMerge merge the bloom filter src into dst.
+func BloomMerge(dst *types.Bloom, src types.Bloom) {
+	for i := range dst {
+		dst[i] |= src[i]
+	}
+}
+
+// bloomBits get the bits of the data in bloom filter.
+func bloomBits(data []byte) [3]uint {
+	hash := sha256.Sum256(data)
+	var bits [3]uint
+	for i := range bits {
+		bits[i] = (uint(hash[2*i])<<8 | uint(hash[2*i+1])) % bloomBitLength
+	}
+	return bits
+}
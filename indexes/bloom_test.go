@@ -0,0 +1,25 @@
+package indexes
+
+import (
+	"github.com/DSiSc/craft/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// test create bloom and lookup
+func TestCreateBloom(t *testing.T) {
+	assert := assert.New(t)
+	addr := types.Address{0x1}
+	topic := types.Hash{0x2}
+	receipts := []*types.Receipt{
+		{Logs: []*types.Log{{Address: addr, Topics: []types.Hash{topic}}}},
+	}
+	bloom := CreateBloom(receipts)
+	assert.True(BloomLookup(bloom, addr[:]))
+	assert.True(BloomLookup(bloom, topic[:]))
+	assert.False(BloomLookup(types.Bloom{}, addr[:]))
+
+	var merged types.Bloom
+	BloomMerge(&merged, bloom)
+	assert.Equal(bloom, merged)
+}
@@ -2,7 +2,10 @@ package blockstore
 
 import (
 	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/blockstore/indexes"
+	"github.com/DSiSc/blockstore/metrics"
 	"github.com/DSiSc/craft/types"
+	"io"
 )
 
 // BlockStoreAPI block-store module public api.
@@ -21,6 +24,21 @@ type BlockStoreAPI interface {
 	// GetBlockByHeight get block by height.
 	GetBlockByHeight(height uint64) (*types.Block, error)
 
+	// GetHeaderByHash get block header by block hash.
+	GetHeaderByHash(hash types.Hash) (*types.Header, error)
+
+	// GetHeaderByHeight get block header by height.
+	GetHeaderByHeight(height uint64) (*types.Header, error)
+
+	// GetBodyByHash get block body by block hash.
+	GetBodyByHash(hash types.Hash) (*BlockBody, error)
+
+	// GetBlocksByRange get the canonical blocks with height in [from, to], each block is passed to the callback.
+	GetBlocksByRange(from, to uint64, maxBytes int, callback func(block *types.Block) bool) error
+
+	// GetHeadersByRange get the canonical block headers with height in [from, to], each header is passed to the callback.
+	GetHeadersByRange(from, to uint64, maxBytes int, callback func(header *types.Header) bool) error
+
 	// GetCurrentBlock get current block.
 	GetCurrentBlock() *types.Block
 
@@ -37,8 +55,50 @@ type BlockStoreAPI interface {
 	GetReceiptByTxHash(txHash types.Hash) (*types.Receipt, types.Hash, uint64, uint64, error)
 
 	// GetReceiptByHash get receipt by relative block's hash
-	GetReceiptByBlockHash(txHash types.Hash) []*types.Receipt
+	GetReceiptByBlockHash(txHash types.Hash) ([]*types.Receipt, error)
+
+	// GetTransactionsByAddress get the transactions sent from or to the address in block height range.
+	GetTransactionsByAddress(addr types.Address, fromHeight, toHeight uint64, limit int) ([]*indexes.AddressTransaction, error)
+
+	// FilterLogs get the logs matching the filter from the receipts of canonical blocks.
+	FilterLogs(filter *LogFilter) ([]*types.Log, error)
+
+	// Reorg switch the canonical chain to the chain ending with the specified block.
+	Reorg(newHeadHash types.Hash) error
+
+	// Rollback remove all the blocks above the specified height.
+	Rollback(toHeight uint64) error
+
+	// ReindexFrom delete and regenerate the indexes of the canonical blocks from the specified height.
+	ReindexFrom(height uint64) error
+
+	// Verify check the database is internally consistent, and repair the indexes if repair is true.
+	Verify(repair bool) (*VerifyReport, error)
+
+	// ExportChain write the canonical blocks in [from, to] with their receipts to w in the portable export format.
+	ExportChain(w io.Writer, from, to uint64, compress bool) error
+
+	// ImportChain write the blocks in the export stream read from r, and return the number of imported blocks.
+	ImportChain(r io.Reader) (uint64, error)
+
+	// View create a read-only view of the committed state of the block store, which must be released after use.
+	View() (*BlockStoreView, error)
+
+	// Backup copy the committed state of the block store to the leveldb database in destDir, fully or incrementally.
+	Backup(destDir string, incremental bool) (uint64, error)
+
+	// Flush wait until the blocks queued in async write mode are committed.
+	Flush() error
+
+	// CacheStats get the hit/miss counters and the number of entries of the block store caches.
+	CacheStats() CacheStats
+
+	// Metrics get the registry of the block store metrics, return nil if metrics is disabled.
+	Metrics() *metrics.Registry
 
 	// Delete removes the key from the key-value data store.
 	Delete(key []byte) error
+
+	// Close close the block store, the operations after close return dbstore.ErrClosed.
+	Close() error
 }
@@ -0,0 +1,266 @@
+package blockstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/blockstore/indexes"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+)
+
+const (
+	// bloomSectionIndexKey tracks the section size and the first indexed section start height of section bloom index.
+	bloomSectionIndexKey = "BloomSectionIndex"
+)
+
+var (
+	blockBloomPrefix   = []byte("l") // blockBloomPrefix + block hash -> block bloom
+	sectionBloomPrefix = []byte("s") // sectionBloomPrefix + section number -> section bloom
+)
+
+// LogFilter is the criteria of filtering logs in canonical blocks.
+type LogFilter struct {
+	FromHeight uint64
+	ToHeight   uint64
+	// Addresses of the contracts which emit the logs, all addresses match if empty.
+	Addresses []types.Address
+	// Topics of the logs by position, all topics at the position match if empty.
+	Topics [][]types.Hash
+}
+
+// FilterLogs get the logs matching the filter from the receipts of canonical blocks, in ascending order of position.
+// The blocks are skipped by section bloom index and block bloom before decoding receipts.
+func (blockStore *BlockStore) FilterLogs(filter *LogFilter) ([]*types.Log, error) {
+	if filter.FromHeight > filter.ToHeight {
+		return nil, fmt.Errorf("invalid block range [%d, %d]", filter.FromHeight, filter.ToHeight)
+	}
+	if err := blockStore.checkPruned(filter.FromHeight); err != nil {
+		return nil, err
+	}
+	toHeight := filter.ToHeight
+	if currentHeight := blockStore.GetCurrentBlockHeight(); toHeight > currentHeight {
+		toHeight = currentHeight
+	}
+
+	logs := make([]*types.Log, 0)
+	for height := filter.FromHeight; height <= toHeight; height++ {
+		// skip the whole section if section bloom doesn't match
+		if blockStore.bloomSectionSize > 0 && (height == filter.FromHeight || height%blockStore.bloomSectionSize == 0) {
+			mayMatch, err := blockStore.sectionMayMatch(height, filter)
+			if err != nil {
+				return nil, err
+			}
+			if !mayMatch {
+				height = (height/blockStore.bloomSectionSize+1)*blockStore.bloomSectionSize - 1
+				continue
+			}
+		}
+
+		blockHash, err := blockStore.getCanonicalHash(height)
+		if err != nil {
+			return nil, err
+		}
+		bloom, err := blockStore.getBlockBloom(blockHash)
+		if err == nil && !bloomMatch(bloom, filter) {
+			continue
+		}
+		receipts, err := blockStore.GetReceiptByBlockHash(blockHash)
+		if errors.Is(err, dbstore.ErrNotFound) {
+			// block written without receipts
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, receipt := range receipts {
+			for _, l := range receipt.Logs {
+				if logMatch(l, filter) {
+					logs = append(logs, l)
+				}
+			}
+		}
+	}
+	return logs, nil
+}
+
+// sectionMayMatch check whether the section contains the height may have matched logs. The queued blocks are
+// merged into section blooms when committed, so the section with queued canonical blocks may match.
+func (blockStore *BlockStore) sectionMayMatch(height uint64, filter *LogFilter) (bool, error) {
+	if blockStore.bloomSectionSize == 0 || height < blockStore.bloomSectionsFrom {
+		return true, nil
+	}
+	section := height / blockStore.bloomSectionSize
+	if blockStore.pipeline.hasCanonicalBlockIn(section*blockStore.bloomSectionSize, (section+1)*blockStore.bloomSectionSize-1) {
+		return true, nil
+	}
+	bloomByte, err := blockStore.store.Get(append(sectionBloomPrefix, encodeBlockHeight(section)...))
+	if errors.Is(err, dbstore.ErrNotFound) {
+		// no block in this section has logs
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get section bloom %d, as: %w", section, err)
+	}
+	return bloomMatch(bytesToBloom(bloomByte), filter), nil
+}
+
+// loadBloomSectionIndex load the section bloom index record. Sections before the first section started after the
+// current block are not indexed, the section blooms are rebuilt if the section size changed. The section bloom
+// index is disabled instead of rebuilt in read-only mode.
+func (blockStore *BlockStore) loadBloomSectionIndex(sectionSize uint64) error {
+	if sectionSize == 0 {
+		return nil
+	}
+	recordByte, err := blockStore.store.Get([]byte(bloomSectionIndexKey))
+	if err == nil && len(recordByte) == 16 && binary.BigEndian.Uint64(recordByte) == sectionSize {
+		blockStore.bloomSectionSize = sectionSize
+		blockStore.bloomSectionsFrom = binary.BigEndian.Uint64(recordByte[8:])
+		return nil
+	}
+	if blockStore.readOnly {
+		log.Warn("Section bloom index with section size %d is not built, it is disabled in read-only mode", sectionSize)
+		return nil
+	}
+
+	log.Info("Start creating section bloom index with section size %d", sectionSize)
+	batch := blockStore.store.NewBatch()
+	iter := blockStore.store.NewIteratorWithPrefix(sectionBloomPrefix, nil)
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+	var sectionsFrom uint64
+	if blockStore.GetCurrentBlock() != nil {
+		sectionsFrom = (blockStore.GetCurrentBlockHeight()/sectionSize + 1) * sectionSize
+	}
+	batch.Put([]byte(bloomSectionIndexKey), append(encodeBlockHeight(sectionSize), encodeBlockHeight(sectionsFrom)...))
+	err = batch.Write()
+	if err != nil {
+		log.Error("Failed to create section bloom index, as: %v", err)
+		return fmt.Errorf("failed to create section bloom index, as: %v", err)
+	}
+	blockStore.bloomSectionSize = sectionSize
+	blockStore.bloomSectionsFrom = sectionsFrom
+	return nil
+}
+
+// writeBlockBloom write the bloom of the logs in block receipts.
+func (blockStore *BlockStore) writeBlockBloom(batch dbstore.Batch, blockHash types.Hash, receipts []*types.Receipt) types.Bloom {
+	bloom := indexes.CreateBloom(receipts)
+	batch.Put(append(blockBloomPrefix, common.HashToBytes(blockHash)...), bloom[:])
+	return bloom
+}
+
+// mergeSectionBlooms merge the block blooms of canonical blocks into section blooms. The bits of the blocks
+// removed from canonical chain are kept, which only lead to false positive.
+func (blockStore *BlockStore) mergeSectionBlooms(batch dbstore.Batch, blooms map[uint64]types.Bloom) {
+	if blockStore.bloomSectionSize == 0 {
+		return
+	}
+	sectionBlooms := make(map[uint64]types.Bloom)
+	for height, bloom := range blooms {
+		if height < blockStore.bloomSectionsFrom || bloom == (types.Bloom{}) {
+			continue
+		}
+		section := height / blockStore.bloomSectionSize
+		sectionBloom, ok := sectionBlooms[section]
+		if !ok {
+			bloomByte, err := blockStore.store.Get(append(sectionBloomPrefix, encodeBlockHeight(section)...))
+			if err == nil {
+				sectionBloom = bytesToBloom(bloomByte)
+			}
+		}
+		indexes.BloomMerge(&sectionBloom, bloom)
+		sectionBlooms[section] = sectionBloom
+	}
+	for section, sectionBloom := range sectionBlooms {
+		bloomByte := sectionBloom
+		batch.Put(append(sectionBloomPrefix, encodeBlockHeight(section)...), bloomByte[:])
+	}
+}
+
+// getBlockBloom get the bloom of the logs in block receipts.
+func (blockStore *BlockStore) getBlockBloom(blockHash types.Hash) (types.Bloom, error) {
+	bloomByte, err := blockStore.store.Get(append(blockBloomPrefix, common.HashToBytes(blockHash)...))
+	if err != nil {
+		return types.Bloom{}, err
+	}
+	return bytesToBloom(bloomByte), nil
+}
+
+// bytesToBloom convert byte to bloom
+func bytesToBloom(b []byte) types.Bloom {
+	var bloom types.Bloom
+	copy(bloom[:], b)
+	return bloom
+}
+
+// bloomMatch check whether the bloom may contain the logs matching the filter.
+func bloomMatch(bloom types.Bloom, filter *LogFilter) bool {
+	if len(filter.Addresses) > 0 {
+		matched := false
+		for _, addr := range filter.Addresses {
+			if indexes.BloomLookup(bloom, addr[:]) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, topics := range filter.Topics {
+		if len(topics) == 0 {
+			continue
+		}
+		matched := false
+		for _, topic := range topics {
+			if indexes.BloomLookup(bloom, topic[:]) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// logMatch check whether the log matches the filter.
+func logMatch(l *types.Log, filter *LogFilter) bool {
+	if len(filter.Addresses) > 0 {
+		matched := false
+		for _, addr := range filter.Addresses {
+			if l.Address == addr {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(filter.Topics) > len(l.Topics) {
+		return false
+	}
+	for i, topics := range filter.Topics {
+		if len(topics) == 0 {
+			continue
+		}
+		matched := false
+		for _, topic := range topics {
+			if l.Topics[i] == topic {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
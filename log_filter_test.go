@@ -0,0 +1,129 @@
+package blockstore
+
+import (
+	"errors"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/config"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/craft/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var (
+	mockContract = common.HexToAddress("0x0a")
+	mockTopic    = common.HexToHash("0x0b")
+)
+
+// mock block store with logs emitted in block 2 and 5
+func mockBlockStoreWithLogs(t *testing.T, sectionSize uint64) *BlockStore {
+	config := mockBlockStoreConfig()
+	config.BloomSectionSize = sectionSize
+	blockStore, err := NewBlockStore(config)
+	assert.Nil(t, err)
+	block := mockBlock()
+	for height := 1; height <= 6; height++ {
+		if height > 1 {
+			block = mockChildBlock(block, common.HexToHash("0x01"))
+		}
+		receipts := make([]*types.Receipt, 0)
+		if height == 2 || height == 5 {
+			receipts = append(receipts, &types.Receipt{
+				Logs: []*types.Log{
+					{Address: mockContract, Topics: []types.Hash{mockTopic}, Data: []byte{byte(height)}},
+					{Address: common.HexToAddress("0x0c")},
+				},
+			})
+		}
+		assert.Nil(t, blockStore.WriteBlockWithReceipts(block, receipts))
+	}
+	return blockStore
+}
+
+// test filter logs
+func TestBlockStore_FilterLogs(t *testing.T) {
+	assert := assert.New(t)
+	for _, sectionSize := range []uint64{0, 2} {
+		blockStore := mockBlockStoreWithLogs(t, sectionSize)
+		logs, err := blockStore.FilterLogs(&LogFilter{
+			FromHeight: 1,
+			ToHeight:   10,
+			Addresses:  []types.Address{mockContract},
+		})
+		assert.Nil(err)
+		assert.Equal(2, len(logs))
+		assert.Equal([]byte{2}, logs[0].Data)
+		assert.Equal([]byte{5}, logs[1].Data)
+
+		logs, err = blockStore.FilterLogs(&LogFilter{
+			FromHeight: 3,
+			ToHeight:   6,
+			Topics:     [][]types.Hash{{mockTopic}},
+		})
+		assert.Nil(err)
+		assert.Equal(1, len(logs))
+		assert.Equal([]byte{5}, logs[0].Data)
+
+		logs, err = blockStore.FilterLogs(&LogFilter{
+			FromHeight: 1,
+			ToHeight:   6,
+			Topics:     [][]types.Hash{{}, {mockTopic}},
+		})
+		assert.Nil(err)
+		assert.Equal(0, len(logs))
+
+		logs, err = blockStore.FilterLogs(&LogFilter{FromHeight: 1, ToHeight: 6})
+		assert.Nil(err)
+		assert.Equal(4, len(logs))
+
+		_, err = blockStore.FilterLogs(&LogFilter{FromHeight: 2, ToHeight: 1})
+		assert.NotNil(err)
+	}
+}
+
+// test section bloom index
+func TestBlockStore_SectionBloom(t *testing.T) {
+	assert := assert.New(t)
+	blockStore := mockBlockStoreWithLogs(t, 2)
+	filter := &LogFilter{Addresses: []types.Address{mockContract}}
+	for height, expected := range map[uint64]bool{2: true, 5: true, 6: false, 0: false} {
+		mayMatch, err := blockStore.sectionMayMatch(height, filter)
+		assert.Nil(err)
+		assert.Equal(expected, mayMatch)
+	}
+
+	// section index created on an existing database
+	assert.Nil(blockStore.loadBloomSectionIndex(4))
+	assert.Equal(uint64(8), blockStore.bloomSectionsFrom)
+	mayMatch, err := blockStore.sectionMayMatch(6, filter)
+	assert.Nil(err)
+	assert.True(mayMatch)
+
+	// the database error is not treated as no match
+	blockStore = mockBlockStoreWithLogs(t, 2)
+	assert.Nil(blockStore.Close())
+	_, err = blockStore.sectionMayMatch(2, filter)
+	assert.True(errors.Is(err, dbstore.ErrClosed))
+	_, err = blockStore.FilterLogs(&LogFilter{FromHeight: 2, ToHeight: 2})
+	assert.True(errors.Is(err, dbstore.ErrClosed))
+}
+
+// test filter the logs of the blocks queued in async write mode
+func TestBlockStore_FilterQueuedLogs(t *testing.T) {
+	assert := assert.New(t)
+	blockStore := mockBlockStore(t, withGroupCommit, func(blockStoreConfig *config.BlockStoreConfig) {
+		blockStoreConfig.BloomSectionSize = 2
+	})
+	block := mockBlock()
+	receipts := []*types.Receipt{{Logs: []*types.Log{{Address: mockContract, Topics: []types.Hash{mockTopic}}}}}
+	assert.Nil(blockStore.WriteBlockWithReceipts(block, receipts))
+	filter := &LogFilter{FromHeight: 1, ToHeight: 1, Addresses: []types.Address{mockContract}}
+	logs, err := blockStore.FilterLogs(filter)
+	assert.Nil(err)
+	assert.Equal(1, len(logs))
+
+	assert.Nil(blockStore.Flush())
+	logs, err = blockStore.FilterLogs(filter)
+	assert.Nil(err)
+	assert.Equal(1, len(logs))
+}
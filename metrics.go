@@ -0,0 +1,141 @@
+package blockstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/blockstore/metrics"
+	"github.com/DSiSc/craft/log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// names of the instrumented block store operations
+const (
+	opWriteBlock             = "write_block"
+	opWriteBlockWithReceipts = "write_block_with_receipts"
+	opReorg                  = "reorg"
+	opRollback               = "rollback"
+	opGetBlockByHash         = "get_block_by_hash"
+	opGetBlockByHeight       = "get_block_by_height"
+	opGetHeaderByHash        = "get_header_by_hash"
+	opGetTransactionByHash   = "get_transaction_by_hash"
+	opGetReceiptByTxHash     = "get_receipt_by_tx_hash"
+	opGetReceiptByBlockHash  = "get_receipt_by_block_hash"
+)
+
+// the path of the metrics served by the metrics http server
+const metricsPath = "/metrics"
+
+// metadataKeys are the database records which don't start with a schema prefix, they are labeled as meta.
+var metadataKeys = [][]byte{
+	[]byte(latestBlockKey), []byte(schemaVersionKey), []byte(codecKey), []byte(pruneHorizonKey),
+	[]byte(reindexCheckpointKey), []byte(migrationCheckpointKey), []byte(backupRecordKey), []byte(bloomSectionIndexKey),
+}
+
+// schemaPrefixes are the prefixes of the database records labeled by the prefix.
+var schemaPrefixes = [][]byte{
+	blockPrefix, headerPrefix, bodyPrefix, headerHeightPrefix, blockHeightPrefix, txPrefix, receiptPrefix,
+	addressTxPrefix, blockBloomPrefix, sectionBloomPrefix,
+}
+
+// storeMetrics records the metrics of the block store operations to registry, and serves them by the http
+// server if the listen address is configured. A nil storeMetrics is the disabled metrics which records nothing.
+type storeMetrics struct {
+	registry *metrics.Registry
+	server   *http.Server
+	address  string // the address the http server listens on
+}
+
+// newStoreMetrics create the metrics with an empty registry.
+func newStoreMetrics() *storeMetrics {
+	return &storeMetrics{
+		registry: metrics.NewRegistry(),
+	}
+}
+
+// observe record the count, the errors and the latency of a block store operation started at start, err
+// points to the result of the operation, not found is not an error.
+func (m *storeMetrics) observe(op string, start time.Time, err *error) {
+	if m == nil {
+		return
+	}
+	m.registry.Counter("blockstore_operations_total", "Number of block store operations.", "op", op).Inc()
+	if *err != nil && !errors.Is(*err, dbstore.ErrNotFound) {
+		m.registry.Counter("blockstore_operation_errors_total", "Number of failed block store operations.", "op", op).Inc()
+	}
+	m.registry.Histogram("blockstore_operation_duration_seconds", "Latency of block store operations in seconds.", metrics.LatencyBuckets, "op", op).Observe(time.Since(start).Seconds())
+}
+
+// serve start the http server serving the metrics at /metrics on the listen address.
+func (m *storeMetrics) serve(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on metrics address %s, as: %v", address, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, m.registry.Handler())
+	m.server = &http.Server{Handler: mux}
+	m.address = listener.Addr().String()
+	go func() {
+		err := m.server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			log.Error("Metrics server on %s stopped, as: %v", address, err)
+		}
+	}()
+	log.Info("Serving block store metrics at http://%s%s", m.address, metricsPath)
+	return nil
+}
+
+// close stop the http server if it is started.
+func (m *storeMetrics) close() error {
+	if m == nil || m.server == nil {
+		return nil
+	}
+	return m.server.Close()
+}
+
+// registerMetrics register the gauges of the block store state.
+func (blockStore *BlockStore) registerMetrics() {
+	registry := blockStore.metrics.registry
+	registry.GaugeFunc("blockstore_height", "Height of the current block.", func() float64 {
+		return float64(blockStore.GetCurrentBlockHeight())
+	})
+	registry.GaugeFunc("blockstore_prune_horizon", "Height below which the canonical blocks are pruned.", func() float64 {
+		return float64(blockStore.pruneHorizon())
+	})
+	registry.GaugeFunc("blockstore_frozen_blocks", "Number of the blocks moved to freezer.", func() float64 {
+		return float64(blockStore.freezer.Frozen())
+	})
+	if blockStore.pipeline != nil {
+		registry.GaugeFunc("blockstore_write_queue_length", "Number of the blocks queued in write pipeline.", func() float64 {
+			return float64(len(blockStore.pipeline.queue))
+		})
+	}
+}
+
+// Metrics get the registry of the block store metrics, return nil if metrics is disabled.
+func (blockStore *BlockStore) Metrics() *metrics.Registry {
+	if blockStore.metrics == nil {
+		return nil
+	}
+	return blockStore.metrics.registry
+}
+
+// keyPrefix get the key prefix label of the database record, meta for the metadata records and other for
+// the unknown records.
+func keyPrefix(key []byte) string {
+	for _, metadataKey := range metadataKeys {
+		if bytes.Equal(key, metadataKey) {
+			return "meta"
+		}
+	}
+	for _, prefix := range schemaPrefixes {
+		if bytes.HasPrefix(key, prefix) {
+			return string(prefix)
+		}
+	}
+	return "other"
+}
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync/atomic"
+)
+
+// the default buckets of latency histograms in seconds, from 10us to 10s.
+var LatencyBuckets = []float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10}
+
+// the default buckets of size histograms in bytes, from 256B to 16MB.
+var SizeBuckets = ExponentialBuckets(256, 4, 9)
+
+// ExponentialBuckets create count buckets, the first one is start and each of the others is factor times
+// the previous one.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// Counter is a monotonically increasing value. A nil Counter is a disabled counter which counts nothing.
+type Counter struct {
+	value uint64
+}
+
+// Inc increase the counter by 1.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add increase the counter by n.
+func (c *Counter) Add(n uint64) {
+	if c == nil {
+		return
+	}
+	atomic.AddUint64(&c.value, n)
+}
+
+// Value get the current value of the counter.
+func (c *Counter) Value() uint64 {
+	if c == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&c.value)
+}
+
+// Gauge is a value that can go up and down. A nil Gauge is a disabled gauge which holds nothing.
+type Gauge struct {
+	bits uint64
+}
+
+// Set set the value of the gauge.
+func (g *Gauge) Set(value float64) {
+	if g == nil {
+		return
+	}
+	atomic.StoreUint64(&g.bits, math.Float64bits(value))
+}
+
+// Value get the current value of the gauge.
+func (g *Gauge) Value() float64 {
+	if g == nil {
+		return 0
+	}
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+// Histogram counts the observed values in buckets, each bucket counts the values not greater than its upper
+// bound. A nil Histogram is a disabled histogram which observes nothing.
+type Histogram struct {
+	count   uint64
+	sumBits uint64
+	buckets []float64
+	counts  []uint64
+}
+
+// newHistogram create a histogram with the sorted bucket upper bounds.
+func newHistogram(buckets []float64) *Histogram {
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+	return &Histogram{
+		buckets: sorted,
+		counts:  make([]uint64, len(sorted)),
+	}
+}
+
+// Observe add a value to the histogram.
+func (h *Histogram) Observe(value float64) {
+	if h == nil {
+		return
+	}
+	i := sort.SearchFloat64s(h.buckets, value)
+	if i < len(h.counts) {
+		atomic.AddUint64(&h.counts[i], 1)
+	}
+	for {
+		old := atomic.LoadUint64(&h.sumBits)
+		sum := math.Float64bits(math.Float64frombits(old) + value)
+		if atomic.CompareAndSwapUint64(&h.sumBits, old, sum) {
+			break
+		}
+	}
+	atomic.AddUint64(&h.count, 1)
+}
+
+// HistogramSnapshot is the state of a histogram at the time it is taken.
+type HistogramSnapshot struct {
+	Count uint64
+	Sum   float64
+	// upper bounds of the buckets and the cumulative count of each bucket
+	Buckets []float64
+	Counts  []uint64
+}
+
+// Snapshot get the current state of the histogram.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	if h == nil {
+		return HistogramSnapshot{}
+	}
+	snapshot := HistogramSnapshot{
+		Count:   atomic.LoadUint64(&h.count),
+		Sum:     math.Float64frombits(atomic.LoadUint64(&h.sumBits)),
+		Buckets: h.buckets,
+		Counts:  make([]uint64, len(h.counts)),
+	}
+	var cumulative uint64
+	for i := range h.counts {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+		snapshot.Counts[i] = cumulative
+	}
+	return snapshot
+}
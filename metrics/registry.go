@@ -0,0 +1,250 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/DSiSc/craft/log"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metric types in the text exposition format
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// escapers of the help text and label values
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// family is the metrics with the same name, each of them is identified by its labels.
+type family struct {
+	name    string
+	help    string
+	kind    string
+	buckets []float64
+	series  map[string]interface{} // formatted labels -> *Counter, *Gauge, func() float64 or *Histogram
+}
+
+// Registry holds the metrics by name and labels, and exposes them in the Prometheus text exposition format.
+// A nil Registry is a disabled registry, the metrics got from it are nil and count nothing.
+type Registry struct {
+	families map[string]*family
+	lock     sync.RWMutex
+}
+
+// NewRegistry create an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		families: make(map[string]*family),
+	}
+}
+
+// Counter get or create the counter with the name and labels, labels are the label name and value pairs.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	metric := r.getOrCreate(name, help, typeCounter, nil, labels, func(*family) interface{} { return new(Counter) })
+	counter, _ := metric.(*Counter)
+	return counter
+}
+
+// Gauge get or create the gauge with the name and labels, labels are the label name and value pairs.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	metric := r.getOrCreate(name, help, typeGauge, nil, labels, func(*family) interface{} { return new(Gauge) })
+	gauge, _ := metric.(*Gauge)
+	return gauge
+}
+
+// GaugeFunc register the gauge with the name and labels whose value is got from f when the metrics are
+// collected, it replaces the gauge registered before with the same name and labels.
+func (r *Registry) GaugeFunc(name, help string, f func() float64, labels ...string) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	metricFamily, err := r.getFamily(name, help, typeGauge, nil)
+	if err != nil {
+		log.Error("Failed to register gauge func, as: %v", err)
+		return
+	}
+	metricFamily.series[formatLabels(labels)] = f
+}
+
+// Histogram get or create the histogram with the name and labels, labels are the label name and value pairs.
+// The histograms with the same name share the buckets of the first one.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	metric := r.getOrCreate(name, help, typeHistogram, buckets, labels, func(metricFamily *family) interface{} {
+		return newHistogram(metricFamily.buckets)
+	})
+	histogram, _ := metric.(*Histogram)
+	return histogram
+}
+
+// getOrCreate get the metric with the name and labels, or create it with create if it doesn't exist.
+// Return nil if the registry is nil or the name is registered as another type.
+func (r *Registry) getOrCreate(name, help, kind string, buckets []float64, labels []string, create func(metricFamily *family) interface{}) interface{} {
+	if r == nil {
+		return nil
+	}
+	key := formatLabels(labels)
+	r.lock.RLock()
+	if metricFamily, ok := r.families[name]; ok && metricFamily.kind == kind {
+		if metric, ok := metricFamily.series[key]; ok {
+			r.lock.RUnlock()
+			return metric
+		}
+	}
+	r.lock.RUnlock()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	metricFamily, err := r.getFamily(name, help, kind, buckets)
+	if err != nil {
+		log.Error("Failed to register %s, as: %v", kind, err)
+		return nil
+	}
+	if metric, ok := metricFamily.series[key]; ok {
+		return metric
+	}
+	metric := create(metricFamily)
+	metricFamily.series[key] = metric
+	return metric
+}
+
+// getFamily get or create the family with the name, return error if it is registered as another type.
+// Caller must hold the write lock.
+func (r *Registry) getFamily(name, help, kind string, buckets []float64) (*family, error) {
+	if metricFamily, ok := r.families[name]; ok {
+		if metricFamily.kind != kind {
+			return nil, fmt.Errorf("metric %s is registered as %s", name, metricFamily.kind)
+		}
+		return metricFamily, nil
+	}
+	metricFamily := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		buckets: buckets,
+		series:  make(map[string]interface{}),
+	}
+	r.families[name] = metricFamily
+	return metricFamily, nil
+}
+
+// WriteText write all metrics to w in the Prometheus text exposition format, sorted by name and labels.
+func (r *Registry) WriteText(w io.Writer) error {
+	if r == nil {
+		return nil
+	}
+	r.lock.RLock()
+	families := make([]*family, 0, len(r.families))
+	for _, metricFamily := range r.families {
+		families = append(families, metricFamily)
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+	type entry struct {
+		labels string
+		metric interface{}
+	}
+	series := make([][]entry, len(families))
+	for i, metricFamily := range families {
+		for labels, metric := range metricFamily.series {
+			series[i] = append(series[i], entry{labels: labels, metric: metric})
+		}
+		sort.Slice(series[i], func(a, b int) bool { return series[i][a].labels < series[i][b].labels })
+	}
+	r.lock.RUnlock()
+
+	// the gauge funcs are called without lock, so they can use the registry
+	writer := bufio.NewWriter(w)
+	for i, metricFamily := range families {
+		fmt.Fprintf(writer, "# HELP %s %s\n", metricFamily.name, escapeHelp(metricFamily.help))
+		fmt.Fprintf(writer, "# TYPE %s %s\n", metricFamily.name, metricFamily.kind)
+		for _, e := range series[i] {
+			switch metric := e.metric.(type) {
+			case *Counter:
+				writeSample(writer, metricFamily.name, e.labels, float64(metric.Value()))
+			case *Gauge:
+				writeSample(writer, metricFamily.name, e.labels, metric.Value())
+			case func() float64:
+				writeSample(writer, metricFamily.name, e.labels, metric())
+			case *Histogram:
+				snapshot := metric.Snapshot()
+				for j, bound := range snapshot.Buckets {
+					writeSample(writer, metricFamily.name+"_bucket", joinLabels(e.labels, "le", formatValue(bound)), float64(snapshot.Counts[j]))
+				}
+				writeSample(writer, metricFamily.name+"_bucket", joinLabels(e.labels, "le", "+Inf"), float64(snapshot.Count))
+				writeSample(writer, metricFamily.name+"_sum", e.labels, snapshot.Sum)
+				writeSample(writer, metricFamily.name+"_count", e.labels, float64(snapshot.Count))
+			}
+		}
+	}
+	return writer.Flush()
+}
+
+// Handler get the http handler serving the metrics in the Prometheus text exposition format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		err := r.WriteText(w)
+		if err != nil {
+			log.Warn("Failed to write metrics, as: %v", err)
+		}
+	})
+}
+
+// writeSample write a sample line.
+func writeSample(w io.Writer, name, labels string, value float64) {
+	if labels == "" {
+		fmt.Fprintf(w, "%s %s\n", name, formatValue(value))
+		return
+	}
+	fmt.Fprintf(w, "%s{%s} %s\n", name, labels, formatValue(value))
+}
+
+// formatLabels format the label name and value pairs as name="value" separated by comma, an odd trailing
+// label name is ignored.
+func formatLabels(labels []string) string {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+`="`+labelEscaper.Replace(labels[i+1])+`"`)
+	}
+	return strings.Join(pairs, ",")
+}
+
+// joinLabels append a label to the formatted labels.
+func joinLabels(labels, name, value string) string {
+	label := formatLabels([]string{name, value})
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+// formatValue format the value as the text exposition format.
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+// escapeHelp escape the backslashes and line feeds in help text.
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
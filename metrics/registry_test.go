@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// test counters, gauges and histograms
+func TestMetrics(t *testing.T) {
+	assert := assert.New(t)
+	counter := new(Counter)
+	counter.Inc()
+	counter.Add(2)
+	assert.Equal(uint64(3), counter.Value())
+
+	gauge := new(Gauge)
+	gauge.Set(-1.5)
+	assert.Equal(-1.5, gauge.Value())
+
+	histogram := newHistogram([]float64{10, 1})
+	for _, value := range []float64{0.5, 1, 5, 20} {
+		histogram.Observe(value)
+	}
+	snapshot := histogram.Snapshot()
+	assert.Equal(uint64(4), snapshot.Count)
+	assert.Equal(26.5, snapshot.Sum)
+	assert.Equal([]float64{1, 10}, snapshot.Buckets)
+	assert.Equal([]uint64{2, 3}, snapshot.Counts)
+
+	// the nil metrics are disabled
+	var nilCounter *Counter
+	nilCounter.Inc()
+	assert.Equal(uint64(0), nilCounter.Value())
+	var nilHistogram *Histogram
+	nilHistogram.Observe(1)
+	assert.Equal(uint64(0), nilHistogram.Snapshot().Count)
+	assert.Equal([]float64{1, 2, 4}, ExponentialBuckets(1, 2, 3))
+}
+
+// test get metrics from registry
+func TestRegistry(t *testing.T) {
+	assert := assert.New(t)
+	registry := NewRegistry()
+	counter := registry.Counter("ops_total", "ops", "op", "get")
+	assert.True(counter == registry.Counter("ops_total", "ops", "op", "get"))
+	assert.False(counter == registry.Counter("ops_total", "ops", "op", "put"))
+	// the name registered as another type
+	assert.Nil(registry.Gauge("ops_total", "ops"))
+	registry.GaugeFunc("ops_total", "ops", func() float64 { return 1 })
+	assert.Nil(registry.Histogram("ops_total", "ops", LatencyBuckets))
+
+	var nilRegistry *Registry
+	assert.Nil(nilRegistry.Counter("ops_total", "ops"))
+	nilRegistry.Counter("ops_total", "ops").Inc()
+	nilRegistry.GaugeFunc("height", "height", func() float64 { return 1 })
+	assert.Nil(nilRegistry.WriteText(ioutil.Discard))
+}
+
+// test write metrics in text exposition format
+func TestRegistry_WriteText(t *testing.T) {
+	assert := assert.New(t)
+	registry := NewRegistry()
+	registry.Counter("ops_total", "Number of ops.", "op", "put").Add(2)
+	registry.Counter("ops_total", "Number of ops.", "op", "get").Inc()
+	registry.Gauge("queue", "Queue\nlength.").Set(3)
+	registry.GaugeFunc("height", "Height.", func() float64 { return 10 }, "path", `a"b\c`)
+	registry.Histogram("latency_seconds", "Latency.", []float64{0.1, 1}, "op", "get").Observe(0.5)
+
+	var buf bytes.Buffer
+	assert.Nil(registry.WriteText(&buf))
+	expected := `# HELP height Height.
+# TYPE height gauge
+height{path="a\"b\\c"} 10
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{op="get",le="0.1"} 0
+latency_seconds_bucket{op="get",le="1"} 1
+latency_seconds_bucket{op="get",le="+Inf"} 1
+latency_seconds_sum{op="get"} 0.5
+latency_seconds_count{op="get"} 1
+# HELP ops_total Number of ops.
+# TYPE ops_total counter
+ops_total{op="get"} 1
+ops_total{op="put"} 2
+# HELP queue Queue\nlength.
+# TYPE queue gauge
+queue 3
+`
+	assert.Equal(expected, buf.String())
+
+	recorder := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(200, recorder.Code)
+	assert.True(strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain"))
+	assert.Equal(expected, recorder.Body.String())
+}
@@ -0,0 +1,89 @@
+package blockstore
+
+import (
+	"bytes"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/config"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// test the block store operations and database operations are metered
+func TestBlockStore_Metrics(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	assert.Nil(blockStore.Metrics())
+	assert.Nil(blockStore.WriteBlock(mockBlock()))
+	blockStore.Close()
+
+	blockStore = mockBlockStore(t, func(blockStoreConfig *config.BlockStoreConfig) {
+		blockStoreConfig.Metrics = true
+	})
+	defer blockStore.Close()
+	block, tx := mockBlockWithTx()
+	assert.Nil(blockStore.WriteBlockWithReceipts(block, mockReceipts()))
+	_, err = blockStore.GetBlockByHash(block.HeaderHash)
+	assert.Nil(err)
+	_, _, _, _, err = blockStore.GetTransactionByHash(common.TxHash(&tx))
+	assert.Nil(err)
+	_, err = blockStore.GetBlockByHeight(10)
+	assert.NotNil(err)
+
+	registry := blockStore.Metrics()
+	assert.NotNil(registry)
+	assert.Equal(uint64(1), registry.Counter("blockstore_operations_total", "", "op", opWriteBlockWithReceipts).Value())
+	assert.Equal(uint64(1), registry.Counter("blockstore_operations_total", "", "op", opGetTransactionByHash).Value())
+	assert.Equal(uint64(1), registry.Counter("blockstore_operations_total", "", "op", opGetBlockByHeight).Value())
+	assert.Equal(uint64(0), registry.Counter("blockstore_operation_errors_total", "", "op", opGetBlockByHeight).Value())
+	assert.True(registry.Counter("dbstore_operations_total", "", "op", "batch_put", "prefix", "H").Value() > 0)
+	assert.True(registry.Counter("dbstore_operations_total", "", "op", "get", "prefix", "t").Value() > 0)
+	latency := registry.Histogram("blockstore_operation_duration_seconds", "", nil, "op", opGetTransactionByHash).Snapshot()
+	assert.Equal(uint64(1), latency.Count)
+
+	var buf bytes.Buffer
+	assert.Nil(registry.WriteText(&buf))
+	assert.True(strings.Contains(buf.String(), "blockstore_height 1\n"))
+	assert.True(strings.Contains(buf.String(), "dbstore_batch_size_bytes_count "))
+}
+
+// test serve the metrics by http server
+func TestBlockStore_MetricsServer(t *testing.T) {
+	assert := assert.New(t)
+	_, err := NewBlockStore(&config.BlockStoreConfig{
+		PluginName:     PLUGIN_MEMDB,
+		MetricsAddress: "invalid address",
+	})
+	assert.NotNil(err)
+
+	blockStore, err := NewBlockStore(&config.BlockStoreConfig{
+		PluginName:     PLUGIN_MEMDB,
+		MetricsAddress: "127.0.0.1:0",
+	})
+	assert.Nil(err)
+	assert.Nil(blockStore.WriteBlock(mockBlock()))
+	url := "http://" + blockStore.metrics.address + metricsPath
+	resp, err := http.Get(url)
+	assert.Nil(err)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Nil(err)
+	assert.True(strings.Contains(string(body), `blockstore_operations_total{op="write_block"} 1`))
+
+	assert.Nil(blockStore.Close())
+	_, err = http.Get(url)
+	assert.NotNil(err)
+}
+
+// test the key prefix labels of database records
+func TestKeyPrefix(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("meta", keyPrefix([]byte(latestBlockKey)))
+	assert.Equal("meta", keyPrefix([]byte(bloomSectionIndexKey)))
+	assert.Equal("B", keyPrefix(append(bodyPrefix, make([]byte, 32)...)))
+	assert.Equal("a", keyPrefix(append(addressTxPrefix, 1)))
+	assert.Equal("other", keyPrefix([]byte("unknown")))
+}
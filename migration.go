@@ -0,0 +1,327 @@
+package blockstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/DSiSc/blockstore/codec"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/blockstore/dbstore/compressedstore"
+	"github.com/DSiSc/blockstore/indexes"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+	"sort"
+)
+
+const (
+	// migrationCheckpointKey tracks the progress of an unfinished entity re-encoding.
+	migrationCheckpointKey = "MigrationCheckpoint"
+	// the number of records re-encoded in one batch
+	migrationBatchRecords = 1000
+)
+
+// MigrationStep upgrade the database schema from Version-1 to Version.
+type MigrationStep struct {
+	Version     uint64
+	Description string
+	Migrate     func(store dbstore.DBStore, entityCodec codec.Codec, progress MigrationProgress) error
+}
+
+// MigrationProgress is called after each committed batch with the prefix being migrated and the
+// number of records migrated under this prefix so far.
+type MigrationProgress func(prefix []byte, count uint64)
+
+// migrationCheckpoint record the last re-encoded key, used to resume an interrupted migration.
+type migrationCheckpoint struct {
+	TargetCodec string
+	Prefix      []byte
+	LastKey     []byte
+}
+
+// registered migration steps, ordered by version.
+var migrationSteps = []MigrationStep{
+	{
+		Version:     2,
+		Description: "split the whole block records into header and body records",
+		Migrate:     splitLegacyBlocks,
+	},
+}
+
+// encoded entities with their prefix, height mappings and latest block record are raw hash and
+// don't depend on codec.
+var encodedEntities = []struct {
+	prefix    []byte
+	newEntity func() interface{}
+}{
+	{blockPrefix, func() interface{} { return new(types.Block) }},
+	{headerPrefix, func() interface{} { return new(types.Header) }},
+	{bodyPrefix, func() interface{} { return new(BlockBody) }},
+	{txPrefix, func() interface{} { return new(indexes.EntityLookupIndex) }},
+	{receiptPrefix, func() interface{} { return new([]*types.Receipt) }},
+}
+
+// RegisterMigrationStep register a migration step to upgrade the database schema.
+func RegisterMigrationStep(step MigrationStep) {
+	migrationSteps = append(migrationSteps, step)
+	sort.Slice(migrationSteps, func(i, j int) bool {
+		return migrationSteps[i].Version < migrationSteps[j].Version
+	})
+}
+
+// MigrateDatabase upgrade the database to the latest schema version by the registered migration steps, then
+// re-encode all entities with the target codec. An interrupted migration will be resumed from the checkpoint.
+// The store of an encrypted database must be wrapped with its encryption keys.
+func MigrateDatabase(rawStore dbstore.DBStore, targetCodecName string, progress MigrationProgress) error {
+	// the raw values are escaped first, so the compressed values are decompressed before re-encoding and the
+	// migrated values are written raw
+	count, err := compressedstore.Format(rawStore)
+	if err != nil {
+		return fmt.Errorf("failed to format database for compression, as: %v", err)
+	}
+	if count > 0 {
+		log.Info("Escape %d raw values looking like compressed values", count)
+	}
+	store, err := compressedstore.NewCompressedStore(rawStore, compressedstore.NONE, 0)
+	if err != nil {
+		return err
+	}
+	sourceCodec, err := loadRecordedCodec(store)
+	if err != nil {
+		return err
+	}
+	targetCodec, err := codec.NewCodec(targetCodecName)
+	if err != nil {
+		return err
+	}
+
+	version, err := loadSchemaVersion(store)
+	if err != nil {
+		return err
+	}
+	for _, step := range migrationSteps {
+		if step.Version <= version {
+			continue
+		}
+		log.Info("Start migrating database schema to version %d: %s", step.Version, step.Description)
+		err = step.Migrate(store, sourceCodec, progress)
+		if err != nil {
+			log.Error("Failed to migrate database schema to version %d, as: %v", step.Version, err)
+			return fmt.Errorf("failed to migrate database schema to version %d, as: %v", step.Version, err)
+		}
+		err = store.Put([]byte(schemaVersionKey), encodeSchemaVersion(step.Version))
+		if err != nil {
+			return fmt.Errorf("failed to record database schema version %d, as: %v", step.Version, err)
+		}
+		version = step.Version
+	}
+	return reencodeEntities(store, sourceCodec, targetCodec, progress)
+}
+
+// splitLegacyBlocks split the whole block records into header and body records. The migrated block records
+// are deleted in the same batch, so an interrupted migration can be resumed by running it again.
+func splitLegacyBlocks(store dbstore.DBStore, entityCodec codec.Codec, progress MigrationProgress) error {
+	blockStore := &BlockStore{
+		store: store,
+		codec: entityCodec,
+	}
+	iter := store.NewIteratorWithPrefix(blockPrefix, nil)
+	defer iter.Release()
+
+	var count uint64
+	batch := store.NewBatch()
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != len(blockPrefix)+common.HashLength {
+			// not a block record
+			continue
+		}
+		var block types.Block
+		err := entityCodec.Decode(iter.Value(), &block)
+		if err != nil {
+			return fmt.Errorf("failed to decode block record %x, as: %v", key, err)
+		}
+		err = blockStore.writeHeaderAndBody(batch, common.BytesToHash(key[len(blockPrefix):]), &block)
+		if err != nil {
+			return err
+		}
+		batch.Delete(append([]byte{}, key...))
+		count++
+
+		if count%migrationBatchRecords == 0 {
+			err = batch.Write()
+			if err != nil {
+				return fmt.Errorf("failed to commit split block records, as: %v", err)
+			}
+			batch.Reset()
+			if progress != nil {
+				progress(blockPrefix, count)
+			}
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return fmt.Errorf("failed to iterate block records, as: %v", err)
+	}
+	err := batch.Write()
+	if err != nil {
+		return fmt.Errorf("failed to commit split block records, as: %v", err)
+	}
+	if progress != nil && count%migrationBatchRecords != 0 {
+		progress(blockPrefix, count)
+	}
+	return nil
+}
+
+// reencodeEntities re-encode all entities from source codec to target codec.
+func reencodeEntities(store dbstore.DBStore, sourceCodec, targetCodec codec.Codec, progress MigrationProgress) error {
+	checkpoint, err := loadMigrationCheckpoint(store)
+	if err != nil {
+		return err
+	}
+	if checkpoint != nil && checkpoint.TargetCodec != targetCodec.Name() {
+		return fmt.Errorf("an unfinished migration to codec %s exists, can not migrate to %s", checkpoint.TargetCodec, targetCodec.Name())
+	}
+	if checkpoint == nil && sourceCodec.Name() == targetCodec.Name() {
+		log.Info("Database has already been encoded by %s", targetCodec.Name())
+		return nil
+	}
+
+	resumed := checkpoint == nil
+	for _, entity := range encodedEntities {
+		var start []byte
+		if !resumed {
+			if string(checkpoint.Prefix) != string(entity.prefix) {
+				continue
+			}
+			// start from the key next to the last re-encoded one
+			start = append(checkpoint.LastKey[len(entity.prefix):], 0)
+			resumed = true
+		}
+		err = reencodeEntitiesWithPrefix(store, entity.prefix, start, entity.newEntity, sourceCodec, targetCodec, progress)
+		if err != nil {
+			return err
+		}
+	}
+
+	batch := store.NewBatch()
+	batch.Put([]byte(codecKey), []byte(targetCodec.Name()))
+	batch.Delete([]byte(migrationCheckpointKey))
+	err = batch.Write()
+	if err != nil {
+		return fmt.Errorf("failed to record codec %s, as: %v", targetCodec.Name(), err)
+	}
+	log.Info("Finish re-encoding database from %s to %s", sourceCodec.Name(), targetCodec.Name())
+	return nil
+}
+
+// reencodeEntitiesWithPrefix re-encode the entities with specified prefix, the checkpoint is committed with each batch.
+func reencodeEntitiesWithPrefix(store dbstore.DBStore, prefix []byte, start []byte, newEntity func() interface{}, sourceCodec, targetCodec codec.Codec, progress MigrationProgress) error {
+	iter := store.NewIteratorWithPrefix(prefix, start)
+	defer iter.Release()
+
+	var count uint64
+	var lastKey []byte
+	batch := store.NewBatch()
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != len(prefix)+common.HashLength {
+			// not an entity record
+			continue
+		}
+		entity := newEntity()
+		err := sourceCodec.Decode(iter.Value(), entity)
+		if err != nil {
+			return fmt.Errorf("failed to decode record %x with codec %s, as: %v", key, sourceCodec.Name(), err)
+		}
+		entityByte, err := targetCodec.Encode(entity)
+		if err != nil {
+			return fmt.Errorf("failed to encode record %x with codec %s, as: %v", key, targetCodec.Name(), err)
+		}
+		lastKey = append([]byte{}, key...)
+		batch.Put(lastKey, entityByte)
+		count++
+
+		if count%migrationBatchRecords == 0 {
+			err = commitMigrationBatch(batch, targetCodec, prefix, lastKey)
+			if err != nil {
+				return err
+			}
+			if progress != nil {
+				progress(prefix, count)
+			}
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return fmt.Errorf("failed to iterate records with prefix %s, as: %v", prefix, err)
+	}
+	if count%migrationBatchRecords != 0 {
+		err := commitMigrationBatch(batch, targetCodec, prefix, lastKey)
+		if err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(prefix, count)
+		}
+	}
+	return nil
+}
+
+// commitMigrationBatch commit the re-encoded records along with the checkpoint.
+func commitMigrationBatch(batch dbstore.Batch, targetCodec codec.Codec, prefix []byte, lastKey []byte) error {
+	checkpointByte, err := json.Marshal(&migrationCheckpoint{
+		TargetCodec: targetCodec.Name(),
+		Prefix:      prefix,
+		LastKey:     lastKey,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode migration checkpoint, as: %v", err)
+	}
+	batch.Put([]byte(migrationCheckpointKey), checkpointByte)
+	err = batch.Write()
+	if err != nil {
+		return fmt.Errorf("failed to commit re-encoded records, as: %v", err)
+	}
+	batch.Reset()
+	return nil
+}
+
+// loadMigrationCheckpoint load the checkpoint of an unfinished migration, return nil if there is none.
+func loadMigrationCheckpoint(store dbstore.DBStore) (*migrationCheckpoint, error) {
+	checkpointByte, err := store.Get([]byte(migrationCheckpointKey))
+	if errors.Is(err, dbstore.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var checkpoint migrationCheckpoint
+	err = json.Unmarshal(checkpointByte, &checkpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode migration checkpoint, as: %v", err)
+	}
+	return &checkpoint, nil
+}
+
+// loadRecordedCodec load the codec recorded in database, the database without codec record is json encoded.
+func loadRecordedCodec(store dbstore.DBStore) (codec.Codec, error) {
+	codecByte, err := store.Get([]byte(codecKey))
+	if errors.Is(err, dbstore.ErrNotFound) {
+		return codec.NewCodec(codec.JSON)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return codec.NewCodec(string(codecByte))
+}
+
+// loadSchemaVersion load the schema version recorded in database, the database without version record is version 1.
+func loadSchemaVersion(store dbstore.DBStore) (uint64, error) {
+	versionByte, err := store.Get([]byte(schemaVersionKey))
+	if errors.Is(err, dbstore.ErrNotFound) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return decodeSchemaVersion(versionByte)
+}
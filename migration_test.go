@@ -0,0 +1,144 @@
+package blockstore
+
+import (
+	"github.com/DSiSc/blockstore/codec"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/config"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/blockstore/dbstore/leveldbstore"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+// mock block store on leveldb with specified codec
+func mockLevelDBBlockStore(store *leveldbstore.LevelDBStore, codecName string) *BlockStore {
+	conf := &config.BlockStoreConfig{
+		Codec: codecName,
+	}
+	entityCodec, _ := loadCodec(store, conf)
+	return &BlockStore{
+		store: store,
+		codec: entityCodec,
+	}
+}
+
+// test migrate json database to rlp
+func TestMigrateDatabase(t *testing.T) {
+	assert := assert.New(t)
+	dataPath := "./migrationdata"
+	defer os.RemoveAll(dataPath)
+	store, err := leveldbstore.NewLevelDBStore(dataPath)
+	assert.Nil(err)
+	defer store.Close()
+
+	blockStore := mockLevelDBBlockStore(store, codec.JSON)
+	block, tx := mockBlockWithTx()
+	assert.Nil(blockStore.WriteBlockWithReceipts(block, mockReceipts()))
+
+	var migrated uint64
+	err = MigrateDatabase(store, codec.RLP, func(prefix []byte, count uint64) {
+		migrated += count
+	})
+	assert.Nil(err)
+	assert.Equal(uint64(4), migrated)
+	exist, _ := store.Has([]byte(migrationCheckpointKey))
+	assert.False(exist)
+
+	blockStore = mockLevelDBBlockStore(store, codec.JSON)
+	assert.Equal(codec.RLP, blockStore.codec.Name())
+	blockSaved, err := blockStore.GetBlockByHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(block.HeaderHash, blockSaved.HeaderHash)
+	_, _, _, _, err = blockStore.GetTransactionByHash(common.TxHash(&tx))
+	assert.Nil(err)
+	receipts, err := blockStore.GetReceiptByBlockHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.NotNil(receipts)
+}
+
+// test migration with unfinished checkpoint
+func TestMigrateDatabase_Checkpoint(t *testing.T) {
+	assert := assert.New(t)
+	dataPath := "./migrationdata"
+	defer os.RemoveAll(dataPath)
+	store, err := leveldbstore.NewLevelDBStore(dataPath)
+	assert.Nil(err)
+	defer store.Close()
+
+	blockStore := mockLevelDBBlockStore(store, codec.JSON)
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+	batch := store.NewBatch()
+	assert.Nil(commitMigrationBatch(batch, blockStore.codec, blockPrefix, append(blockPrefix, block.HeaderHash[:]...)))
+
+	_, err = loadCodec(store, mockBlockStoreConfig())
+	assert.NotNil(err)
+	assert.NotNil(MigrateDatabase(store, codec.RLP, nil))
+	assert.Nil(MigrateDatabase(store, codec.JSON, nil))
+	_, err = loadCodec(store, mockBlockStoreConfig())
+	assert.Nil(err)
+}
+
+// test registered migration step
+func TestRegisterMigrationStep(t *testing.T) {
+	assert := assert.New(t)
+	dataPath := "./migrationdata"
+	defer os.RemoveAll(dataPath)
+	store, err := leveldbstore.NewLevelDBStore(dataPath)
+	assert.Nil(err)
+	defer store.Close()
+
+	registeredSteps := migrationSteps
+	defer func() { migrationSteps = registeredSteps }()
+	var migratedVersion uint64
+	RegisterMigrationStep(MigrationStep{
+		Version:     SCHEMA_VERSION + 1,
+		Description: "mock step",
+		Migrate: func(store dbstore.DBStore, entityCodec codec.Codec, progress MigrationProgress) error {
+			migratedVersion = SCHEMA_VERSION + 1
+			return nil
+		},
+	})
+	assert.Nil(MigrateDatabase(store, codec.JSON, nil))
+	assert.Equal(uint64(SCHEMA_VERSION+1), migratedVersion)
+	version, err := loadSchemaVersion(store)
+	assert.Nil(err)
+	assert.Equal(uint64(SCHEMA_VERSION+1), version)
+}
+
+// test split legacy block records
+func TestMigrateDatabase_SplitLegacyBlocks(t *testing.T) {
+	assert := assert.New(t)
+	dataPath := "./migrationdata"
+	defer os.RemoveAll(dataPath)
+	store, err := leveldbstore.NewLevelDBStore(dataPath)
+	assert.Nil(err)
+	defer store.Close()
+
+	// database written before schema version 2
+	block, _ := mockBlockWithTx()
+	entityCodec, _ := codec.NewCodec(codec.JSON)
+	blockByte, _ := entityCodec.Encode(block)
+	store.Put(append(blockPrefix, block.HeaderHash[:]...), blockByte)
+	store.Put(append(blockHeightPrefix, encodeBlockHeight(block.Header.Height)...), block.HeaderHash[:])
+	store.Put([]byte(latestBlockKey), block.HeaderHash[:])
+	blockStore := mockLevelDBBlockStore(store, codec.JSON)
+	version, _ := loadSchemaVersion(store)
+	assert.Equal(uint64(1), version)
+	blockSaved, err := blockStore.GetBlockByHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(block.HeaderHash, blockSaved.HeaderHash)
+
+	assert.Nil(MigrateDatabase(store, codec.JSON, nil))
+	version, _ = loadSchemaVersion(store)
+	assert.Equal(uint64(SCHEMA_VERSION), version)
+	exist, _ := store.Has(append(blockPrefix, block.HeaderHash[:]...))
+	assert.False(exist)
+	header, err := blockStore.GetHeaderByHeight(block.Header.Height)
+	assert.Nil(err)
+	assert.Equal(block.Header, header)
+	body, err := blockStore.GetBodyByHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(1, len(body.Transactions))
+}
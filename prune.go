@@ -0,0 +1,173 @@
+package blockstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+	"sync/atomic"
+)
+
+const (
+	// pruneHorizonKey tracks the lowest height of the canonical blocks whose bodies and receipts are kept.
+	pruneHorizonKey = "PruneHorizon"
+	// the number of blocks pruned in one batch
+	pruneBatchBlocks = 100
+)
+
+// ErrPruned is returned when getting the block body or receipts removed by pruning, or querying the indexes
+// below the prune horizon. The pruned transactions are not found by hash, as their tx lookup indexes are removed.
+var ErrPruned = errors.New("pruned")
+
+// prune prune the canonical blocks below the current height minus retention in batches, stop when quit is
+// closed or a batch fails.
+func (blockStore *BlockStore) prune(retention uint64, quit <-chan struct{}) {
+	currentHeight := blockStore.GetCurrentBlockHeight()
+	if blockStore.GetCurrentBlock() == nil || currentHeight < retention {
+		return
+	}
+	target := currentHeight - retention + 1
+	for horizon := blockStore.pruneHorizon(); horizon < target; {
+		select {
+		case <-quit:
+			return
+		default:
+		}
+		to := horizon + pruneBatchBlocks
+		if to > target {
+			to = target
+		}
+		next, err := blockStore.pruneBlocks(horizon, to)
+		if err != nil {
+			log.Error("Failed to prune blocks from height %d, as: %v", horizon, err)
+			return
+		}
+		if next == horizon {
+			// the block at horizon is still queued in write pipeline
+			return
+		}
+		horizon = next
+	}
+}
+
+// pruneBlocks prune the canonical blocks with height in [from, to) in one batch, and move the prune horizon
+// forward. Return the new horizon, which is below to if a block in range is still queued in write pipeline.
+func (blockStore *BlockStore) pruneBlocks(from, to uint64) (uint64, error) {
+	blockStore.lock.Lock()
+	defer blockStore.lock.Unlock()
+
+	batch := blockStore.store.NewBatch()
+	blockHashes := make([]types.Hash, 0, to-from)
+	txHashes := make([]types.Hash, 0)
+	height := from
+	for ; height < to; height++ {
+		if _, ok := blockStore.pipeline.getCanonicalBlock(height); ok {
+			break
+		}
+		blockHash, err := blockStore.getCanonicalHash(height)
+		if errors.Is(err, dbstore.ErrNotFound) {
+			// no block with this height, such as the height before genesis block
+			continue
+		}
+		if err != nil {
+			batch.Reset()
+			return from, err
+		}
+		block, err := blockStore.GetBlockByHash(blockHash)
+		if err != nil {
+			batch.Reset()
+			return from, err
+		}
+
+		for _, tx := range block.Transactions {
+			txHash := common.TxHash(tx)
+			batch.Delete(append(txPrefix, common.HashToBytes(txHash)...))
+			txHashes = append(txHashes, txHash)
+		}
+		if blockStore.addressIndex {
+			// the block written without receipts has no receipt address entries
+			receipts, _ := blockStore.GetReceiptByBlockHash(blockHash)
+			blockStore.deleteAddressIndex(batch, block, receipts)
+		}
+		if _, err = blockStore.store.Get(append(headerPrefix, common.HashToBytes(blockHash)...)); errors.Is(err, dbstore.ErrNotFound) {
+			// keep the header of the legacy whole block record
+			headerByte, err := blockStore.encodeEntity(block.Header)
+			if err != nil {
+				batch.Reset()
+				return from, fmt.Errorf("failed to encode block header %x, as: %v", blockHash, err)
+			}
+			batch.Put(append(headerPrefix, common.HashToBytes(blockHash)...), headerByte)
+			batch.Put(append(headerHeightPrefix, common.HashToBytes(blockHash)...), encodeBlockHeight(height))
+		}
+		batch.Delete(append(blockPrefix, common.HashToBytes(blockHash)...))
+		batch.Delete(append(bodyPrefix, common.HashToBytes(blockHash)...))
+		batch.Delete(append(receiptPrefix, common.HashToBytes(blockHash)...))
+		blockHashes = append(blockHashes, blockHash)
+	}
+	if height == from {
+		return from, nil
+	}
+
+	batch.Put([]byte(pruneHorizonKey), encodeBlockHeight(height))
+	err := batch.Write()
+	if err != nil {
+		return from, fmt.Errorf("failed to commit pruned blocks, as: %w", err)
+	}
+	atomic.StoreUint64(&blockStore.horizon, height)
+	for _, blockHash := range blockHashes {
+		blockStore.blockCache.Remove(blockHash)
+		blockStore.receiptCache.Remove(blockHash)
+	}
+	for _, txHash := range txHashes {
+		blockStore.txLookupCache.Remove(txHash)
+	}
+	log.Debug("Pruned blocks with height in [%d, %d)", from, height)
+	return height, nil
+}
+
+// pruneHorizon get the lowest height of the canonical blocks whose bodies and receipts are kept.
+func (blockStore *BlockStore) pruneHorizon() uint64 {
+	return atomic.LoadUint64(&blockStore.horizon)
+}
+
+// loadPruneHorizon load the prune horizon recorded in database, the database never pruned has horizon 0.
+func (blockStore *BlockStore) loadPruneHorizon() error {
+	horizonByte, err := blockStore.store.Get([]byte(pruneHorizonKey))
+	if errors.Is(err, dbstore.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load prune horizon, as: %w", err)
+	}
+	if len(horizonByte) != 8 {
+		return fmt.Errorf("%w: invalid prune horizon %x", dbstore.ErrCorrupted, horizonByte)
+	}
+	atomic.StoreUint64(&blockStore.horizon, binary.BigEndian.Uint64(horizonByte))
+	return nil
+}
+
+// isPruned check whether the block is a canonical block below the prune horizon, the side chain blocks
+// are never pruned.
+func (blockStore *BlockStore) isPruned(hash types.Hash) bool {
+	horizon := blockStore.pruneHorizon()
+	if horizon == 0 {
+		return false
+	}
+	heightByte, err := blockStore.store.Get(append(headerHeightPrefix, common.HashToBytes(hash)...))
+	if err != nil || len(heightByte) != 8 || binary.BigEndian.Uint64(heightByte) >= horizon {
+		return false
+	}
+	canonicalHash, err := blockStore.getCanonicalHash(binary.BigEndian.Uint64(heightByte))
+	return err == nil && canonicalHash == hash
+}
+
+// checkPruned return ErrPruned if the height is below the prune horizon.
+func (blockStore *BlockStore) checkPruned(height uint64) error {
+	if horizon := blockStore.pruneHorizon(); height < horizon {
+		return fmt.Errorf("%w: the data below height %d has been pruned", ErrPruned, horizon)
+	}
+	return nil
+}
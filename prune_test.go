@@ -0,0 +1,114 @@
+package blockstore
+
+import (
+	"errors"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/blockstore/dbstore/leveldbstore"
+	"github.com/DSiSc/craft/types"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// write blocks from height 1 to count to block store, each block has a transaction and receipts
+func writeMockChain(t *testing.T, blockStore *BlockStore, count int) []*types.Block {
+	blocks := make([]*types.Block, 0, count)
+	block, _ := mockBlockWithTx()
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			parent := block
+			block, _ = mockBlockWithTx()
+			block.Header.PrevBlockHash = parent.HeaderHash
+			block.Header.Height = parent.Header.Height + 1
+			block.Transactions[0].Data.AccountNonce = uint64(i + 1)
+			block.Transactions[0].Data.Amount = big.NewInt(int64(i + 1))
+			rehashBlock(block)
+		}
+		assert.Nil(t, blockStore.WriteBlockWithReceipts(block, mockReceipts()))
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// test prune the blocks out of retention
+func TestBlockStore_PruneBlocks(t *testing.T) {
+	assert := assert.New(t)
+	blockStore := mockBlockStore(t, withAddressIndex, withCaches(10))
+	blocks := writeMockChain(t, blockStore, 5)
+	assert.Nil(blockStore.pruner)
+	blockStore.prune(2, make(chan struct{}))
+	assert.Equal(uint64(4), blockStore.pruneHorizon())
+
+	for _, block := range blocks[:3] {
+		header, err := blockStore.GetHeaderByHash(block.HeaderHash)
+		assert.Nil(err)
+		assert.Equal(block.Header.Height, header.Height)
+		_, err = blockStore.GetBlockByHash(block.HeaderHash)
+		assert.True(errors.Is(err, ErrPruned))
+		_, err = blockStore.GetReceiptByBlockHash(block.HeaderHash)
+		assert.True(errors.Is(err, ErrPruned))
+		_, _, _, _, err = blockStore.GetTransactionByHash(common.TxHash(block.Transactions[0]))
+		assert.True(errors.Is(err, dbstore.ErrNotFound))
+	}
+	for _, block := range blocks[3:] {
+		_, err := blockStore.GetBlockByHash(block.HeaderHash)
+		assert.Nil(err)
+		_, err = blockStore.GetReceiptByBlockHash(block.HeaderHash)
+		assert.Nil(err)
+	}
+
+	_, err := blockStore.GetTransactionsByAddress(*blocks[0].Transactions[0].Data.From, 0, 5, 0)
+	assert.True(errors.Is(err, ErrPruned))
+	txs, err := blockStore.GetTransactionsByAddress(*blocks[0].Transactions[0].Data.From, 4, 5, 0)
+	assert.Nil(err)
+	assert.Equal(2, len(txs))
+	_, err = blockStore.FilterLogs(&LogFilter{FromHeight: 1, ToHeight: 5})
+	assert.True(errors.Is(err, ErrPruned))
+	assert.True(errors.Is(blockStore.ReindexFrom(1), ErrPruned))
+	report, err := blockStore.Verify(false)
+	assert.Nil(err)
+	assert.True(report.Consistent())
+
+	// the horizon is reloaded after reopen
+	reopened := &BlockStore{store: blockStore.store, codec: blockStore.codec}
+	assert.Nil(reopened.loadPruneHorizon())
+	assert.Equal(uint64(4), reopened.pruneHorizon())
+}
+
+// test the background pruner prunes the blocks after they are written
+func TestBlockStore_BackgroundPruner(t *testing.T) {
+	assert := assert.New(t)
+	blockStore := mockBlockStore(t, withAddressIndex, withCaches(10), withPruneRetention(1))
+	blocks := writeMockChain(t, blockStore, 3)
+	for i := 0; i < 100 && blockStore.pruneHorizon() < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(uint64(3), blockStore.pruneHorizon())
+	_, err := blockStore.GetBlockByHash(blocks[1].HeaderHash)
+	assert.True(errors.Is(err, ErrPruned))
+	_, err = blockStore.GetBlockByHash(blocks[2].HeaderHash)
+	assert.Nil(err)
+	assert.Nil(blockStore.Close())
+}
+
+// test the database and the freezer are closed if the prune horizon fails to load
+func TestBlockStore_CorruptedPruneHorizon(t *testing.T) {
+	assert := assert.New(t)
+	blockStoreConfig := mockTempBlockStoreConfig(t, withLevelDB, withFreezer(t.TempDir(), 0))
+	blockStore, err := NewBlockStore(blockStoreConfig)
+	assert.Nil(err)
+	assert.Nil(blockStore.Put([]byte(pruneHorizonKey), []byte{0x01}))
+	assert.Nil(blockStore.Close())
+
+	_, err = NewBlockStore(blockStoreConfig)
+	assert.True(errors.Is(err, dbstore.ErrCorrupted))
+	store, err := leveldbstore.NewLevelDBStore(blockStoreConfig.DataPath)
+	assert.Nil(err)
+	assert.Nil(store.Delete([]byte(pruneHorizonKey)))
+	assert.Nil(store.Close())
+	blockStore, err = NewBlockStore(blockStoreConfig)
+	assert.Nil(err)
+	assert.Nil(blockStore.Close())
+}
@@ -0,0 +1,362 @@
+package blockstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+	"runtime"
+	"sync"
+)
+
+// reindexCheckpointKey tracks the start height and the next height to index of an unfinished reindex.
+const reindexCheckpointKey = "ReindexCheckpoint"
+
+// the number of blocks indexed in one batch
+var reindexBatchBlocks uint64 = 1000
+
+// ReindexFrom delete and regenerate the height mappings, tx lookup indexes and the enabled optional indexes
+// of the canonical blocks from the specified height to the latest block. The canonical blocks are found by
+// walking back from the latest block by parent links in windows, and replayed in batches loaded in parallel. The
+// lock is held by each batch and released between them, so the writes are not stalled by a long reindex, and the
+// reindex fails if the canonical chain is rewritten by others meanwhile. The progress is committed with each
+// batch, an interrupted reindex is resumed by calling ReindexFrom with the same height.
+func (blockStore *BlockStore) ReindexFrom(height uint64) error {
+	if blockStore.readOnly {
+		return dbstore.ErrReadOnly
+	}
+	head, next, rewrites, err := blockStore.startReindex(height)
+	if err != nil {
+		return err
+	}
+	// the parent links of the blocks below head are immutable, the rewrites are checked by each window
+	windows, err := blockStore.collectReindexWindows(head, next)
+	if err != nil {
+		return err
+	}
+	for _, window := range windows {
+		err = blockStore.reindexWindow(height, window, &rewrites)
+		if err != nil {
+			return err
+		}
+	}
+
+	blockStore.lock.Lock()
+	defer blockStore.lock.Unlock()
+	if err = blockStore.checkReindexRewrites(height, rewrites); err != nil {
+		return err
+	}
+	err = blockStore.store.Delete([]byte(reindexCheckpointKey))
+	if err != nil {
+		return fmt.Errorf("failed to remove reindex checkpoint, as: %w", err)
+	}
+	blockStore.rewrites++
+	blockStore.purgeCaches(true)
+	log.Info("Finish reindexing block store from height %d", height)
+	return nil
+}
+
+// startReindex delete the indexes from the height and record the reindex checkpoint, or load the checkpoint of
+// the interrupted reindex from the height. Return the latest block, the next height to index and the chain
+// rewrite counter after the deletion.
+func (blockStore *BlockStore) startReindex(height uint64) (*types.Block, uint64, uint64, error) {
+	blockStore.lock.Lock()
+	defer blockStore.lock.Unlock()
+	err := blockStore.pipeline.flush()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	head := blockStore.GetCurrentBlock()
+	if head == nil || height > head.Header.Height {
+		return nil, 0, 0, fmt.Errorf("can not reindex from height %d, as current block height is %d", height, blockStore.GetCurrentBlockHeight())
+	}
+	if err = blockStore.checkPruned(height); err != nil {
+		return nil, 0, 0, err
+	}
+
+	recordByte, err := blockStore.store.Get([]byte(reindexCheckpointKey))
+	if err != nil && !errors.Is(err, dbstore.ErrNotFound) {
+		return nil, 0, 0, err
+	}
+	next := height
+	if err == nil {
+		if len(recordByte) != 16 || binary.BigEndian.Uint64(recordByte) != height {
+			return nil, 0, 0, fmt.Errorf("an unfinished reindex checkpoint %x exists, can not reindex from height %d", recordByte, height)
+		}
+		next = binary.BigEndian.Uint64(recordByte[8:])
+		log.Info("Resume reindexing block store from height %d", next)
+	} else {
+		log.Info("Start reindexing block store from height %d", height)
+		err = blockStore.deleteIndexesFrom(height)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	blockStore.rewrites++
+	blockStore.purgeCaches(false)
+	return head, next, blockStore.rewrites, nil
+}
+
+// reindexWindow reindex the canonical blocks of the window holding the lock. The rewrites is the chain rewrite
+// counter after the last window, it is updated as the window rewrites the indexes.
+func (blockStore *BlockStore) reindexWindow(height uint64, window *reindexWindow, rewrites *uint64) error {
+	blockStore.lock.Lock()
+	defer blockStore.lock.Unlock()
+	if err := blockStore.checkReindexRewrites(height, *rewrites); err != nil {
+		return err
+	}
+	hashes, _, err := blockStore.collectCanonicalHashes(window.hash, window.from, window.to)
+	if err != nil {
+		return err
+	}
+	err = blockStore.reindexBlocks(height, hashes)
+	if err != nil {
+		return err
+	}
+	blockStore.rewrites++
+	*rewrites = blockStore.rewrites
+	return nil
+}
+
+// checkReindexRewrites check the canonical chain is not rewritten by others since the last window of reindex.
+func (blockStore *BlockStore) checkReindexRewrites(height uint64, rewrites uint64) error {
+	if blockStore.rewrites != rewrites {
+		return fmt.Errorf("canonical chain is rewritten during reindex, please resume it by ReindexFrom(%d)", height)
+	}
+	return nil
+}
+
+// unfinishedReindex get the start height and the next height to index of the unfinished reindex, return false
+// if there is no unfinished reindex.
+func (blockStore *BlockStore) unfinishedReindex() (uint64, uint64, bool) {
+	recordByte, err := blockStore.store.Get([]byte(reindexCheckpointKey))
+	if err != nil || len(recordByte) != 16 {
+		return 0, 0, err == nil
+	}
+	return binary.BigEndian.Uint64(recordByte), binary.BigEndian.Uint64(recordByte[8:]), true
+}
+
+// deleteIndexesFrom delete the indexes of the blocks from the specified height, then record the reindex
+// checkpoint. The deletion is idempotent, so it will be done again if interrupted.
+func (blockStore *BlockStore) deleteIndexesFrom(height uint64) error {
+	batch := blockStore.store.NewBatch()
+	var count uint64
+	deleteKey := func(key []byte) error {
+		if err := batch.Delete(key); err != nil {
+			return err
+		}
+		count++
+		if count%migrationBatchRecords == 0 {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+		return nil
+	}
+	deleteWithPrefix := func(prefix []byte, start []byte, shouldDelete func(key []byte, value []byte) (bool, error)) error {
+		iter := blockStore.store.NewIteratorWithPrefix(prefix, start)
+		defer iter.Release()
+		for iter.Next() {
+			ok, err := shouldDelete(iter.Key(), iter.Value())
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if err = deleteKey(append([]byte{}, iter.Key()...)); err != nil {
+				return err
+			}
+		}
+		return iter.Error()
+	}
+
+	err := deleteWithPrefix(blockHeightPrefix, encodeBlockHeight(height), func(key []byte, value []byte) (bool, error) {
+		return len(key) == len(blockHeightPrefix)+8, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete height mappings, as: %w", err)
+	}
+	if !blockStore.headersOnly {
+		// the tx lookup indexes of the blocks from the height are found by the height records of all blocks,
+		// including the side chain blocks, the orphan indexes of the transactions not in store are left to Verify
+		err = deleteWithPrefix(headerHeightPrefix, nil, func(key []byte, value []byte) (bool, error) {
+			if len(key) != len(headerHeightPrefix)+common.HashLength || len(value) != 8 || binary.BigEndian.Uint64(value) < height {
+				return false, nil
+			}
+			body, _, err := blockStore.getBodyWithSize(common.BytesToHash(key[len(headerHeightPrefix):]))
+			if errors.Is(err, dbstore.ErrNotFound) || errors.Is(err, ErrPruned) {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			for _, tx := range body.Transactions {
+				if err = deleteKey(append(txPrefix, common.HashToBytes(common.TxHash(tx))...)); err != nil {
+					return false, err
+				}
+			}
+			return false, nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete tx lookup indexes, as: %w", err)
+		}
+	}
+	if blockStore.addressIndex {
+		heightOffset := len(addressTxPrefix) + common.AddressLength
+		err = deleteWithPrefix(addressTxPrefix, nil, func(key []byte, value []byte) (bool, error) {
+			return len(key) == heightOffset+16 && binary.BigEndian.Uint64(key[heightOffset:]) >= height, nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete address index, as: %w", err)
+		}
+	}
+	if blockStore.bloomSectionSize > 0 {
+		// the section containing the height is kept, as section bloom is a superset
+		firstSection := (height + blockStore.bloomSectionSize - 1) / blockStore.bloomSectionSize
+		err = deleteWithPrefix(sectionBloomPrefix, encodeBlockHeight(firstSection), func(key []byte, value []byte) (bool, error) {
+			return true, nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete section blooms, as: %w", err)
+		}
+	}
+
+	batch.Put([]byte(reindexCheckpointKey), append(encodeBlockHeight(height), encodeBlockHeight(height)...))
+	err = batch.Write()
+	if err != nil {
+		return fmt.Errorf("failed to record reindex checkpoint, as: %w", err)
+	}
+	return nil
+}
+
+// reindexWindow is a window of at most reindexBatchBlocks canonical blocks, identified by the hash of its
+// highest block.
+type reindexWindow struct {
+	from uint64
+	to   uint64
+	hash types.Hash
+}
+
+// collectReindexWindows walk back from the head block by parent links, split the canonical blocks from the
+// specified height into windows of reindexBatchBlocks blocks, return them in ascending order of height. Only
+// the hash of the highest block of each window is held, so the memory doesn't grow with the whole range.
+func (blockStore *BlockStore) collectReindexWindows(head *types.Block, height uint64) ([]*reindexWindow, error) {
+	if head.Header.Height < height {
+		return nil, nil
+	}
+	windows := make([]*reindexWindow, 0, (head.Header.Height-height)/reindexBatchBlocks+1)
+	hash, to := head.HeaderHash, head.Header.Height
+	for {
+		from := height + (to-height)/reindexBatchBlocks*reindexBatchBlocks
+		windows = append(windows, &reindexWindow{from: from, to: to, hash: hash})
+		if from == height {
+			break
+		}
+		_, parentHash, err := blockStore.collectCanonicalHashes(hash, from, to)
+		if err != nil {
+			return nil, err
+		}
+		hash, to = parentHash, from-1
+	}
+	for i, j := 0, len(windows)-1; i < j; i, j = i+1, j-1 {
+		windows[i], windows[j] = windows[j], windows[i]
+	}
+	return windows, nil
+}
+
+// collectCanonicalHashes walk back from the canonical block with the hash and height to by parent links,
+// return the hashes of the canonical blocks from height from to height to in ascending order of height, along
+// with the parent hash of the block with height from.
+func (blockStore *BlockStore) collectCanonicalHashes(hash types.Hash, from uint64, to uint64) ([]types.Hash, types.Hash, error) {
+	hashes := make([]types.Hash, to-from+1)
+	for i := len(hashes) - 1; i >= 0; i-- {
+		header, _, err := blockStore.getHeaderWithSize(hash)
+		if err != nil {
+			return nil, types.Hash{}, fmt.Errorf("failed to get canonical block header with height %d, as: %w", from+uint64(i), err)
+		}
+		if header.Height != from+uint64(i) {
+			return nil, types.Hash{}, fmt.Errorf("%w: block %x has height %d, expected %d", dbstore.ErrCorrupted, hash, header.Height, from+uint64(i))
+		}
+		hashes[i] = hash
+		hash = header.PrevBlockHash
+	}
+	return hashes, hash, nil
+}
+
+// reindexBlocks load the blocks in parallel, then write their indexes along with the reindex checkpoint.
+func (blockStore *BlockStore) reindexBlocks(from uint64, hashes []types.Hash) error {
+	blocks := make([]*types.Block, len(hashes))
+	receipts := make([][]*types.Receipt, len(hashes))
+	errs := make([]error, len(hashes))
+	jobs := make(chan int, len(hashes))
+	for i := range hashes {
+		jobs <- i
+	}
+	close(jobs)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				blocks[i], receipts[i], errs[i] = blockStore.loadReindexedBlock(hashes[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	batch := blockStore.store.NewBatch()
+	blooms := make(map[uint64]types.Bloom)
+	for i, block := range blocks {
+		if errs[i] != nil {
+			batch.Reset()
+			return errs[i]
+		}
+		err := blockStore.writeCanonicalIndexes(batch, hashes[i], block, receipts[i])
+		if err != nil {
+			batch.Reset()
+			return err
+		}
+		if blockStore.bloomSectionSize > 0 {
+			if bloom, err := blockStore.getBlockBloom(hashes[i]); err == nil {
+				blooms[block.Header.Height] = bloom
+			}
+		}
+	}
+	blockStore.mergeSectionBlooms(batch, blooms)
+	next := blocks[len(blocks)-1].Header.Height + 1
+	batch.Put([]byte(reindexCheckpointKey), append(encodeBlockHeight(from), encodeBlockHeight(next)...))
+	err := batch.Write()
+	if err != nil {
+		log.Error("Failed to commit the indexes of blocks before height %d, as: %v", next, err)
+		return fmt.Errorf("failed to commit the indexes of blocks before height %d, as: %w", next, err)
+	}
+	log.Info("Reindexed blocks before height %d", next)
+	return nil
+}
+
+// loadReindexedBlock load the block bypassing caches, along with the receipts if address index is enabled.
+func (blockStore *BlockStore) loadReindexedBlock(hash types.Hash) (*types.Block, []*types.Receipt, error) {
+	if blockStore.headersOnly {
+		header, _, err := blockStore.getHeaderWithSize(hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &types.Block{Header: header, HeaderHash: hash}, nil, nil
+	}
+	block, _, err := blockStore.getBlockWithSize(hash)
+	if err != nil || !blockStore.addressIndex {
+		return block, nil, err
+	}
+	var receipts []*types.Receipt
+	_, err = blockStore.getEntity(receiptPrefix, hash, &receipts)
+	if err != nil && !errors.Is(err, dbstore.ErrNotFound) {
+		return nil, nil, err
+	}
+	return block, receipts, nil
+}
@@ -0,0 +1,172 @@
+package blockstore
+
+import (
+	"encoding/binary"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/indexes"
+	"github.com/DSiSc/craft/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// mock block store with address index and a chain of three blocks with transactions
+func mockReindexedBlockStore(t *testing.T) (*BlockStore, []*types.Block) {
+	blockStore := mockBlockStore(t, withAddressIndex)
+	alice := common.HexToAddress("0x01")
+	bob := common.HexToAddress("0x02")
+	block := mockBlock()
+	block.Transactions = []*types.Transaction{mockTransaction(&alice, &bob, 1)}
+	rehashBlock(block)
+	assert.Nil(t, blockStore.WriteBlock(block))
+	blocks := []*types.Block{block}
+	for nonce := uint64(2); nonce <= 3; nonce++ {
+		child := mockChildBlock(blocks[len(blocks)-1], stateHash)
+		child.Transactions = []*types.Transaction{mockTransaction(&alice, &bob, nonce)}
+		rehashBlock(child)
+		assert.Nil(t, blockStore.WriteBlockWithReceipts(child, mockReceipts()))
+		blocks = append(blocks, child)
+	}
+	return blockStore, blocks
+}
+
+// test reindex the damaged indexes
+func TestBlockStore_ReindexFrom(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, blocks := mockReindexedBlockStore(t)
+	tx3Hash := common.TxHash(blocks[2].Transactions[0])
+	assert.Nil(blockStore.Delete(append(txPrefix, tx3Hash[:]...)))
+	assert.Nil(blockStore.Delete(append(blockHeightPrefix, encodeBlockHeight(2)...)))
+	// the stale index of a side chain transaction left by a reorg
+	sideBlock := mockChildBlock(blocks[1], common.HexToHash("0x3b"))
+	alice := common.HexToAddress("0x01")
+	sideBlock.Transactions = []*types.Transaction{mockTransaction(&alice, &alice, 3)}
+	rehashBlock(sideBlock)
+	assert.Nil(blockStore.WriteBlock(sideBlock))
+	stale := common.TxHash(sideBlock.Transactions[0])
+	staleIndexByte, err := blockStore.encodeEntity(indexes.EntityLookupIndex{BlockHash: sideBlock.HeaderHash, BlockHeight: 3})
+	assert.Nil(err)
+	assert.Nil(blockStore.Put(append(txPrefix, stale[:]...), staleIndexByte))
+
+	assert.NotNil(blockStore.ReindexFrom(4))
+	assert.Nil(blockStore.ReindexFrom(2))
+	_, err = blockStore.Get([]byte(reindexCheckpointKey))
+	assert.NotNil(err)
+
+	blockSaved, err := blockStore.GetBlockByHeight(2)
+	assert.Nil(err)
+	assert.Equal(blocks[1].HeaderHash, blockSaved.HeaderHash)
+	_, txBlockHash, _, _, err := blockStore.GetTransactionByHash(tx3Hash)
+	assert.Nil(err)
+	assert.Equal(blocks[2].HeaderHash, txBlockHash)
+	_, err = blockStore.Get(append(txPrefix, stale[:]...))
+	assert.NotNil(err)
+	txs, err := blockStore.GetTransactionsByAddress(common.HexToAddress("0x01"), 1, 3, 0)
+	assert.Nil(err)
+	assert.Equal(3, len(txs))
+
+	report, err := blockStore.Verify(false)
+	assert.Nil(err)
+	assert.Empty(report.Issues)
+}
+
+// test resume an interrupted reindex
+func TestBlockStore_ReindexResume(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, blocks := mockReindexedBlockStore(t)
+	// interrupted after indexing the block with height 2
+	assert.Nil(blockStore.Delete(append(blockHeightPrefix, encodeBlockHeight(3)...)))
+	checkpoint := make([]byte, 16)
+	binary.BigEndian.PutUint64(checkpoint, 2)
+	binary.BigEndian.PutUint64(checkpoint[8:], 3)
+	assert.Nil(blockStore.Put([]byte(reindexCheckpointKey), checkpoint))
+	from, next, ok := blockStore.unfinishedReindex()
+	assert.True(ok)
+	assert.Equal(uint64(2), from)
+	assert.Equal(uint64(3), next)
+
+	assert.NotNil(blockStore.ReindexFrom(1))
+	assert.Nil(blockStore.ReindexFrom(2))
+	blockSaved, err := blockStore.GetBlockByHeight(3)
+	assert.Nil(err)
+	assert.Equal(blocks[2].HeaderHash, blockSaved.HeaderHash)
+	_, _, ok = blockStore.unfinishedReindex()
+	assert.False(ok)
+}
+
+// test reindex the blocks in windows smaller than the chain
+func TestBlockStore_ReindexWindows(t *testing.T) {
+	assert := assert.New(t)
+	defer func(batchBlocks uint64) { reindexBatchBlocks = batchBlocks }(reindexBatchBlocks)
+	reindexBatchBlocks = 2
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	blocks := writeMockChain(t, blockStore, 6)
+
+	windows, err := blockStore.collectReindexWindows(blockStore.GetCurrentBlock(), 2)
+	assert.Nil(err)
+	assert.Equal([]*reindexWindow{
+		{from: 2, to: 3, hash: blocks[2].HeaderHash},
+		{from: 4, to: 5, hash: blocks[4].HeaderHash},
+		{from: 6, to: 6, hash: blocks[5].HeaderHash},
+	}, windows)
+
+	for _, block := range blocks[1:] {
+		txHash := common.TxHash(block.Transactions[0])
+		assert.Nil(blockStore.Delete(append(txPrefix, txHash[:]...)))
+	}
+	assert.Nil(blockStore.ReindexFrom(2))
+	report, err := blockStore.Verify(false)
+	assert.Nil(err)
+	assert.Empty(report.Issues)
+}
+
+// test reindex fails if the canonical chain is rewritten between windows
+func TestBlockStore_ReindexRewritten(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, blocks := mockReindexedBlockStore(t)
+	head, next, rewrites, err := blockStore.startReindex(2)
+	assert.Nil(err)
+	assert.Equal(uint64(2), next)
+	windows, err := blockStore.collectReindexWindows(head, next)
+	assert.Nil(err)
+	assert.Equal(1, len(windows))
+
+	// rewritten by others while the lock is released
+	blockStore.rewrites++
+	assert.NotNil(blockStore.reindexWindow(2, windows[0], &rewrites))
+	_, _, ok := blockStore.unfinishedReindex()
+	assert.True(ok)
+
+	assert.Nil(blockStore.ReindexFrom(2))
+	blockSaved, err := blockStore.GetBlockByHeight(3)
+	assert.Nil(err)
+	assert.Equal(blocks[2].HeaderHash, blockSaved.HeaderHash)
+}
+
+// test open the database with an unfinished reindex
+func TestNewBlockStore_UnfinishedReindex(t *testing.T) {
+	assert := assert.New(t)
+	blockStoreConfig := mockTempBlockStoreConfig(t, withLevelDB)
+	blockStore, err := NewBlockStore(blockStoreConfig)
+	assert.Nil(err)
+	blocks := writeMockChain(t, blockStore, 3)
+	// interrupted after deleting the indexes
+	assert.Nil(blockStore.Delete(append(blockHeightPrefix, encodeBlockHeight(2)...)))
+	assert.Nil(blockStore.Delete(append(blockHeightPrefix, encodeBlockHeight(3)...)))
+	assert.Nil(blockStore.Put([]byte(reindexCheckpointKey), append(encodeBlockHeight(2), encodeBlockHeight(2)...)))
+	assert.Nil(blockStore.Close())
+
+	blockStoreConfig.ReadOnly = true
+	_, err = NewBlockStore(blockStoreConfig)
+	assert.NotNil(err)
+
+	blockStoreConfig.ReadOnly = false
+	blockStore, err = NewBlockStore(blockStoreConfig)
+	assert.Nil(err)
+	defer blockStore.Close()
+	_, _, ok := blockStore.unfinishedReindex()
+	assert.False(ok)
+	blockSaved, err := blockStore.GetBlockByHeight(3)
+	assert.Nil(err)
+	assert.Equal(blocks[2].HeaderHash, blockSaved.HeaderHash)
+}
@@ -0,0 +1,56 @@
+package blockstore
+
+// backgroundTask run the work in background each time it is notified, until it is stopped. The work should
+// return soon after quit is closed. A nil backgroundTask is disabled.
+type backgroundTask struct {
+	work func(quit <-chan struct{})
+	wake chan struct{}
+	quit chan struct{}
+	done chan struct{}
+}
+
+// newBackgroundTask create a background task and run the work once.
+func newBackgroundTask(work func(quit <-chan struct{})) *backgroundTask {
+	task := &backgroundTask{
+		work: work,
+		wake: make(chan struct{}, 1),
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go task.loop()
+	task.notify()
+	return task
+}
+
+// notify wake the task to run the work again, it never blocks.
+func (task *backgroundTask) notify() {
+	if task == nil {
+		return
+	}
+	select {
+	case task.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stop stop the task after the work in progress returns. The caller must not hold the block store lock.
+func (task *backgroundTask) stop() {
+	if task == nil {
+		return
+	}
+	close(task.quit)
+	<-task.done
+}
+
+// loop run the work each time the task is woken until it is stopped.
+func (task *backgroundTask) loop() {
+	defer close(task.done)
+	for {
+		select {
+		case <-task.quit:
+			return
+		case <-task.wake:
+			task.work(task.quit)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/DSiSc/blockstore"
+	"github.com/DSiSc/blockstore/config"
+	"os"
+)
+
+// backup the block store to another directory.
+func backupDatabase(args []string) {
+	var showHelp bool
+	var dbPath string
+	var backupPath string
+	var incremental bool
+	var keyFile string
+	flagSet := flag.NewFlagSet("db-backup", flag.ExitOnError)
+	flagSet.StringVar(&dbPath, "f", "", "The block store file path.")
+	flagSet.StringVar(&backupPath, "o", "", "The backup directory.")
+	flagSet.BoolVar(&incremental, "i", false, "Update the existing backup with the blocks above its backup height.")
+	flagSet.StringVar(&keyFile, "k", "", "The encryption key file of the block store, the backup is encrypted by the same keys.")
+	flagSet.BoolVar(&showHelp, "h", false, "Display help.")
+	flagSet.Usage = func() {
+		fmt.Println(`Justitia Block Store backup tool.
+
+Usage:
+    Backup database:  go run ./tools backup -f [file path] -o [backup directory] [-i] [-k key file]
+
+Examples:
+    You can use this tool to copy the block store to a backup directory, which can be restored by the restore command.
+    A full backup requires the backup directory not exist or be empty.
+
+	Take a full backup of the block store.
+		go run ./tools backup -f /var/db/ -o /var/backup/
+
+	Update the backup with the blocks written after it.
+		go run ./tools backup -f /var/db/ -o /var/backup/ -i
+   `)
+	}
+	flagSet.Parse(args)
+
+	if showHelp || backupPath == "" {
+		flagSet.Usage()
+		return
+	}
+
+	bconf := &config.BlockStoreConfig{
+		PluginName:        blockstore.PLUGIN_LEVELDB,
+		DataPath:          dbPath,
+		EncryptionKeyFile: keyFile,
+		ReadOnly:          true,
+	}
+	bStore, err := blockstore.NewBlockStore(bconf)
+	if err != nil {
+		fmt.Printf("failed to open block store, as: %v\n", err)
+		os.Exit(1)
+	}
+	defer bStore.Close()
+
+	height, err := bStore.Backup(backupPath, incremental)
+	if err != nil {
+		fmt.Printf("failed to backup block store, as: %v\n", err)
+		bStore.Close()
+		os.Exit(1)
+	}
+	fmt.Printf("backed up block store to %s at height %d\n", backupPath, height)
+}
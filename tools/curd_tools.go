@@ -4,14 +4,34 @@ import (
 	"flag"
 	"fmt"
 	"github.com/DSiSc/blockstore"
-	"github.com/DSiSc/blockstore/common"
 	"github.com/DSiSc/blockstore/config"
 	"os"
 )
 
-const latestBlockKey = "LatestBlock"
+// sub commands of the tool, the blocks deleting is the default command.
+var subCommands = map[string]func(args []string){
+	"migrate":   migrateDatabase,
+	"verify":    verifyDatabase,
+	"reindex":   reindexDatabase,
+	"export":    exportChain,
+	"import":    importChain,
+	"backup":    backupDatabase,
+	"restore":   restoreDatabase,
+	"reencrypt": reencryptDatabase,
+}
 
 func main() {
+	if len(os.Args) > 1 {
+		if subCommand, ok := subCommands[os.Args[1]]; ok {
+			subCommand(os.Args[2:])
+			return
+		}
+	}
+	deleteBlocks(os.Args[1:])
+}
+
+// delete the latest blocks from block store.
+func deleteBlocks(args []string) {
 	var blkNums uint64
 	var showHelp bool
 	var dbPath string
@@ -23,16 +43,24 @@ func main() {
 		fmt.Println(`Justitia Block Store CURD tool.
 
 Usage:
-    Delete the latest [num] blocks:  go run curd_tools.go -f [file path] -d [num]
+    Delete the latest [num] blocks:  go run ./tools -f [file path] -d [num]
+    Migrate database:                go run ./tools migrate -f [file path] -c [codec] [-k key file]
+    Verify database:                 go run ./tools verify -f [file path] [-r]
+    Reindex database:                go run ./tools reindex -f [file path] -n [height]
+    Export chain:                    go run ./tools export -f [file path] -o [output file] [-from height] [-to height] [-z]
+    Import chain:                    go run ./tools import -f [file path] -i [input file]
+    Backup database:                 go run ./tools backup -f [file path] -o [backup directory] [-i] [-k key file]
+    Restore database:                go run ./tools restore -f [file path] -b [backup directory] [-k key file]
+    Re-encrypt database:             go run ./tools reencrypt -f [file path] [-k key file] -n [new key]
 
 Examples:
     You can use this tool to delete the block from block store.
 		
 	Delete the latest 2 blocks from block store.
-		go run curd_tools.go -f /var/db/ -d 2
+		go run ./tools -f /var/db/ -d 2
    `)
 	}
-	flagSet.Parse(os.Args[1:])
+	flagSet.Parse(args)
 
 	if showHelp {
 		flagSet.Usage()
@@ -48,22 +76,19 @@ Examples:
 		fmt.Printf("failed to open block store, as: %v\n", err)
 		os.Exit(1)
 	}
+	defer bStore.Close()
 
 	cBlock := bStore.GetCurrentBlock()
-	if cBlock.Header.Height <= blkNums {
+	if cBlock == nil || cBlock.Header.Height <= blkNums {
 		fmt.Printf("have no enough blocks in block store,")
+		bStore.Close()
 		os.Exit(1)
 	}
 
-	blk, err := bStore.GetBlockByHeight(cBlock.Header.Height - blkNums)
-	if err != nil {
-		fmt.Printf("can't find a block as the latest block after deleting %d blocks from block store, as: %v\n", blk.Header.Height, err)
-		os.Exit(1)
-	}
-
-	err = bStore.Put([]byte(latestBlockKey), common.HashToBytes(blk.HeaderHash))
+	err = bStore.Rollback(cBlock.Header.Height - blkNums)
 	if err != nil {
-		fmt.Printf("failed to update current block info, as: %v\n", err)
+		fmt.Printf("failed to delete the latest %d blocks from block store, as: %v\n", blkNums, err)
+		bStore.Close()
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/DSiSc/blockstore"
+	"github.com/DSiSc/blockstore/config"
+	"math"
+	"os"
+)
+
+// export the canonical blocks with their receipts to a file.
+func exportChain(args []string) {
+	var showHelp bool
+	var dbPath string
+	var outputPath string
+	var from, to uint64
+	var compress bool
+	flagSet := flag.NewFlagSet("db-export", flag.ExitOnError)
+	flagSet.StringVar(&dbPath, "f", "", "The block store file path.")
+	flagSet.StringVar(&outputPath, "o", "", "The output file path.")
+	flagSet.Uint64Var(&from, "from", 0, "The first block height to export.")
+	flagSet.Uint64Var(&to, "to", math.MaxUint64, "The last block height to export, default is the current height.")
+	flagSet.BoolVar(&compress, "z", false, "Compress the exported blocks by gzip.")
+	flagSet.BoolVar(&showHelp, "h", false, "Display help.")
+	flagSet.Usage = func() {
+		fmt.Println(`Justitia Block Store export tool.
+
+Usage:
+    Export chain:  go run ./tools export -f [file path] -o [output file] [-from height] [-to height] [-z]
+
+Examples:
+    You can use this tool to export the canonical blocks with their receipts, which can be imported by the import command.
+
+	Export the blocks from height 100 to the current height with gzip compression.
+		go run ./tools export -f /var/db/ -o /tmp/chain.bin -from 100 -z
+   `)
+	}
+	flagSet.Parse(args)
+
+	if showHelp || outputPath == "" {
+		flagSet.Usage()
+		return
+	}
+
+	bconf := &config.BlockStoreConfig{
+		PluginName: blockstore.PLUGIN_LEVELDB,
+		DataPath:   dbPath,
+		ReadOnly:   true,
+	}
+	bStore, err := blockstore.NewBlockStore(bconf)
+	if err != nil {
+		fmt.Printf("failed to open block store, as: %v\n", err)
+		os.Exit(1)
+	}
+	defer bStore.Close()
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		fmt.Printf("failed to create output file, as: %v\n", err)
+		bStore.Close()
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	if to > bStore.GetCurrentBlockHeight() {
+		to = bStore.GetCurrentBlockHeight()
+	}
+	err = bStore.ExportChain(file, from, to, compress)
+	if err != nil {
+		fmt.Printf("failed to export chain, as: %v\n", err)
+		file.Close()
+		bStore.Close()
+		os.Exit(1)
+	}
+	fmt.Printf("exported blocks from height %d to %d\n", from, to)
+}
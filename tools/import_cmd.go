@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/DSiSc/blockstore"
+	"github.com/DSiSc/blockstore/config"
+	"os"
+)
+
+// import the blocks exported by the export command.
+func importChain(args []string) {
+	var showHelp bool
+	var dbPath string
+	var inputPath string
+	flagSet := flag.NewFlagSet("db-import", flag.ExitOnError)
+	flagSet.StringVar(&dbPath, "f", "", "The block store file path.")
+	flagSet.StringVar(&inputPath, "i", "", "The input file path.")
+	flagSet.BoolVar(&showHelp, "h", false, "Display help.")
+	flagSet.Usage = func() {
+		fmt.Println(`Justitia Block Store import tool.
+
+Usage:
+    Import chain:  go run ./tools import -f [file path] -i [input file]
+
+Examples:
+    You can use this tool to import the blocks exported by the export command, the existing blocks are skipped.
+
+	Import the blocks from the exported file.
+		go run ./tools import -f /var/db/ -i /tmp/chain.bin
+   `)
+	}
+	flagSet.Parse(args)
+
+	if showHelp || inputPath == "" {
+		flagSet.Usage()
+		return
+	}
+
+	bconf := &config.BlockStoreConfig{
+		PluginName: blockstore.PLUGIN_LEVELDB,
+		DataPath:   dbPath,
+	}
+	bStore, err := blockstore.NewBlockStore(bconf)
+	if err != nil {
+		fmt.Printf("failed to open block store, as: %v\n", err)
+		os.Exit(1)
+	}
+	defer bStore.Close()
+
+	file, err := os.Open(inputPath)
+	if err != nil {
+		fmt.Printf("failed to open input file, as: %v\n", err)
+		bStore.Close()
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	count, err := bStore.ImportChain(file)
+	if err != nil {
+		fmt.Printf("failed to import chain after %d blocks, as: %v\n", count, err)
+		file.Close()
+		bStore.Close()
+		os.Exit(1)
+	}
+	fmt.Printf("imported %d blocks\n", count)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/DSiSc/blockstore"
+	"github.com/DSiSc/blockstore/codec"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/blockstore/dbstore/encryptedstore"
+	"github.com/DSiSc/blockstore/dbstore/leveldbstore"
+	"os"
+)
+
+// migrate the database to the latest schema and the target codec.
+func migrateDatabase(args []string) {
+	var showHelp bool
+	var dbPath string
+	var codecName string
+	var keyFile string
+	flagSet := flag.NewFlagSet("db-migrate", flag.ExitOnError)
+	flagSet.StringVar(&dbPath, "f", "", "The block store file path.")
+	flagSet.StringVar(&codecName, "c", codec.RLP, "The codec to re-encode the database with.")
+	flagSet.StringVar(&keyFile, "k", "", "The encryption key file of the database.")
+	flagSet.BoolVar(&showHelp, "h", false, "Display help.")
+	flagSet.Usage = func() {
+		fmt.Println(`Justitia Block Store migration tool.
+
+Usage:
+    Migrate database:  go run ./tools migrate -f [file path] -c [codec] [-k key file]
+
+Examples:
+    You can use this tool to upgrade the database schema and re-encode the records with another codec.
+    An interrupted migration will be resumed by running the same command again.
+
+	Re-encode the block store with rlp.
+		go run ./tools migrate -f /var/db/ -c rlp
+   `)
+	}
+	flagSet.Parse(args)
+
+	if showHelp {
+		flagSet.Usage()
+		return
+	}
+
+	store, err := leveldbstore.NewLevelDBStore(dbPath)
+	if err != nil {
+		fmt.Printf("failed to open database, as: %v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+	var migratedStore dbstore.DBStore = store
+	if keyFile != "" {
+		keys, err := encryptedstore.LoadKeyFile(keyFile)
+		if err == nil {
+			migratedStore, err = encryptedstore.NewEncryptedStore(store, keys)
+		}
+		if err != nil {
+			fmt.Printf("failed to load encryption keys, as: %v\n", err)
+			store.Close()
+			os.Exit(1)
+		}
+	}
+
+	err = blockstore.MigrateDatabase(migratedStore, codecName, func(prefix []byte, count uint64) {
+		fmt.Printf("migrated %d records with prefix %s\n", count, prefix)
+	})
+	if err != nil {
+		fmt.Printf("failed to migrate database, as: %v\n", err)
+		store.Close()
+		os.Exit(1)
+	}
+	fmt.Println("database migration finished")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/DSiSc/blockstore/dbstore/encryptedstore"
+	"github.com/DSiSc/blockstore/dbstore/leveldbstore"
+	"os"
+)
+
+// re-encrypt the database with a new key.
+func reencryptDatabase(args []string) {
+	var showHelp bool
+	var dbPath string
+	var keyFile string
+	var newKey string
+	flagSet := flag.NewFlagSet("db-reencrypt", flag.ExitOnError)
+	flagSet.StringVar(&dbPath, "f", "", "The block store file path.")
+	flagSet.StringVar(&keyFile, "k", "", "The file of the current encryption keys, omit it if the database is not encrypted.")
+	flagSet.StringVar(&newKey, "n", "", "The new encryption key in format <key id>:<hex key>.")
+	flagSet.BoolVar(&showHelp, "h", false, "Display help.")
+	flagSet.Usage = func() {
+		fmt.Println(`Justitia Block Store re-encryption tool.
+
+Usage:
+    Re-encrypt database:  go run ./tools reencrypt -f [file path] [-k key file] -n [new key]
+
+Examples:
+    You can use this tool to encrypt all values of the block store with a new key, including the values written
+    before encryption is enabled, the node must be stopped. Append the new key to the key file after re-encryption,
+    the old keys can be removed then. An interrupted re-encryption will be resumed by running the same command again.
+
+	Encrypt a plaintext block store with key 1.
+		go run ./tools reencrypt -f /var/db/ -n 1:000102030405060708090a0b0c0d0e0f
+
+	Rotate the keys in key file to key 2.
+		go run ./tools reencrypt -f /var/db/ -k /etc/db.keys -n 2:101112131415161718191a1b1c1d1e1f
+   `)
+	}
+	flagSet.Parse(args)
+
+	if showHelp || newKey == "" {
+		flagSet.Usage()
+		return
+	}
+
+	keys, err := encryptedstore.LoadKeys(newKey, keyFile)
+	if err != nil {
+		fmt.Printf("failed to load encryption keys, as: %v\n", err)
+		os.Exit(1)
+	}
+	store, err := leveldbstore.NewLevelDBStore(dbPath)
+	if err != nil {
+		fmt.Printf("failed to open database, as: %v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+	encryptedStore, err := encryptedstore.NewMigrationEncryptedStore(store, keys)
+	if err != nil {
+		fmt.Printf("failed to create encrypted store, as: %v\n", err)
+		store.Close()
+		os.Exit(1)
+	}
+
+	count, err := encryptedStore.Reencrypt(func(count uint64) {
+		fmt.Printf("re-encrypted %d values\n", count)
+	})
+	if err != nil {
+		fmt.Printf("failed to re-encrypt database, as: %v\n", err)
+		store.Close()
+		os.Exit(1)
+	}
+	fmt.Printf("database re-encryption finished, %d values are encrypted with key %d\n", count, keys[len(keys)-1].ID)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/DSiSc/blockstore"
+	"github.com/DSiSc/blockstore/config"
+	"os"
+)
+
+// rebuild the indexes of the blocks from the specified height.
+func reindexDatabase(args []string) {
+	var showHelp bool
+	var dbPath string
+	var height uint64
+	var addressIndex bool
+	var sectionSize uint64
+	flagSet := flag.NewFlagSet("db-reindex", flag.ExitOnError)
+	flagSet.StringVar(&dbPath, "f", "", "The block store file path.")
+	flagSet.Uint64Var(&height, "n", 0, "The block height to reindex from.")
+	flagSet.BoolVar(&addressIndex, "a", false, "Rebuild the address index.")
+	flagSet.Uint64Var(&sectionSize, "s", 0, "Rebuild the section bloom index with the section size.")
+	flagSet.BoolVar(&showHelp, "h", false, "Display help.")
+	flagSet.Usage = func() {
+		fmt.Println(`Justitia Block Store reindex tool.
+
+Usage:
+    Reindex database:  go run ./tools reindex -f [file path] -n [height] [-a] [-s section size]
+
+Examples:
+    You can use this tool to rebuild the height mappings, tx lookup indexes and the optional indexes
+    from the stored blocks. An interrupted reindex is finished when the block store is opened again.
+
+	Rebuild the indexes of the blocks from height 100, including the address index.
+		go run ./tools reindex -f /var/db/ -n 100 -a
+   `)
+	}
+	flagSet.Parse(args)
+
+	if showHelp {
+		flagSet.Usage()
+		return
+	}
+
+	bconf := &config.BlockStoreConfig{
+		PluginName:       blockstore.PLUGIN_LEVELDB,
+		DataPath:         dbPath,
+		AddressIndex:     addressIndex,
+		BloomSectionSize: sectionSize,
+	}
+	bStore, err := blockstore.NewBlockStore(bconf)
+	if err != nil {
+		fmt.Printf("failed to open block store, as: %v\n", err)
+		os.Exit(1)
+	}
+	defer bStore.Close()
+
+	err = bStore.ReindexFrom(height)
+	if err != nil {
+		fmt.Printf("failed to reindex block store from height %d, as: %v\n", height, err)
+		bStore.Close()
+		os.Exit(1)
+	}
+	fmt.Println("block store reindex finished")
+}
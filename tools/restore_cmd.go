@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/DSiSc/blockstore"
+	"github.com/DSiSc/blockstore/config"
+	"os"
+)
+
+// restore the block store from a backup.
+func restoreDatabase(args []string) {
+	var showHelp bool
+	var dbPath string
+	var backupPath string
+	var keyFile string
+	flagSet := flag.NewFlagSet("db-restore", flag.ExitOnError)
+	flagSet.StringVar(&dbPath, "f", "", "The block store file path.")
+	flagSet.StringVar(&backupPath, "b", "", "The backup directory.")
+	flagSet.StringVar(&keyFile, "k", "", "The encryption key file of the backup.")
+	flagSet.BoolVar(&showHelp, "h", false, "Display help.")
+	flagSet.Usage = func() {
+		fmt.Println(`Justitia Block Store restore tool.
+
+Usage:
+    Restore database:  go run ./tools restore -f [file path] -b [backup directory] [-k key file]
+
+Examples:
+    You can use this tool to replace the block store with a backup taken by the backup command, the node must be
+    stopped. The backup is verified before restoring, the replaced block store is moved to [file path].replaced.
+
+	Restore the block store from the backup.
+		go run ./tools restore -f /var/db -b /var/backup/
+   `)
+	}
+	flagSet.Parse(args)
+
+	if showHelp || dbPath == "" || backupPath == "" {
+		flagSet.Usage()
+		return
+	}
+
+	err := blockstore.RestoreBackup(backupPath, &config.BlockStoreConfig{
+		PluginName:        blockstore.PLUGIN_LEVELDB,
+		DataPath:          dbPath,
+		EncryptionKeyFile: keyFile,
+	})
+	if err != nil {
+		fmt.Printf("failed to restore block store, as: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("restored block store in %s from %s\n", dbPath, backupPath)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/DSiSc/blockstore"
+	"github.com/DSiSc/blockstore/config"
+	"os"
+)
+
+// verify the block store is internally consistent, and print the report as json.
+func verifyDatabase(args []string) {
+	var showHelp bool
+	var dbPath string
+	var repair bool
+	flagSet := flag.NewFlagSet("db-verify", flag.ExitOnError)
+	flagSet.StringVar(&dbPath, "f", "", "The block store file path.")
+	flagSet.BoolVar(&repair, "r", false, "Repair the height mappings and tx lookup indexes.")
+	flagSet.BoolVar(&showHelp, "h", false, "Display help.")
+	flagSet.Usage = func() {
+		fmt.Println(`Justitia Block Store verification tool.
+
+Usage:
+    Verify database:  go run ./tools verify -f [file path] [-r]
+
+Examples:
+    You can use this tool to check the block store is internally consistent after crashes or manual edits.
+    The report is printed as json, the tool exits with 1 if any unrepaired issue is found.
+
+	Verify the block store and repair the indexes.
+		go run ./tools verify -f /var/db/ -r
+   `)
+	}
+	flagSet.Parse(args)
+
+	if showHelp {
+		flagSet.Usage()
+		return
+	}
+
+	bconf := &config.BlockStoreConfig{
+		PluginName: blockstore.PLUGIN_LEVELDB,
+		DataPath:   dbPath,
+		ReadOnly:   !repair,
+	}
+	bStore, err := blockstore.NewBlockStore(bconf)
+	if err != nil {
+		fmt.Printf("failed to open block store, as: %v\n", err)
+		os.Exit(1)
+	}
+	defer bStore.Close()
+
+	report, err := bStore.Verify(repair)
+	if err != nil {
+		fmt.Printf("failed to verify block store, as: %v\n", err)
+		bStore.Close()
+		os.Exit(1)
+	}
+	reportByte, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Printf("failed to encode verification report, as: %v\n", err)
+		bStore.Close()
+		os.Exit(1)
+	}
+	fmt.Println(string(reportByte))
+	if !report.Consistent() {
+		bStore.Close()
+		os.Exit(1)
+	}
+}
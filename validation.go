@@ -0,0 +1,71 @@
+package blockstore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/craft/log"
+)
+
+// The errors returned by strict validation of the written blocks, each for a validation rule. They are
+// wrapped with the detail of the invalid block, so callers should check them by errors.Is.
+var (
+	// ErrUnknownParent is returned when the parent block doesn't exist in store.
+	ErrUnknownParent = errors.New("unknown parent block")
+	// ErrInvalidHeight is returned when the block height is not the parent height + 1.
+	ErrInvalidHeight = errors.New("invalid block height")
+	// ErrTxRootMismatch is returned when the transaction root in header doesn't match the transactions.
+	ErrTxRootMismatch = errors.New("transaction root mismatch")
+	// ErrReceiptsRootMismatch is returned when the receipts root in header doesn't match the receipts.
+	ErrReceiptsRootMismatch = errors.New("receipts root mismatch")
+	// ErrReceiptsCountMismatch is returned when the number of receipts is not the number of transactions.
+	ErrReceiptsCountMismatch = errors.New("receipts count mismatch")
+)
+
+// validateBlock check the parent linkage, height continuity, transaction root and receipts of the written
+// block. The parent of the first block written to an empty store is not checked, the transactions and
+// receipts are not checked if the store only stores block headers.
+func (blockStore *BlockStore) validateBlock(write *blockWrite) error {
+	block := write.block
+	if blockStore.GetCurrentBlock() != nil {
+		parent, err := blockStore.GetHeaderByHash(block.Header.PrevBlockHash)
+		if errors.Is(err, dbstore.ErrNotFound) {
+			return fmt.Errorf("%w: parent %x of block %x doesn't exist", ErrUnknownParent, block.Header.PrevBlockHash, block.HeaderHash)
+		}
+		if err != nil {
+			return err
+		}
+		if block.Header.Height != parent.Height+1 {
+			return fmt.Errorf("%w: block %x has height %d, but its parent height is %d", ErrInvalidHeight, block.HeaderHash, block.Header.Height, parent.Height)
+		}
+	}
+	if blockStore.headersOnly {
+		return nil
+	}
+
+	if txRoot := blockStore.txRoot(block.Transactions); txRoot != block.Header.TxRoot {
+		return fmt.Errorf("%w: block %x has transaction root %x, but the transactions root is %x", ErrTxRootMismatch, block.HeaderHash, block.Header.TxRoot, txRoot)
+	}
+	if !write.withReceipts {
+		return nil
+	}
+	if len(write.receipts) != len(block.Transactions) {
+		return fmt.Errorf("%w: block %x has %d transactions, but %d receipts", ErrReceiptsCountMismatch, block.HeaderHash, len(block.Transactions), len(write.receipts))
+	}
+	if receiptsRoot := blockStore.receiptsRoot(write.receipts); receiptsRoot != block.Header.ReceiptsRoot {
+		return fmt.Errorf("%w: block %x has receipts root %x, but the receipts root is %x", ErrReceiptsRootMismatch, block.HeaderHash, block.Header.ReceiptsRoot, receiptsRoot)
+	}
+	return nil
+}
+
+// checkBlock validate the block if strict validation is enabled.
+func (blockStore *BlockStore) checkBlock(write *blockWrite) error {
+	if !blockStore.strictValidation {
+		return nil
+	}
+	err := blockStore.validateBlock(write)
+	if err != nil {
+		log.Error("Invalid block %x, as: %v", write.block.HeaderHash, err)
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+package blockstore
+
+import (
+	"errors"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/craft/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// mock a valid child block with txs, along with its receipts
+func mockValidChildBlock(parent *types.Block) (*types.Block, []*types.Receipt) {
+	block, _ := mockBlockWithTx()
+	receipts := mockReceipts()
+	block.Header.PrevBlockHash = parent.HeaderHash
+	block.Header.Height = parent.Header.Height + 1
+	block.Header.TxRoot = common.TxRoot(block.Transactions)
+	block.Header.ReceiptsRoot = common.ReceiptsRoot(receipts)
+	rehashBlock(block)
+	return block, receipts
+}
+
+// rehash the block after modifying header
+func rehashBlock(block *types.Block) {
+	block.HeaderHash = types.Hash{}
+	block.HeaderHash = common.HeaderHash(block)
+}
+
+// test write valid blocks with strict validation
+func TestBlockStore_StrictValidation(t *testing.T) {
+	assert := assert.New(t)
+	blockStore := mockBlockStore(t, withStrictValidation)
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+	block2, receipts := mockValidChildBlock(block)
+	assert.Nil(blockStore.WriteBlockWithReceipts(block2, receipts))
+	assert.Equal(block2.HeaderHash, blockStore.GetCurrentBlock().HeaderHash)
+}
+
+// test each validation rule
+func TestBlockStore_ValidationErrors(t *testing.T) {
+	assert := assert.New(t)
+	blockStore := mockBlockStore(t, withStrictValidation)
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+
+	unknownParent, receipts := mockValidChildBlock(block)
+	unknownParent.Header.PrevBlockHash = blockHash
+	rehashBlock(unknownParent)
+	assert.True(errors.Is(blockStore.WriteBlockWithReceipts(unknownParent, receipts), ErrUnknownParent))
+
+	invalidHeight, receipts := mockValidChildBlock(block)
+	invalidHeight.Header.Height = 3
+	rehashBlock(invalidHeight)
+	assert.True(errors.Is(blockStore.WriteBlockWithReceipts(invalidHeight, receipts), ErrInvalidHeight))
+
+	invalidTxRoot, receipts := mockValidChildBlock(block)
+	invalidTxRoot.Header.TxRoot = blockHash
+	rehashBlock(invalidTxRoot)
+	assert.True(errors.Is(blockStore.WriteBlockWithReceipts(invalidTxRoot, receipts), ErrTxRootMismatch))
+
+	invalidReceiptsRoot, receipts := mockValidChildBlock(block)
+	invalidReceiptsRoot.Header.ReceiptsRoot = blockHash
+	rehashBlock(invalidReceiptsRoot)
+	assert.True(errors.Is(blockStore.WriteBlockWithReceipts(invalidReceiptsRoot, receipts), ErrReceiptsRootMismatch))
+
+	valid, receipts := mockValidChildBlock(block)
+	err := blockStore.WriteBlockWithReceipts(valid, append(receipts, receipts...))
+	assert.True(errors.Is(err, ErrReceiptsCountMismatch))
+	assert.False(errors.Is(err, ErrReceiptsRootMismatch))
+	assert.Equal(block.HeaderHash, blockStore.GetCurrentBlock().HeaderHash)
+}
+
+// test strict validation with the root functions of the chain
+func TestBlockStore_ValidationRootFunc(t *testing.T) {
+	assert := assert.New(t)
+	// a chain whose transaction root is the hash of the concatenated transaction hashes, and receipts root is
+	// the tx hash of the first receipt
+	txRoot := func(txs []*types.Transaction) types.Hash {
+		if len(txs) == 0 {
+			return types.Hash{}
+		}
+		hw := common.HashAlg()
+		for _, tx := range txs {
+			txHash := common.TxHash(tx)
+			hw.Write(txHash[:])
+		}
+		var root types.Hash
+		hw.Sum(root[:0])
+		return root
+	}
+	receiptsRoot := func(receipts []*types.Receipt) types.Hash {
+		if len(receipts) == 0 {
+			return types.Hash{}
+		}
+		return receipts[0].TxHash
+	}
+	config := mockBlockStoreConfig()
+	config.StrictValidation = true
+	config.TxRootFunc = txRoot
+	config.ReceiptsRootFunc = receiptsRoot
+	blockStore, err := NewBlockStore(config)
+	assert.Nil(err)
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+
+	block2, receipts := mockValidChildBlock(block)
+	assert.True(errors.Is(blockStore.WriteBlockWithReceipts(block2, receipts), ErrTxRootMismatch))
+	block2.Header.TxRoot = txRoot(block2.Transactions)
+	rehashBlock(block2)
+	assert.True(errors.Is(blockStore.WriteBlockWithReceipts(block2, receipts), ErrReceiptsRootMismatch))
+	block2.Header.ReceiptsRoot = receiptsRoot(receipts)
+	rehashBlock(block2)
+	assert.Nil(blockStore.WriteBlockWithReceipts(block2, receipts))
+}
@@ -0,0 +1,372 @@
+package blockstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/blockstore/indexes"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+)
+
+// the number of canonical blocks or records checked in a window of Verify, the lock is released and the
+// repairs are committed between windows.
+var verifyWindow = 1000
+
+// kinds of the issues found by Verify
+const (
+	// the block header or body is missing or can not be decoded
+	VERIFY_BROKEN_BLOCK = "broken_block"
+	// the block hash doesn't match the block header
+	VERIFY_HASH_MISMATCH = "hash_mismatch"
+	// the parent of a block is missing or the height is not continuous
+	VERIFY_BROKEN_PARENT_LINK = "broken_parent_link"
+	// the height to hash mapping of a canonical block is missing or wrong, repairable
+	VERIFY_HEIGHT_MAPPING = "height_mapping"
+	// the tx lookup index of a canonical transaction is missing or wrong, repairable
+	VERIFY_TX_LOOKUP = "tx_lookup"
+	// the number of receipts is not the number of transactions
+	VERIFY_RECEIPTS_COUNT = "receipts_count"
+	// the tx lookup index of a transaction not in canonical chain, repairable
+	VERIFY_ORPHAN_TX_LOOKUP = "orphan_tx_lookup"
+	// the receipts of a block not in store, repairable
+	VERIFY_ORPHAN_RECEIPTS = "orphan_receipts"
+)
+
+// VerifyIssue is an inconsistency found by Verify.
+type VerifyIssue struct {
+	Kind     string
+	Height   uint64 // height of the block the issue relates to, 0 if the height of an orphan record is unknown
+	Hash     string // hex of the block or transaction hash the issue relates to
+	Detail   string
+	Repaired bool
+}
+
+// VerifyReport is the result of Verify.
+type VerifyReport struct {
+	LatestHeight     uint64
+	CheckedBlocks    uint64
+	CheckedTxLookups uint64
+	CheckedReceipts  uint64
+	Issues           []*VerifyIssue
+}
+
+// Consistent return true if no unrepaired issue was found.
+func (report *VerifyReport) Consistent() bool {
+	for _, issue := range report.Issues {
+		if !issue.Repaired {
+			return false
+		}
+	}
+	return true
+}
+
+// addIssue record an issue found by Verify.
+func (report *VerifyReport) addIssue(kind string, height uint64, hash types.Hash, repaired bool, format string, args ...interface{}) {
+	report.Issues = append(report.Issues, &VerifyIssue{
+		Kind:     kind,
+		Height:   height,
+		Hash:     fmt.Sprintf("%x", hash),
+		Detail:   fmt.Sprintf(format, args...),
+		Repaired: repaired,
+	})
+}
+
+// Verify check the database is internally consistent, it walks the canonical chain back from the latest block
+// to the genesis block, checking each block decodes, its hash matches, parent links are continuous, every
+// transaction has a matching tx lookup index and receipts counts match, then checks every tx lookup index
+// points to a canonical transaction and every receipts record belongs to a block in store. The height mappings
+// and tx lookup indexes are repaired if repair is true. The checks are done in windows of verifyWindow blocks
+// or records, so the writes are not blocked during the whole verification. Verify fails if the canonical
+// chain is rewritten by reorg, rollback or reindex between windows.
+func (blockStore *BlockStore) Verify(repair bool) (*VerifyReport, error) {
+	if repair && blockStore.readOnly {
+		return nil, dbstore.ErrReadOnly
+	}
+	log.Info("Start verifying block store, repair: %v", repair)
+	verifier := &chainVerifier{
+		blockStore: blockStore,
+		report:     &VerifyReport{Issues: make([]*VerifyIssue, 0)},
+		repair:     repair,
+	}
+	for _, step := range []func(batch dbstore.Batch) (bool, error){verifier.verifyChain, verifier.verifyOrphanTxLookups, verifier.verifyOrphanReceipts} {
+		for done := false; !done; {
+			var err error
+			done, err = verifier.window(step)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	log.Info("Finish verifying block store, %d issues found", len(verifier.report.Issues))
+	return verifier.report, nil
+}
+
+// chainVerifier holds the progress of Verify between windows.
+type chainVerifier struct {
+	blockStore *BlockStore
+	report     *VerifyReport
+	repair     bool
+	started    bool
+	rewrites   uint64        // the chain rewrite counter when the verification started
+	repaired   bool          // whether the batch of current window has repairs
+	cursor     types.Hash    // hash of the next canonical block to walk
+	child      *types.Header // the last walked canonical block header
+	next       []byte        // the key suffix of the next record to check for orphan
+}
+
+// window run a step of verification holding the lock, then commit the repairs. Return whether the step is done.
+func (verifier *chainVerifier) window(step func(batch dbstore.Batch) (bool, error)) (bool, error) {
+	blockStore := verifier.blockStore
+	blockStore.lock.Lock()
+	defer blockStore.lock.Unlock()
+	err := blockStore.pipeline.flush()
+	if err != nil {
+		return false, err
+	}
+	if !verifier.started {
+		verifier.started = true
+		verifier.rewrites = blockStore.rewrites
+		if currentBlock := blockStore.GetCurrentBlock(); currentBlock != nil {
+			verifier.report.LatestHeight = currentBlock.Header.Height
+			verifier.cursor = currentBlock.HeaderHash
+		}
+	} else if blockStore.rewrites != verifier.rewrites {
+		return false, fmt.Errorf("canonical chain is rewritten during verification, please verify again")
+	}
+
+	batch := blockStore.store.NewBatch()
+	verifier.repaired = false
+	done, err := step(batch)
+	if err != nil {
+		batch.Reset()
+		return false, err
+	}
+	if verifier.repaired {
+		err = batch.Write()
+		if err != nil {
+			log.Error("Failed to commit the repaired indexes, as: %v", err)
+			return false, fmt.Errorf("failed to commit the repaired indexes, as: %w", err)
+		}
+		blockStore.rewrites++
+		blockStore.purgeCaches(true)
+		verifier.rewrites = blockStore.rewrites
+	}
+	return done, nil
+}
+
+// verifyChain walk back at most verifyWindow canonical blocks by parent links from cursor and verify them.
+// The walk stops at the genesis block or the first broken block.
+func (verifier *chainVerifier) verifyChain(batch dbstore.Batch) (bool, error) {
+	blockStore, report := verifier.blockStore, verifier.report
+	if verifier.cursor == (types.Hash{}) {
+		return true, nil
+	}
+	for i := 0; i < verifyWindow; i++ {
+		hash := verifier.cursor
+		header, _, err := blockStore.getHeaderWithSize(hash)
+		if err != nil {
+			if verifier.child == nil {
+				report.addIssue(VERIFY_BROKEN_BLOCK, report.LatestHeight, hash, false, "failed to get latest block header, as: %v", err)
+			} else {
+				report.addIssue(VERIFY_BROKEN_PARENT_LINK, verifier.child.Height, hash, false, "failed to get the parent header of block with height %d, as: %v", verifier.child.Height, err)
+			}
+			return true, nil
+		}
+		if verifier.child != nil && verifier.child.Height != header.Height+1 {
+			report.addIssue(VERIFY_BROKEN_PARENT_LINK, verifier.child.Height, hash, false, "parent height %d is not continuous with height %d", header.Height, verifier.child.Height)
+			return true, nil
+		}
+		if computed := common.HeaderHash(&types.Block{Header: header}); computed != hash {
+			report.addIssue(VERIFY_HASH_MISMATCH, header.Height, hash, false, "block header hash is %x", computed)
+		}
+		err = verifier.verifyBlock(batch, hash, header)
+		if err != nil {
+			return false, err
+		}
+		verifier.child = header
+		if header.PrevBlockHash == (types.Hash{}) || header.Height == 0 {
+			return true, nil
+		}
+		verifier.cursor = header.PrevBlockHash
+	}
+	return false, nil
+}
+
+// verifyBlock verify the height mapping, tx lookup indexes and receipts of a canonical block.
+func (verifier *chainVerifier) verifyBlock(batch dbstore.Batch, hash types.Hash, header *types.Header) error {
+	blockStore, report, repair := verifier.blockStore, verifier.report, verifier.repair
+	report.CheckedBlocks++
+	height := header.Height
+	canonicalHash, err := blockStore.getCanonicalHash(height)
+	if err != nil && !errors.Is(err, dbstore.ErrNotFound) {
+		return err
+	}
+	if err != nil || canonicalHash != hash {
+		// the height mappings of frozen blocks are immutable
+		repairable := repair && blockStore.checkFrozen(height) == nil
+		report.addIssue(VERIFY_HEIGHT_MAPPING, height, hash, repairable, "height mapping is %x", canonicalHash)
+		if repairable {
+			err = verifier.put(batch, append(blockHeightPrefix, encodeBlockHeight(height)...), common.HashToBytes(hash))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if blockStore.headersOnly || height < blockStore.pruneHorizon() {
+		return nil
+	}
+
+	body, _, err := blockStore.getBodyWithSize(hash)
+	if err != nil {
+		report.addIssue(VERIFY_BROKEN_BLOCK, height, hash, false, "failed to get block body, as: %v", err)
+		return nil
+	}
+	for i, tx := range body.Transactions {
+		report.CheckedTxLookups++
+		txHash := common.TxHash(tx)
+		expected := indexes.EntityLookupIndex{BlockHash: hash, BlockHeight: height, Index: uint64(i)}
+		var txLookupIntex indexes.EntityLookupIndex
+		_, err := blockStore.getEntity(txPrefix, txHash, &txLookupIntex)
+		if err != nil && !errors.Is(err, dbstore.ErrNotFound) && !errors.Is(err, dbstore.ErrCorrupted) {
+			return err
+		}
+		if err == nil && txLookupIntex == expected {
+			continue
+		}
+		report.addIssue(VERIFY_TX_LOOKUP, height, txHash, repair, "tx lookup index is %v, error: %v", txLookupIntex, err)
+		if repair {
+			indexByte, err := blockStore.encodeEntity(expected)
+			if err != nil {
+				return fmt.Errorf("failed to encode tx lookup index %v, as: %v", expected, err)
+			}
+			err = verifier.put(batch, append(txPrefix, common.HashToBytes(txHash)...), indexByte)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var receipts []*types.Receipt
+	_, err = blockStore.getEntity(receiptPrefix, hash, &receipts)
+	if errors.Is(err, dbstore.ErrNotFound) {
+		// block written without receipts
+		return nil
+	}
+	report.CheckedReceipts++
+	if err != nil {
+		report.addIssue(VERIFY_RECEIPTS_COUNT, height, hash, false, "failed to get receipts, as: %v", err)
+	} else if len(receipts) != len(body.Transactions) {
+		report.addIssue(VERIFY_RECEIPTS_COUNT, height, hash, false, "block has %d transactions, but %d receipts", len(body.Transactions), len(receipts))
+	}
+	return nil
+}
+
+// verifyOrphanTxLookups check at most verifyWindow tx lookup indexes from next, each of them must point to a
+// transaction of a canonical block above the prune horizon.
+func (verifier *chainVerifier) verifyOrphanTxLookups(batch dbstore.Batch) (bool, error) {
+	blockStore := verifier.blockStore
+	if blockStore.headersOnly {
+		return true, nil
+	}
+	return verifier.iterate(txPrefix, func(key []byte, value []byte) error {
+		txHash := common.BytesToHash(key[len(txPrefix):])
+		var txLookupIntex indexes.EntityLookupIndex
+		if err := blockStore.decodeEntity(value, &txLookupIntex); err != nil {
+			return verifier.deleteOrphan(batch, VERIFY_ORPHAN_TX_LOOKUP, 0, key, txHash, "failed to decode tx lookup index, as: %v", err)
+		}
+		canonicalHash, err := blockStore.getCanonicalHash(txLookupIntex.BlockHeight)
+		if err != nil && !errors.Is(err, dbstore.ErrNotFound) {
+			return err
+		}
+		if err != nil || canonicalHash != txLookupIntex.BlockHash || txLookupIntex.BlockHeight < blockStore.pruneHorizon() {
+			return verifier.deleteOrphan(batch, VERIFY_ORPHAN_TX_LOOKUP, txLookupIntex.BlockHeight, key, txHash, "block %x is not a canonical block", txLookupIntex.BlockHash)
+		}
+		body, _, err := blockStore.getBodyWithSize(txLookupIntex.BlockHash)
+		if err != nil {
+			// reported as broken block by the chain walk
+			return nil
+		}
+		if txLookupIntex.Index >= uint64(len(body.Transactions)) || common.TxHash(body.Transactions[txLookupIntex.Index]) != txHash {
+			return verifier.deleteOrphan(batch, VERIFY_ORPHAN_TX_LOOKUP, txLookupIntex.BlockHeight, key, txHash, "transaction is not in block %x", txLookupIntex.BlockHash)
+		}
+		return nil
+	})
+}
+
+// verifyOrphanReceipts check at most verifyWindow receipts records from next, each of them must belong to a
+// block in store.
+func (verifier *chainVerifier) verifyOrphanReceipts(batch dbstore.Batch) (bool, error) {
+	blockStore := verifier.blockStore
+	if blockStore.headersOnly {
+		return true, nil
+	}
+	return verifier.iterate(receiptPrefix, func(key []byte, value []byte) error {
+		blockHash := common.BytesToHash(key[len(receiptPrefix):])
+		_, _, err := blockStore.getHeaderWithSize(blockHash)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, dbstore.ErrNotFound) {
+			return err
+		}
+		// the height mapping may survive the block header
+		var height uint64
+		if heightByte, err := blockStore.store.Get(append(headerHeightPrefix, common.HashToBytes(blockHash)...)); err == nil && len(heightByte) == 8 {
+			height = binary.BigEndian.Uint64(heightByte)
+		}
+		return verifier.deleteOrphan(batch, VERIFY_ORPHAN_RECEIPTS, height, key, blockHash, "block is not in store")
+	})
+}
+
+// iterate call check with at most verifyWindow hash keyed records with the prefix from next, return true if
+// all records are checked, otherwise next is the key suffix of the first unchecked record.
+func (verifier *chainVerifier) iterate(prefix []byte, check func(key []byte, value []byte) error) (bool, error) {
+	iter := verifier.blockStore.store.NewIteratorWithPrefix(prefix, verifier.next)
+	defer iter.Release()
+	for count := 0; iter.Next(); count++ {
+		key := iter.Key()
+		if count == verifyWindow {
+			verifier.next = append([]byte{}, key[len(prefix):]...)
+			return false, nil
+		}
+		if len(key) != len(prefix)+common.HashLength {
+			continue
+		}
+		err := check(append([]byte{}, key...), iter.Value())
+		if err != nil {
+			return false, err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return false, fmt.Errorf("failed to iterate records with prefix %s, as: %w", prefix, err)
+	}
+	verifier.next = nil
+	return true, nil
+}
+
+// deleteOrphan report an orphan record, and delete it if repair is true.
+func (verifier *chainVerifier) deleteOrphan(batch dbstore.Batch, kind string, height uint64, key []byte, hash types.Hash, format string, args ...interface{}) error {
+	verifier.report.addIssue(kind, height, hash, verifier.repair, format, args...)
+	if !verifier.repair {
+		return nil
+	}
+	err := batch.Delete(key)
+	if err != nil {
+		return fmt.Errorf("failed to delete orphan record %x, as: %w", key, err)
+	}
+	verifier.repaired = true
+	return nil
+}
+
+// put put the repaired record to batch.
+func (verifier *chainVerifier) put(batch dbstore.Batch, key []byte, value []byte) error {
+	err := batch.Put(key, value)
+	if err != nil {
+		return fmt.Errorf("failed to repair record %x, as: %w", key, err)
+	}
+	verifier.repaired = true
+	return nil
+}
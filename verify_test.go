@@ -0,0 +1,158 @@
+package blockstore
+
+import (
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/indexes"
+	"github.com/DSiSc/craft/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// mock block store with a chain of two blocks, the second block has a transaction and receipts.
+func mockVerifiedBlockStore(t *testing.T) (*BlockStore, *types.Block, types.Transaction) {
+	blockStore := mockBlockStore(t)
+	block := mockBlock()
+	assert.Nil(t, blockStore.WriteBlock(block))
+	block2, tx := mockBlockWithTx()
+	block2.Header.PrevBlockHash = block.HeaderHash
+	block2.Header.Height = 2
+	block2.Header.ReceiptsRoot = common.ReceiptsRoot(mockReceipts())
+	block2.HeaderHash = types.Hash{}
+	block2.HeaderHash = common.HeaderHash(block2)
+	assert.Nil(t, blockStore.WriteBlockWithReceipts(block2, mockReceipts()))
+	return blockStore, block2, tx
+}
+
+// issueKinds get the kinds of the issues in report
+func issueKinds(report *VerifyReport) []string {
+	kinds := make([]string, 0)
+	for _, issue := range report.Issues {
+		kinds = append(kinds, issue.Kind)
+	}
+	return kinds
+}
+
+// test verify a consistent block store
+func TestBlockStore_Verify(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, _, _ := mockVerifiedBlockStore(t)
+	report, err := blockStore.Verify(false)
+	assert.Nil(err)
+	assert.True(report.Consistent())
+	assert.Equal(uint64(2), report.LatestHeight)
+	assert.Equal(uint64(2), report.CheckedBlocks)
+	assert.Equal(uint64(1), report.CheckedTxLookups)
+	assert.Equal(uint64(1), report.CheckedReceipts)
+	assert.Empty(report.Issues)
+}
+
+// test verify and repair the damaged indexes
+func TestBlockStore_VerifyRepair(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, block2, tx := mockVerifiedBlockStore(t)
+	txHash := common.TxHash(&tx)
+	assert.Nil(blockStore.Delete(append(txPrefix, txHash[:]...)))
+	assert.Nil(blockStore.Delete(append(blockHeightPrefix, encodeBlockHeight(1)...)))
+	assert.Nil(blockStore.Put(append(txPrefix, blockHash[:]...), []byte("orphan")))
+	assert.Nil(blockStore.Put(append(receiptPrefix, blockHash[:]...), []byte("orphan")))
+
+	report, err := blockStore.Verify(false)
+	assert.Nil(err)
+	assert.False(report.Consistent())
+	assert.ElementsMatch([]string{VERIFY_HEIGHT_MAPPING, VERIFY_TX_LOOKUP, VERIFY_ORPHAN_TX_LOOKUP, VERIFY_ORPHAN_RECEIPTS}, issueKinds(report))
+
+	report, err = blockStore.Verify(true)
+	assert.Nil(err)
+	assert.True(report.Consistent())
+	assert.Equal(4, len(report.Issues))
+	report, err = blockStore.Verify(false)
+	assert.Nil(err)
+	assert.Empty(report.Issues)
+	_, txBlockHash, _, _, err := blockStore.GetTransactionByHash(txHash)
+	assert.Nil(err)
+	assert.Equal(block2.HeaderHash, txBlockHash)
+}
+
+// test the orphan issues report the heights of their blocks
+func TestBlockStore_VerifyOrphanHeights(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, block2, _ := mockVerifiedBlockStore(t)
+	sideBlock := mockChildBlock(block2, common.HexToHash("0x1"))
+	sideBlock.Header.PrevBlockHash = block2.Header.PrevBlockHash
+	sideBlock.Header.Height = 2
+	sideBlock.HeaderHash = types.Hash{}
+	sideBlock.HeaderHash = common.HeaderHash(sideBlock)
+	assert.Nil(blockStore.WriteBlockWithReceipts(sideBlock, nil))
+	assert.Nil(blockStore.Delete(append(headerPrefix, sideBlock.HeaderHash[:]...)))
+	indexByte, err := blockStore.encodeEntity(indexes.EntityLookupIndex{BlockHash: sideBlock.HeaderHash, BlockHeight: 2})
+	assert.Nil(err)
+	assert.Nil(blockStore.Put(append(txPrefix, blockHash[:]...), indexByte))
+
+	report, err := blockStore.Verify(false)
+	assert.Nil(err)
+	assert.ElementsMatch([]string{VERIFY_ORPHAN_TX_LOOKUP, VERIFY_ORPHAN_RECEIPTS}, issueKinds(report))
+	for _, issue := range report.Issues {
+		assert.Equal(uint64(2), issue.Height)
+	}
+}
+
+// test verify the unrepairable issues
+func TestBlockStore_VerifyBrokenChain(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, block2, _ := mockVerifiedBlockStore(t)
+	receiptsByte, err := blockStore.encodeEntity(append(mockReceipts(), mockReceipts()...))
+	assert.Nil(err)
+	assert.Nil(blockStore.Put(append(receiptPrefix, block2.HeaderHash[:]...), receiptsByte))
+	assert.Nil(blockStore.Delete(append(headerPrefix, block2.Header.PrevBlockHash[:]...)))
+
+	report, err := blockStore.Verify(true)
+	assert.Nil(err)
+	assert.False(report.Consistent())
+	assert.ElementsMatch([]string{VERIFY_BROKEN_PARENT_LINK, VERIFY_RECEIPTS_COUNT}, issueKinds(report))
+}
+
+// test verify and repair in windows smaller than the chain
+func TestBlockStore_VerifyWindows(t *testing.T) {
+	assert := assert.New(t)
+	defer func(window int) { verifyWindow = window }(verifyWindow)
+	verifyWindow = 2
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	blocks := writeMockChain(t, blockStore, 5)
+	txHash := common.TxHash(blocks[3].Transactions[0])
+	assert.Nil(blockStore.Delete(append(txPrefix, txHash[:]...)))
+	for i := byte(0); i < 3; i++ {
+		orphan := types.Hash{i}
+		assert.Nil(blockStore.Put(append(txPrefix, orphan[:]...), []byte("orphan")))
+	}
+
+	report, err := blockStore.Verify(true)
+	assert.Nil(err)
+	assert.Equal(uint64(5), report.CheckedBlocks)
+	assert.ElementsMatch([]string{VERIFY_TX_LOOKUP, VERIFY_ORPHAN_TX_LOOKUP, VERIFY_ORPHAN_TX_LOOKUP, VERIFY_ORPHAN_TX_LOOKUP}, issueKinds(report))
+	report, err = blockStore.Verify(false)
+	assert.Nil(err)
+	assert.Empty(report.Issues)
+}
+
+// test verify fails if the chain is rewritten between windows
+func TestBlockStore_VerifyRewritten(t *testing.T) {
+	assert := assert.New(t)
+	defer func(window int) { verifyWindow = window }(verifyWindow)
+	verifyWindow = 2
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	writeMockChain(t, blockStore, 5)
+
+	verifier := &chainVerifier{blockStore: blockStore, report: &VerifyReport{}}
+	done, err := verifier.window(verifier.verifyChain)
+	assert.Nil(err)
+	assert.False(done)
+	// purging caches alone doesn't rewrite the chain
+	blockStore.purgeCaches(true)
+	_, err = verifier.window(verifier.verifyChain)
+	assert.Nil(err)
+	assert.Nil(blockStore.Rollback(2))
+	_, err = verifier.window(verifier.verifyChain)
+	assert.NotNil(err)
+}
@@ -0,0 +1,206 @@
+package blockstore
+
+import (
+	"errors"
+	"fmt"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/blockstore/indexes"
+	"github.com/DSiSc/craft/types"
+)
+
+// BlockStoreView is a read-only view of the block store frozen at the time it is created, so the entities read
+// by several calls are consistent with each other. The blocks queued in async write mode are invisible until
+// committed. View must be released after use.
+type BlockStoreView struct {
+	blockStore *BlockStore
+}
+
+// View create a read-only view of the committed state of the block store.
+func (blockStore *BlockStore) View() (*BlockStoreView, error) {
+	viewStore, err := blockStore.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &BlockStoreView{blockStore: viewStore}, nil
+}
+
+// snapshot create a block store reading the snapshot of the committed state, it must be closed after use.
+func (blockStore *BlockStore) snapshot() (*BlockStore, error) {
+	blockStore.lock.RLock()
+	defer blockStore.lock.RUnlock()
+	snapshot, err := blockStore.store.Snapshot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to take database snapshot, as: %w", err)
+	}
+	viewStore := &BlockStore{
+		horizon:           blockStore.pruneHorizon(),
+		store:             &snapshotStore{snapshot: snapshot},
+		codec:             blockStore.codec,
+		freezerCodec:      blockStore.freezerCodec,
+		headersOnly:       blockStore.headersOnly,
+		addressIndex:      blockStore.addressIndex,
+		bloomSectionSize:  blockStore.bloomSectionSize,
+		bloomSectionsFrom: blockStore.bloomSectionsFrom,
+		freezer:           blockStore.freezer,
+		encryptionKeys:    blockStore.encryptionKeys,
+		readOnly:          true,
+		txRoot:            blockStore.txRoot,
+		receiptsRoot:      blockStore.receiptsRoot,
+	}
+
+	// the current block of the view is the latest block recorded in the snapshot
+	blockHashByte, err := snapshot.Get([]byte(latestBlockKey))
+	if err == nil {
+		latestBlock, err := viewStore.loadBlock(common.BytesToHash(blockHashByte))
+		if err != nil {
+			snapshot.Release()
+			return nil, err
+		}
+		viewStore.currentBlock.Store(latestBlock)
+	} else if !errors.Is(err, dbstore.ErrNotFound) {
+		snapshot.Release()
+		return nil, fmt.Errorf("failed to get latest block hash from database snapshot, as: %w", err)
+	}
+	return viewStore, nil
+}
+
+// Release release the database snapshot, the operations after release return dbstore.ErrClosed.
+func (view *BlockStoreView) Release() {
+	view.blockStore.store.Close()
+}
+
+// GetBlockByHash get block by block hash.
+func (view *BlockStoreView) GetBlockByHash(hash types.Hash) (*types.Block, error) {
+	return view.blockStore.GetBlockByHash(hash)
+}
+
+// GetBlockByHeight get block by height.
+func (view *BlockStoreView) GetBlockByHeight(height uint64) (*types.Block, error) {
+	return view.blockStore.GetBlockByHeight(height)
+}
+
+// GetHeaderByHash get block header by block hash.
+func (view *BlockStoreView) GetHeaderByHash(hash types.Hash) (*types.Header, error) {
+	return view.blockStore.GetHeaderByHash(hash)
+}
+
+// GetHeaderByHeight get block header by height.
+func (view *BlockStoreView) GetHeaderByHeight(height uint64) (*types.Header, error) {
+	return view.blockStore.GetHeaderByHeight(height)
+}
+
+// GetBodyByHash get block body by block hash.
+func (view *BlockStoreView) GetBodyByHash(hash types.Hash) (*BlockBody, error) {
+	return view.blockStore.GetBodyByHash(hash)
+}
+
+// GetBlocksByRange get the canonical blocks with height in [from, to], each block is passed to the callback.
+func (view *BlockStoreView) GetBlocksByRange(from, to uint64, maxBytes int, callback func(block *types.Block) bool) error {
+	return view.blockStore.GetBlocksByRange(from, to, maxBytes, callback)
+}
+
+// GetHeadersByRange get the canonical block headers with height in [from, to], each header is passed to the callback.
+func (view *BlockStoreView) GetHeadersByRange(from, to uint64, maxBytes int, callback func(header *types.Header) bool) error {
+	return view.blockStore.GetHeadersByRange(from, to, maxBytes, callback)
+}
+
+// GetCurrentBlock get the latest block at the time the view is created.
+func (view *BlockStoreView) GetCurrentBlock() *types.Block {
+	return view.blockStore.GetCurrentBlock()
+}
+
+// GetCurrentBlockHeight get the latest block height at the time the view is created.
+func (view *BlockStoreView) GetCurrentBlockHeight() uint64 {
+	return view.blockStore.GetCurrentBlockHeight()
+}
+
+// GetTransactionByHash get transaction by hash
+func (view *BlockStoreView) GetTransactionByHash(hash types.Hash) (*types.Transaction, types.Hash, uint64, uint64, error) {
+	return view.blockStore.GetTransactionByHash(hash)
+}
+
+// GetReceiptByTxHash get receipt by relative tx's hash
+func (view *BlockStoreView) GetReceiptByTxHash(txHash types.Hash) (*types.Receipt, types.Hash, uint64, uint64, error) {
+	return view.blockStore.GetReceiptByTxHash(txHash)
+}
+
+// GetReceiptByBlockHash get receipts by relative block's hash, return dbstore.ErrNotFound if the block has no receipts.
+func (view *BlockStoreView) GetReceiptByBlockHash(blockHash types.Hash) ([]*types.Receipt, error) {
+	return view.blockStore.GetReceiptByBlockHash(blockHash)
+}
+
+// GetTransactionsByAddress get the transactions sent from or to the address in block height range.
+func (view *BlockStoreView) GetTransactionsByAddress(addr types.Address, fromHeight, toHeight uint64, limit int) ([]*indexes.AddressTransaction, error) {
+	return view.blockStore.GetTransactionsByAddress(addr, fromHeight, toHeight, limit)
+}
+
+// FilterLogs get the logs matching the filter from the receipts of canonical blocks.
+func (view *BlockStoreView) FilterLogs(filter *LogFilter) ([]*types.Log, error) {
+	return view.blockStore.FilterLogs(filter)
+}
+
+// Get get a record by key
+func (view *BlockStoreView) Get(key []byte) ([]byte, error) {
+	return view.blockStore.Get(key)
+}
+
+// snapshotStore serve the database snapshot as a DBStore, the writes return dbstore.ErrReadOnly.
+type snapshotStore struct {
+	snapshot dbstore.DBSnapshot
+}
+
+func (s *snapshotStore) Put(key []byte, value []byte) error {
+	return dbstore.ErrReadOnly
+}
+
+func (s *snapshotStore) Delete(key []byte) error {
+	return dbstore.ErrReadOnly
+}
+
+func (s *snapshotStore) Get(key []byte) ([]byte, error) {
+	return s.snapshot.Get(key)
+}
+
+func (s *snapshotStore) NewIteratorWithPrefix(prefix []byte, start []byte) dbstore.Iterator {
+	return s.snapshot.NewIteratorWithPrefix(prefix, start)
+}
+
+func (s *snapshotStore) NewBatch() dbstore.Batch {
+	return readOnlyBatch{}
+}
+
+func (s *snapshotStore) Snapshot() (dbstore.DBSnapshot, error) {
+	return nil, fmt.Errorf("can not take snapshot of a database snapshot")
+}
+
+// Close release the snapshot.
+func (s *snapshotStore) Close() error {
+	s.snapshot.Release()
+	return nil
+}
+
+// readOnlyBatch is the batch of read-only database, the write of it returns dbstore.ErrReadOnly.
+type readOnlyBatch struct{}
+
+func (readOnlyBatch) Put(key, value []byte) error {
+	return dbstore.ErrReadOnly
+}
+
+func (readOnlyBatch) Delete(key []byte) error {
+	return dbstore.ErrReadOnly
+}
+
+func (readOnlyBatch) ValueSize() int {
+	return 0
+}
+
+func (readOnlyBatch) Write() error {
+	return dbstore.ErrReadOnly
+}
+
+func (readOnlyBatch) WriteSync() error {
+	return dbstore.ErrReadOnly
+}
+
+func (readOnlyBatch) Reset() {}
@@ -0,0 +1,86 @@
+package blockstore
+
+import (
+	"errors"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// test the view is not affected by the blocks written after it is created
+func TestBlockStore_View(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	emptyView, err := blockStore.View()
+	assert.Nil(err)
+	assert.Nil(emptyView.GetCurrentBlock())
+	emptyView.Release()
+
+	block1, tx := mockBlockWithTx()
+	assert.Nil(blockStore.WriteBlock(block1))
+	view, err := blockStore.View()
+	assert.Nil(err)
+	defer view.Release()
+
+	block2 := mockChildBlock(block1, common.HexToHash("0x1"))
+	assert.Nil(blockStore.WriteBlockWithReceipts(block2, mockReceipts()))
+
+	assert.Equal(block1.HeaderHash, view.GetCurrentBlock().HeaderHash)
+	assert.Equal(uint64(1), view.GetCurrentBlockHeight())
+	block, err := view.GetBlockByHeight(1)
+	assert.Nil(err)
+	assert.Equal(block1.HeaderHash, block.HeaderHash)
+	_, blockHash, _, _, err := view.GetTransactionByHash(common.TxHash(&tx))
+	assert.Nil(err)
+	assert.Equal(block1.HeaderHash, blockHash)
+	_, err = view.GetHeaderByHeight(2)
+	assert.True(errors.Is(err, dbstore.ErrNotFound))
+	_, err = view.GetReceiptByBlockHash(block2.HeaderHash)
+	assert.True(errors.Is(err, dbstore.ErrNotFound))
+	_, err = blockStore.GetReceiptByBlockHash(block2.HeaderHash)
+	assert.Nil(err)
+
+	assert.NotNil(view.blockStore.WriteBlock(block2))
+	assert.Equal(dbstore.ErrReadOnly, view.blockStore.Put([]byte("key"), []byte("value")))
+}
+
+// test the view operations after release
+func TestBlockStoreView_Release(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+	view, err := blockStore.View()
+	assert.Nil(err)
+	view.Release()
+	_, err = view.GetBlockByHash(block.HeaderHash)
+	assert.True(errors.Is(err, dbstore.ErrClosed))
+}
+
+// test the view reads the frozen blocks
+func TestBlockStore_ViewFrozenBlocks(t *testing.T) {
+	assert := assert.New(t)
+	blockStore := mockBlockStore(t, withFreezer(t.TempDir(), 100))
+	defer blockStore.Close()
+	blocks := writeMockChain(t, blockStore, 3)
+	blockStore.freeze(1, make(chan struct{}))
+	assert.Equal(uint64(3), blockStore.freezer.Frozen())
+
+	view, err := blockStore.View()
+	assert.Nil(err)
+	defer view.Release()
+	for _, block := range blocks {
+		frozenBlock, err := view.GetBlockByHash(block.HeaderHash)
+		assert.Nil(err)
+		assert.Equal(block.HeaderHash, frozenBlock.HeaderHash)
+		receipts, err := view.GetReceiptByBlockHash(block.HeaderHash)
+		assert.Nil(err)
+		assert.Equal(1, len(receipts))
+	}
+	header, err := view.GetHeaderByHeight(1)
+	assert.Nil(err)
+	assert.Equal(blocks[0].Header.Height, header.Height)
+}
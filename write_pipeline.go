@@ -0,0 +1,286 @@
+package blockstore
+
+import (
+	"fmt"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+	"sync"
+	"time"
+)
+
+const (
+	// commit every block and flush it to stable storage before returning.
+	DURABILITY_SYNC = "sync"
+	// commit the queued blocks every group commit interval, the last block of a group is flushed to stable storage.
+	DURABILITY_GROUP = "group"
+	// commit every block without flushing it to stable storage.
+	DURABILITY_NOSYNC = "nosync"
+	// default capacity of the write queue
+	DEFAULT_WRITE_QUEUE_SIZE = 256
+	// default group commit interval in milliseconds
+	DEFAULT_GROUP_COMMIT_INTERVAL = 10
+)
+
+// blockWrite is a block to be written along with its receipts, and the batch prepared for it.
+type blockWrite struct {
+	block        *types.Block
+	receipts     []*types.Receipt
+	withReceipts bool
+	canonical    bool
+	previous     *types.Block // the current block before the queued canonical block
+	batch        dbstore.Batch
+	bloom        types.Bloom
+	txHashes     []types.Hash
+	prepared     chan struct{} // closed after the batch is prepared
+	prepareErr   error
+	flushed      chan error // not nil if this is a flush request instead of a block
+}
+
+// writePipeline queue the written blocks, prepare them in parallel and commit them in write order.
+// The queued blocks are served by the block store lookups until they are committed. A nil writePipeline
+// is the synchronous write mode which has no queued block.
+type writePipeline struct {
+	blockStore          *BlockStore
+	queue               chan *blockWrite
+	durability          string
+	groupCommitInterval time.Duration
+	lock                sync.RWMutex
+	pending             []*blockWrite // queued blocks in write order
+	err                 error         // the first commit error, no block will be committed after it
+	closed              bool
+	done                chan struct{}
+}
+
+// newWritePipeline create a write pipeline and start committing the queued blocks.
+func newWritePipeline(blockStore *BlockStore, queueSize int, durability string, groupCommitInterval time.Duration) *writePipeline {
+	if queueSize <= 0 {
+		queueSize = DEFAULT_WRITE_QUEUE_SIZE
+	}
+	if groupCommitInterval <= 0 {
+		groupCommitInterval = DEFAULT_GROUP_COMMIT_INTERVAL * time.Millisecond
+	}
+	pipeline := &writePipeline{
+		blockStore:          blockStore,
+		queue:               make(chan *blockWrite, queueSize),
+		durability:          durability,
+		groupCommitInterval: groupCommitInterval,
+		pending:             make([]*blockWrite, 0),
+		done:                make(chan struct{}),
+	}
+	go pipeline.loop()
+	return pipeline
+}
+
+// enqueue start preparing the block and queue it, blocks if the queue is full. The queued canonical block
+// becomes the current block. The caller must hold the block store lock, so the blocks are queued in write order.
+func (pipeline *writePipeline) enqueue(write *blockWrite) error {
+	if pipeline.closed {
+		return dbstore.ErrClosed
+	}
+	write.prepared = make(chan struct{})
+	// the current block is recorded along with the error check, so it can't be overwritten after rolled back
+	pipeline.lock.Lock()
+	if pipeline.err != nil {
+		pipeline.lock.Unlock()
+		return pipeline.err
+	}
+	pipeline.pending = append(pipeline.pending, write)
+	if write.canonical {
+		write.previous = pipeline.blockStore.GetCurrentBlock()
+		pipeline.blockStore.recordCurrentBlock(write.block)
+	}
+	pipeline.lock.Unlock()
+	go func() {
+		write.prepareErr = pipeline.blockStore.prepareBlockWrite(write)
+		close(write.prepared)
+	}()
+	pipeline.queue <- write
+	return nil
+}
+
+// flush wait until the queued blocks are committed, return the first commit error. The caller must hold
+// the block store lock.
+func (pipeline *writePipeline) flush() error {
+	if pipeline == nil || pipeline.closed {
+		return nil
+	}
+	flushed := make(chan error, 1)
+	pipeline.queue <- &blockWrite{flushed: flushed}
+	return <-flushed
+}
+
+// close commit the queued blocks and stop the pipeline. The caller must hold the block store lock.
+func (pipeline *writePipeline) close() error {
+	if pipeline == nil || pipeline.closed {
+		return nil
+	}
+	pipeline.closed = true
+	close(pipeline.queue)
+	<-pipeline.done
+	return pipeline.error()
+}
+
+// loop commit the queued blocks until the queue is closed.
+func (pipeline *writePipeline) loop() {
+	defer close(pipeline.done)
+	var tick <-chan time.Time
+	if pipeline.durability == DURABILITY_GROUP {
+		ticker := time.NewTicker(pipeline.groupCommitInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	group := make([]*blockWrite, 0)
+	for {
+		select {
+		case write, ok := <-pipeline.queue:
+			if !ok {
+				pipeline.commit(group)
+				return
+			}
+			if write.flushed != nil {
+				pipeline.commit(group)
+				group = group[:0]
+				write.flushed <- pipeline.error()
+				continue
+			}
+			group = append(group, write)
+			if pipeline.durability != DURABILITY_GROUP {
+				pipeline.commit(group)
+				group = group[:0]
+			}
+		case <-tick:
+			pipeline.commit(group)
+			group = group[:0]
+		}
+	}
+}
+
+// commit commit a group of blocks in write order, then remove them from the queued blocks. The last block
+// of the group is flushed to stable storage unless the durability is no-sync. On the first commit error, the
+// current block is rolled back to the last committed canonical block.
+func (pipeline *writePipeline) commit(group []*blockWrite) {
+	if len(group) == 0 {
+		return
+	}
+	err := pipeline.error()
+	failed := len(group)
+	for i, write := range group {
+		if err != nil {
+			break
+		}
+		<-write.prepared
+		err = write.prepareErr
+		if err == nil {
+			sync := pipeline.durability != DURABILITY_NOSYNC && i == len(group)-1
+			err = pipeline.blockStore.commitBlockWrite(write, sync)
+		}
+		if err != nil {
+			log.Error("Failed to commit queued block %x, the following blocks will be discarded, as: %v", write.block.HeaderHash, err)
+			err = fmt.Errorf("failed to commit queued block %x, as: %w", write.block.HeaderHash, err)
+			failed = i
+		}
+	}
+
+	pipeline.lock.Lock()
+	defer pipeline.lock.Unlock()
+	if pipeline.err == nil && err != nil {
+		pipeline.err = err
+		// the failed block and the blocks queued after it are discarded
+		for _, write := range pipeline.pending[failed:] {
+			if write.canonical {
+				// the previous block is nil if the discarded block is the first block of the store
+				log.Warn("Roll back current block, as the queued canonical block %x is discarded", write.block.HeaderHash)
+				pipeline.blockStore.currentBlock.Store(write.previous)
+				break
+			}
+		}
+	}
+	pipeline.pending = pipeline.pending[len(group):]
+}
+
+// error return the first commit error.
+func (pipeline *writePipeline) error() error {
+	pipeline.lock.RLock()
+	defer pipeline.lock.RUnlock()
+	return pipeline.err
+}
+
+// getBlock get the queued block by hash.
+func (pipeline *writePipeline) getBlock(hash types.Hash) (*blockWrite, bool) {
+	if pipeline == nil {
+		return nil, false
+	}
+	pipeline.lock.RLock()
+	defer pipeline.lock.RUnlock()
+	for _, write := range pipeline.pending {
+		if write.block.HeaderHash == hash {
+			return write, true
+		}
+	}
+	return nil, false
+}
+
+// getCanonicalBlock get the queued canonical block by height.
+func (pipeline *writePipeline) getCanonicalBlock(height uint64) (*blockWrite, bool) {
+	if pipeline == nil {
+		return nil, false
+	}
+	pipeline.lock.RLock()
+	defer pipeline.lock.RUnlock()
+	for i := len(pipeline.pending) - 1; i >= 0; i-- {
+		write := pipeline.pending[i]
+		if write.canonical && write.block.Header.Height == height {
+			return write, true
+		}
+	}
+	return nil, false
+}
+
+// hasCanonicalBlockIn check whether a queued canonical block has height in [from, to].
+func (pipeline *writePipeline) hasCanonicalBlockIn(from, to uint64) bool {
+	if pipeline == nil {
+		return false
+	}
+	pipeline.lock.RLock()
+	defer pipeline.lock.RUnlock()
+	for _, write := range pipeline.pending {
+		if write.canonical && write.block.Header.Height >= from && write.block.Header.Height <= to {
+			return true
+		}
+	}
+	return false
+}
+
+// getTransaction get the queued canonical block containing the transaction, along with the index of the
+// transaction in block. It waits for the blocks to be prepared, as the transaction hashes are computed then.
+func (pipeline *writePipeline) getTransaction(txHash types.Hash) (*blockWrite, uint64, bool) {
+	if pipeline == nil {
+		return nil, 0, false
+	}
+	pipeline.lock.RLock()
+	pending := append([]*blockWrite{}, pipeline.pending...)
+	pipeline.lock.RUnlock()
+	for i := len(pending) - 1; i >= 0; i-- {
+		write := pending[i]
+		if !write.canonical {
+			continue
+		}
+		<-write.prepared
+		for index, hash := range write.txHashes {
+			if hash == txHash {
+				return write, uint64(index), true
+			}
+		}
+	}
+	return nil, 0, false
+}
+
+// Flush wait until the blocks queued in async write mode are committed, return the first commit error of
+// the write pipeline. The block store should be reopened after a commit error.
+func (blockStore *BlockStore) Flush() error {
+	blockStore.lock.Lock()
+	defer blockStore.lock.Unlock()
+	return blockStore.pipeline.flush()
+}
@@ -0,0 +1,153 @@
+package blockstore
+
+import (
+	"errors"
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/config"
+	"github.com/DSiSc/blockstore/dbstore"
+	"github.com/DSiSc/craft/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// test the queued blocks are served by lookups
+func TestBlockStore_AsyncWrite(t *testing.T) {
+	assert := assert.New(t)
+	blockStore := mockBlockStore(t, withGroupCommit)
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+	block2, tx := mockBlockWithTx()
+	block2.Header.PrevBlockHash = block.HeaderHash
+	block2.Header.Height = 2
+	block2.HeaderHash = types.Hash{}
+	block2.HeaderHash = common.HeaderHash(block2)
+	assert.Nil(blockStore.WriteBlockWithReceipts(block2, mockReceipts()))
+
+	assert.Equal(block2.HeaderHash, blockStore.GetCurrentBlock().HeaderHash)
+	_, err := blockStore.Get(append(headerPrefix, block2.HeaderHash[:]...))
+	assert.True(errors.Is(err, dbstore.ErrNotFound))
+	blockSaved, err := blockStore.GetBlockByHeight(2)
+	assert.Nil(err)
+	assert.Equal(block2.HeaderHash, blockSaved.HeaderHash)
+	header, err := blockStore.GetHeaderByHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(block.Header, header)
+	_, txBlockHash, _, index, err := blockStore.GetTransactionByHash(common.TxHash(&tx))
+	assert.Nil(err)
+	assert.Equal(block2.HeaderHash, txBlockHash)
+	assert.Equal(uint64(0), index)
+	receipts, err := blockStore.GetReceiptByBlockHash(block2.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(mockReceipts(), receipts)
+
+	assert.Nil(blockStore.Flush())
+	_, err = blockStore.Get(append(headerPrefix, block2.HeaderHash[:]...))
+	assert.Nil(err)
+	_, _, _, _, err = blockStore.GetReceiptByTxHash(common.TxHash(&tx))
+	assert.Nil(err)
+}
+
+// test rollback commits the queued blocks first
+func TestBlockStore_AsyncWriteRollback(t *testing.T) {
+	assert := assert.New(t)
+	blockStore := mockBlockStore(t, withGroupCommit, func(blockStoreConfig *config.BlockStoreConfig) {
+		blockStoreConfig.Durability = DURABILITY_NOSYNC
+	})
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+	block2 := mockChildBlock(block, stateHash)
+	assert.Nil(blockStore.WriteBlock(block2))
+	assert.Nil(blockStore.Rollback(1))
+	assert.Equal(block.HeaderHash, blockStore.GetCurrentBlock().HeaderHash)
+	_, err := blockStore.GetBlockByHash(block2.HeaderHash)
+	assert.NotNil(err)
+}
+
+// mock store whose batches fail to write
+type failingBatchStore struct {
+	dbstore.DBStore
+}
+
+func (store *failingBatchStore) NewBatch() dbstore.Batch {
+	return &failingBatch{store.DBStore.NewBatch()}
+}
+
+type failingBatch struct {
+	dbstore.Batch
+}
+
+func (batch *failingBatch) Write() error {
+	return errors.New("mock batch write error")
+}
+
+func (batch *failingBatch) WriteSync() error {
+	return errors.New("mock batch write error")
+}
+
+// test the current block is rolled back if the queued blocks fail to commit
+func TestBlockStore_AsyncWriteFailure(t *testing.T) {
+	assert := assert.New(t)
+	blockStore := mockBlockStore(t, withGroupCommit)
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+	assert.Nil(blockStore.Flush())
+
+	blockStore.store = &failingBatchStore{blockStore.store}
+	block2 := mockChildBlock(block, stateHash)
+	assert.Nil(blockStore.WriteBlock(block2))
+	assert.Equal(block2.HeaderHash, blockStore.GetCurrentBlock().HeaderHash)
+	assert.NotNil(blockStore.Flush())
+	assert.Equal(block.HeaderHash, blockStore.GetCurrentBlock().HeaderHash)
+	_, err := blockStore.GetBlockByHash(block2.HeaderHash)
+	assert.NotNil(err)
+	assert.NotNil(blockStore.WriteBlock(mockChildBlock(block, stateHash)))
+	assert.Equal(block.HeaderHash, blockStore.GetCurrentBlock().HeaderHash)
+}
+
+// test close commits the queued blocks
+func TestBlockStore_AsyncWriteClose(t *testing.T) {
+	assert := assert.New(t)
+	blockStoreConfig := mockTempBlockStoreConfig(t, withGroupCommit, withLevelDB)
+	blockStore, err := NewBlockStore(blockStoreConfig)
+	assert.Nil(err)
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+	assert.Nil(blockStore.Close())
+	assert.Equal(dbstore.ErrClosed, blockStore.WriteBlock(mockChildBlock(block, stateHash)))
+
+	blockStore, err = NewBlockStore(blockStoreConfig)
+	assert.Nil(err)
+	assert.Equal(block.HeaderHash, blockStore.GetCurrentBlock().HeaderHash)
+	assert.Nil(blockStore.Close())
+}
+
+// test the durability config
+func TestBlockStore_Durability(t *testing.T) {
+	assert := assert.New(t)
+	config := mockBlockStoreConfig()
+	config.Durability = DURABILITY_GROUP
+	_, err := NewBlockStore(config)
+	assert.NotNil(err)
+	config.Durability = "unknown"
+	_, err = NewBlockStore(config)
+	assert.NotNil(err)
+
+	// the invalid durability doesn't hold the database open
+	levelDBConfig := mockTempBlockStoreConfig(t, withLevelDB)
+	levelDBConfig.Durability = "unknown"
+	_, err = NewBlockStore(levelDBConfig)
+	assert.NotNil(err)
+	levelDBConfig.Durability = DURABILITY_NOSYNC
+	levelDBStore, err := NewBlockStore(levelDBConfig)
+	assert.Nil(err)
+	assert.Nil(levelDBStore.Close())
+
+	config.Durability = DURABILITY_SYNC
+	blockStore, err := NewBlockStore(config)
+	assert.Nil(err)
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+	assert.Nil(blockStore.Flush())
+	_, err = blockStore.GetBlockByHash(block.HeaderHash)
+	assert.Nil(err)
+}